@@ -0,0 +1,37 @@
+package libconfig
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Check runs a set of code-driven rules against the configuration and
+// returns every violation. Each rule is keyed by the path of the setting it
+// checks and is called with the looked-up value; a non-nil result is
+// reported wrapped with the path. A path that cannot be looked up is
+// reported with the lookup error instead, and its rule is not called.
+// Violations are returned in path order; nil means every rule passed.
+func (c *Config) Check(rules map[string]func(*Value) error) []error {
+	paths := make([]string, 0, len(rules))
+	for path := range rules {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	var violations []error
+
+	for _, path := range paths {
+		val, err := c.Lookup(path)
+		if err != nil {
+			violations = append(violations, fmt.Errorf("check '%s': %w", path, err))
+			continue
+		}
+
+		if err := rules[path](val); err != nil {
+			violations = append(violations, fmt.Errorf("check '%s': %w", path, err))
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,206 @@
+package libconfig
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Conversions to other formats go through generic Go data or plain text and
+// lose what those formats cannot express: arrays and lists both become
+// sequences, integers lose their radix and 64-bit marker, and consumers that
+// hold numbers as float64 (as many YAML and TOML libraries do for untyped
+// data) cannot keep int64 values beyond 53 bits exact.
+
+// MarshalYAML returns the configuration as generic Go data, as from ToMap.
+// It implements the Marshaler interface of the common YAML packages, so a
+// *Config can be passed to yaml.Marshal directly.
+func (c *Config) MarshalYAML() (any, error) {
+	return c.ToMap(), nil
+}
+
+// ToTOML renders the configuration as TOML. Top-level groups become tables
+// such as [server] and [server.tls], scalars keep their types, arrays and
+// lists become TOML arrays, and groups inside them become inline tables.
+// Null values, which TOML cannot represent, return ErrNotRepresentable.
+func (c *Config) ToTOML() ([]byte, error) {
+	if c.Root.Type != TypeGroup {
+		return nil, fmt.Errorf("root is a %s: %w", c.Root.Type, ErrNotGroup)
+	}
+
+	var buf bytes.Buffer
+
+	if err := writeTOMLTable(&buf, "", &c.Root); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeTOMLTable writes the settings of group, followed by its nested groups
+// as tables named below prefix.
+func writeTOMLTable(buf *bytes.Buffer, prefix string, group *Value) error {
+	var tables []string
+
+	for _, key := range group.MemberKeys() {
+		member := group.GroupVal[key]
+		if member.Type == TypeGroup {
+			tables = append(tables, key)
+			continue
+		}
+
+		buf.WriteString(tomlKey(key) + " = ")
+
+		if err := writeTOMLValue(buf, joinPath(prefix, key), &member); err != nil {
+			return err
+		}
+
+		buf.WriteByte('\n')
+	}
+
+	for _, key := range tables {
+		member := group.GroupVal[key]
+
+		name := tomlKey(key)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+
+		buf.WriteString("[" + name + "]\n")
+
+		if err := writeTOMLTable(buf, name, &member); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeTOMLValue writes v inline.
+func writeTOMLValue(buf *bytes.Buffer, path string, v *Value) error {
+	switch v.Type {
+	case TypeInt:
+		buf.WriteString(strconv.Itoa(v.IntVal))
+	case TypeInt64:
+		buf.WriteString(strconv.FormatInt(v.Int64Val, 10))
+	case TypeFloat:
+		buf.WriteString(tomlFloat(v.FloatVal))
+	case TypeBool:
+		buf.WriteString(strconv.FormatBool(v.BoolVal))
+	case TypeString:
+		buf.WriteString(tomlString(v.StrVal))
+	case TypeArray, TypeList:
+		buf.WriteByte('[')
+
+		for i, element := range v.Iter() {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+
+			if err := writeTOMLValue(buf, fmt.Sprintf("%s[%d]", path, i), &element); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteByte(']')
+	case TypeGroup:
+		buf.WriteByte('{')
+
+		for i, key := range v.MemberKeys() {
+			member := v.GroupVal[key]
+
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			buf.WriteString(" " + tomlKey(key) + " = ")
+
+			if err := writeTOMLValue(buf, joinPath(path, key), &member); err != nil {
+				return err
+			}
+		}
+
+		buf.WriteString(" }")
+	default:
+		return fmt.Errorf("%s at '%s' in TOML: %w", v.Type, path, ErrNotRepresentable)
+	}
+
+	return nil
+}
+
+// tomlKey returns key bare if TOML allows it and quoted otherwise.
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return tomlString(key)
+		}
+	}
+
+	return key
+}
+
+// tomlFloat formats a float so that TOML reads it back as a float.
+func tomlFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+
+	text := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".eInN") {
+		text += ".0"
+	}
+
+	return text
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+
+	b.WriteByte('"')
+
+	return b.String()
+}
@@ -0,0 +1,176 @@
+package libconfig
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// EqualOptions controls how Equal and Diff compare values.
+type EqualOptions struct {
+	// FloatEpsilon is the largest difference between two floats that are
+	// still treated as equal, so that rounding noise in computed values,
+	// such as 0.1+0.2 against 0.3, is not reported as a change. Zero
+	// compares floats exactly.
+	FloatEpsilon float64
+}
+
+// Change is a setting that differs between two configurations, as reported
+// by Diff. Old is nil for a setting that was added and New is nil for one
+// that was removed.
+type Change struct {
+	Path string
+	Old  *Value
+	New  *Value
+}
+
+// String describes the change, such as "server.port: 8080 -> 8081".
+func (ch Change) String() string {
+	switch {
+	case ch.Old == nil:
+		return fmt.Sprintf("%s: added %s", ch.Path, describe(ch.New))
+	case ch.New == nil:
+		return fmt.Sprintf("%s: removed %s", ch.Path, describe(ch.Old))
+	default:
+		return fmt.Sprintf("%s: %s -> %s", ch.Path, describe(ch.Old), describe(ch.New))
+	}
+}
+
+// describe returns the literal text of a scalar, the type and length of an
+// array or list, such as "array of 3", or the type of a group.
+func describe(v *Value) string {
+	if literal, err := v.Literal(); err == nil {
+		return literal
+	}
+
+	switch v.Type {
+	case TypeArray:
+		return fmt.Sprintf("array of %d", len(v.ArrayVal))
+	case TypeList:
+		return fmt.Sprintf("list of %d", len(v.ListVal))
+	default:
+		return v.Type.String()
+	}
+}
+
+// Equal reports whether the configuration holds the same settings as other.
+// Values must have the same types, group members are compared regardless of
+// declaration order, and source positions, integer notation, float text and
+// comments are ignored. Floats are compared exactly; use EqualWithOptions to
+// allow for rounding.
+func (c *Config) Equal(other *Config) bool {
+	return c.EqualWithOptions(other, EqualOptions{})
+}
+
+// EqualWithOptions reports whether the configuration holds the same
+// settings as other, comparing values as directed by opts.
+func (c *Config) EqualWithOptions(other *Config, opts EqualOptions) bool {
+	return len(c.DiffWithOptions(other, opts)) == 0
+}
+
+// Diff returns the settings that differ between the configuration and
+// other, in path order, comparing values as Equal does. Groups are compared
+// member by member; arrays and lists of the same type and length are
+// compared element by element, with paths such as ports[1], and otherwise
+// reported as a whole.
+func (c *Config) Diff(other *Config) []Change {
+	return c.DiffWithOptions(other, EqualOptions{})
+}
+
+// DiffWithOptions returns the settings that differ between the
+// configuration and other, comparing values as directed by opts.
+func (c *Config) DiffWithOptions(other *Config, opts EqualOptions) []Change {
+	var changes []Change
+
+	diffValues("", &c.Root, &other.Root, opts, &changes)
+
+	return changes
+}
+
+// diffValues appends the differences between before and after at path to changes.
+func diffValues(path string, before, after *Value, opts EqualOptions, changes *[]Change) {
+	if before.Type != after.Type {
+		*changes = append(*changes, Change{Path: path, Old: before, New: after})
+		return
+	}
+
+	switch before.Type {
+	case TypeGroup:
+		diffGroups(path, before, after, opts, changes)
+	case TypeArray:
+		diffSequences(path, before, after, before.ArrayVal, after.ArrayVal, opts, changes)
+	case TypeList:
+		diffSequences(path, before, after, before.ListVal, after.ListVal, opts, changes)
+	default:
+		if !scalarsEqual(before, after, opts) {
+			*changes = append(*changes, Change{Path: path, Old: before, New: after})
+		}
+	}
+}
+
+// diffGroups appends the differences between the members of two groups.
+func diffGroups(path string, before, after *Value, opts EqualOptions, changes *[]Change) {
+	keys := make([]string, 0, len(before.GroupVal)+len(after.GroupVal))
+	for key := range before.GroupVal {
+		keys = append(keys, key)
+	}
+
+	for key := range after.GroupVal {
+		if _, ok := before.GroupVal[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		beforeMember, inBefore := before.GroupVal[key]
+		afterMember, inAfter := after.GroupVal[key]
+
+		switch {
+		case !inBefore:
+			*changes = append(*changes, Change{Path: joinPath(path, key), New: &afterMember})
+		case !inAfter:
+			*changes = append(*changes, Change{Path: joinPath(path, key), Old: &beforeMember})
+		default:
+			diffValues(joinPath(path, key), &beforeMember, &afterMember, opts, changes)
+		}
+	}
+}
+
+// diffSequences appends the differences between two arrays or lists,
+// element by element when they have the same length.
+func diffSequences(path string, before, after *Value, beforeElements, afterElements []Value, opts EqualOptions, changes *[]Change) {
+	if len(beforeElements) != len(afterElements) {
+		*changes = append(*changes, Change{Path: path, Old: before, New: after})
+		return
+	}
+
+	for i := range beforeElements {
+		// Changes hold copies, like the values returned by Lookup
+		beforeElement, afterElement := beforeElements[i], afterElements[i]
+		diffValues(fmt.Sprintf("%s[%d]", path, i), &beforeElement, &afterElement, opts, changes)
+	}
+}
+
+// scalarsEqual reports whether two scalars of the same type are equal.
+func scalarsEqual(a, b *Value, opts EqualOptions) bool {
+	switch a.Type {
+	case TypeInt:
+		return a.IntVal == b.IntVal
+	case TypeInt64:
+		return a.Int64Val == b.Int64Val
+	case TypeFloat:
+		if a.FloatVal == b.FloatVal || (math.IsNaN(a.FloatVal) && math.IsNaN(b.FloatVal)) {
+			return true
+		}
+
+		return math.Abs(a.FloatVal-b.FloatVal) <= opts.FloatEpsilon
+	case TypeBool:
+		return a.BoolVal == b.BoolVal
+	case TypeString:
+		return a.StrVal == b.StrVal
+	default:
+		return true
+	}
+}
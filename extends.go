@@ -0,0 +1,186 @@
+package libconfig
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Predefined inheritance errors for better error handling and testing.
+var (
+	ErrInvalidExtends = errors.New("invalid extends")
+	ErrExtendsCycle   = errors.New("extends cycle")
+)
+
+// extendsKey and extendsAltKey are the group members naming the group to
+// inherit from. The @ form is only lexed with Options.Extends; the _ form is
+// an ordinary setting name.
+const (
+	extendsKey    = "@extends"
+	extendsAltKey = "_extends"
+)
+
+// extendsState tracks the resolution of one group path.
+type extendsState int
+
+const (
+	extendsPending extendsState = iota
+	extendsResolving
+	extendsDone
+)
+
+// ResolveExtends applies group inheritance. A group with an @extends or
+// _extends member naming another group by path, such as
+// web2 = { @extends = "web1"; port = 8081; };, receives a deep copy of that
+// group's members, over which its own members are deep-merged, so its own
+// members win. The extends member is removed. Inherited groups are resolved
+// first, so chains of inheritance work; a cycle returns ErrExtendsCycle, and
+// an extends member that is not a string naming a group returns
+// ErrInvalidExtends. Only groups reachable by a lookup path take part, not
+// groups inside arrays or lists.
+//
+// Parsing with Options.Extends calls ResolveExtends automatically.
+func (c *Config) ResolveExtends() error {
+	if c.frozen {
+		return fmt.Errorf("cannot resolve extends: %w", ErrConfigFrozen)
+	}
+
+	if c.Root.Type != TypeGroup {
+		return nil
+	}
+
+	r := &extendsResolver{config: c, state: make(map[string]extendsState)}
+
+	for _, key := range c.Root.MemberKeys() {
+		if c.Root.GroupVal[key].Type != TypeGroup {
+			continue
+		}
+
+		if err := r.resolve(EscapeKey(key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extendsResolver resolves inheritance group by group, tracking which paths
+// are in progress to detect cycles.
+type extendsResolver struct {
+	config *Config
+	state  map[string]extendsState
+}
+
+// resolve applies inheritance to the group at path and then to the groups
+// nested in it.
+func (r *extendsResolver) resolve(path string) error {
+	switch r.state[path] {
+	case extendsDone:
+		return nil
+	case extendsResolving:
+		return fmt.Errorf("group '%s': %w", path, ErrExtendsCycle)
+	default:
+	}
+
+	r.state[path] = extendsResolving
+
+	group, err := r.config.Lookup(path)
+	if err != nil {
+		return err
+	}
+
+	if err := r.inherit(path, group); err != nil {
+		return err
+	}
+
+	for _, key := range group.MemberKeys() {
+		if group.GroupVal[key].Type != TypeGroup {
+			continue
+		}
+
+		if err := r.resolve(joinPath(path, key)); err != nil {
+			return err
+		}
+	}
+
+	r.state[path] = extendsDone
+
+	return nil
+}
+
+// inherit merges the base named by group's extends member beneath its own
+// members and stores the result at path. group is updated to match.
+func (r *extendsResolver) inherit(path string, group *Value) error {
+	key := extendsKey
+
+	ref, ok := group.GroupVal[key]
+	if !ok {
+		key = extendsAltKey
+		if ref, ok = group.GroupVal[key]; !ok {
+			return nil
+		}
+	}
+
+	if ref.Type != TypeString {
+		return fmt.Errorf("%s in '%s' at line %d is a %s, not a path: %w", key, path, ref.Pos.Line, ref.Type, ErrInvalidExtends)
+	}
+
+	if err := r.resolve(canonicalPath(ref.StrVal)); err != nil {
+		return fmt.Errorf("group '%s' extends '%s': %w", path, ref.StrVal, err)
+	}
+
+	base, err := r.config.Lookup(ref.StrVal)
+	if err != nil {
+		return fmt.Errorf("group '%s' extends '%s': %w", path, ref.StrVal, err)
+	}
+
+	if base.Type != TypeGroup {
+		return fmt.Errorf("group '%s' extends '%s', which is a %s: %w", path, ref.StrVal, base.Type, ErrInvalidExtends)
+	}
+
+	own := cloneValue(*group)
+	delete(own.GroupVal, key)
+	own.Keys = slices.DeleteFunc(own.Keys, func(k string) bool { return k == key })
+
+	merged := cloneValue(*base)
+	mergeValues(&merged, own)
+	merged.Pos = group.Pos
+	merged.Span = group.Span
+	merged.TrailingComments = group.TrailingComments
+
+	*group = merged
+	r.config.store(path, merged)
+
+	return nil
+}
+
+// canonicalPath rewrites a lookup path without empty components, so that
+// equivalent paths such as "a.b" and ".a.b" track the same group.
+func canonicalPath(path string) string {
+	var canonical string
+
+	for _, part := range Compile(path).parts {
+		canonical = joinPath(canonical, part)
+	}
+
+	return canonical
+}
+
+// store replaces the existing value at path.
+func (c *Config) store(path string, val Value) {
+	parts := Compile(path).parts
+	if len(parts) == 0 {
+		c.Root = val
+		return
+	}
+
+	last := len(parts) - 1
+
+	parent, err := c.lookupParts(parts[:last])
+	if err != nil {
+		return
+	}
+
+	// The copy returned by Lookup shares its member map with the tree
+	parent.GroupVal[parts[last]] = val
+}
@@ -0,0 +1,95 @@
+package libconfig
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Hash returns a 64-bit FNV-1a checksum of the configuration's value tree.
+// Group members are hashed in sorted key order and source positions are
+// ignored, so two configurations with the same settings hash equally
+// regardless of declaration order, formatting or comments. The result is
+// stable across runs and platforms and is suitable for detecting whether a
+// reloaded configuration changed.
+func (c *Config) Hash() uint64 {
+	h := fnv.New64a()
+	hashValue(h, &c.Root)
+
+	return h.Sum64()
+}
+
+// hashValue writes a type-tagged encoding of v to h.
+func hashValue(h hash.Hash64, v *Value) {
+	var buf [9]byte
+
+	buf[0] = byte(v.Type)
+
+	switch v.Type {
+	case TypeInt:
+		binary.LittleEndian.PutUint64(buf[1:], uint64(v.IntVal))
+		h.Write(buf[:])
+	case TypeInt64:
+		binary.LittleEndian.PutUint64(buf[1:], uint64(v.Int64Val))
+		h.Write(buf[:])
+	case TypeFloat:
+		binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(v.FloatVal))
+		h.Write(buf[:])
+	case TypeBool:
+		if v.BoolVal {
+			buf[1] = 1
+		}
+
+		h.Write(buf[:2])
+	case TypeString:
+		h.Write(buf[:1])
+		hashString(h, v.StrVal)
+	case TypeArray:
+		hashValues(h, buf[0], v.ArrayVal)
+	case TypeList:
+		hashValues(h, buf[0], v.ListVal)
+	case TypeGroup:
+		keys := make([]string, 0, len(v.GroupVal))
+		for key := range v.GroupVal {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		binary.LittleEndian.PutUint64(buf[1:], uint64(len(keys)))
+		h.Write(buf[:])
+
+		for _, key := range keys {
+			member := v.GroupVal[key]
+
+			hashString(h, key)
+			hashValue(h, &member)
+		}
+	default:
+		h.Write(buf[:1])
+	}
+}
+
+// hashValues writes a length-prefixed sequence of values to h.
+func hashValues(h hash.Hash64, tag byte, vals []Value) {
+	var buf [9]byte
+
+	buf[0] = tag
+	binary.LittleEndian.PutUint64(buf[1:], uint64(len(vals)))
+	h.Write(buf[:])
+
+	for i := range vals {
+		hashValue(h, &vals[i])
+	}
+}
+
+// hashString writes a length-prefixed string to h.
+func hashString(h hash.Hash64, s string) {
+	var buf [8]byte
+
+	binary.LittleEndian.PutUint64(buf[:], uint64(len(s)))
+	h.Write(buf[:])
+	h.Write([]byte(s))
+}
@@ -0,0 +1,283 @@
+package libconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrIncludeMismatch is returned by VerifyIncludes when the files a config
+// includes differ from the expected manifest.
+var ErrIncludeMismatch = errors.New("includes do not match manifest")
+
+// maxIncludeDepth limits how deeply include directives may nest.
+const maxIncludeDepth = 10
+
+// IncludeResolver locates and opens the sources named by @include
+// directives, so includes can be served from somewhere other than the local
+// filesystem. Set it with Options.IncludeResolver.
+type IncludeResolver interface {
+	// Resolve opens the include path as written in the directive, relative
+	// to baseDir, the directory of the including source. It returns the
+	// contents and the name of the included source; the name is recorded in
+	// value positions and its directory is the base for nested includes.
+	// Resolve should give up and return an error wrapping ctx.Err() once ctx
+	// is done, which happens after Options.IncludeTimeout.
+	Resolve(ctx context.Context, baseDir, path string) (io.ReadCloser, string, error)
+}
+
+// IncludeRecord describes an include directive followed while parsing with
+// Options.RecordIncludes.
+type IncludeRecord struct {
+	Directive string // Path as written in the directive
+	Resolved  string // Name of the source it resolved to
+	Line      int    // Line of the directive
+	File      string // File containing the directive, empty for the main input unless it is a file
+}
+
+// Includes returns the include directives followed while parsing the
+// configuration, in the order they were reached, with nested includes
+// following the directive that included their file. It is only recorded
+// with Options.RecordIncludes, and is nil otherwise.
+func (c *Config) Includes() []IncludeRecord {
+	return slices.Clone(c.includes)
+}
+
+// FileResolver resolves includes from the local filesystem, trying the .cnf
+// and .cfg extensions when the path does not exist as written. It is the
+// resolver used when Options.IncludeResolver is nil.
+type FileResolver struct{}
+
+// Resolve opens the file named by path relative to baseDir.
+func (FileResolver) Resolve(ctx context.Context, baseDir, path string) (io.ReadCloser, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", fmt.Errorf("include '%s': %w", path, err)
+	}
+
+	name, err := resolveIncludePath(baseDir, path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return file, name, nil
+}
+
+// resolveIncludePath resolves an include directive relative to baseDir and
+// returns the path of the file it refers to. The path is tried as written and
+// with the .cnf and .cfg extensions appended.
+//
+// Include paths are read without escape processing and both forward slashes
+// and backslashes are accepted as separators, so "sub/a.cfg", "sub\a.cfg"
+// and "sub\\a.cfg" all name the same file on every platform.
+func resolveIncludePath(baseDir, includePath string) (string, error) {
+	fullPath := filepath.Clean(filepath.FromSlash(strings.ReplaceAll(includePath, "\\", "/")))
+	if baseDir != "" {
+		fullPath = filepath.Join(baseDir, fullPath)
+	}
+
+	// Try common extensions if the file doesn't exist as-is
+	possiblePaths := []string{
+		fullPath,
+		fullPath + ".cnf",
+		fullPath + ".cfg",
+	}
+
+	for _, path := range possiblePaths {
+		if fileExists(path) {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("include file '%s' not found (tried: %v): %w", includePath, possiblePaths, ErrIncludeFileNotFound)
+}
+
+// CheckIncludes verifies that every @include directive in filename, and in the
+// files it includes, resolves to an existing file. Only the include
+// directives are inspected, so the rest of the file does not need to be
+// valid. It returns one error per problem found, each reporting the file and
+// position of the directive; a nil result means all includes resolve.
+func CheckIncludes(filename string) []error {
+	return checkIncludes(filename, 0)
+}
+
+// checkIncludes scans filename for include directives at the given depth.
+func checkIncludes(filename string, depth int) []error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return []error{fmt.Errorf("failed to open file: %w", err)}
+	}
+
+	lexer := NewLexer(file)
+	file.Close() // The lexer has consumed the whole file
+
+	if lexer.err != nil {
+		return []error{fmt.Errorf("%s: %w", filename, lexer.err)}
+	}
+
+	baseDir := filepath.Dir(filename)
+
+	var errs []error
+
+	for token := lexer.NextToken(); token.Type != TokenEOF; token = lexer.NextToken() {
+		if token.Type != TokenInclude {
+			continue
+		}
+
+		if depth >= maxIncludeDepth {
+			errs = append(errs, fmt.Errorf("%s:%d:%d: include depth limit exceeded (%d): %w",
+				filename, token.Line, token.Column, maxIncludeDepth, ErrIncludeDepthExceeded))
+
+			continue
+		}
+
+		pathToken := lexer.NextToken()
+		if pathToken.Type != TokenString {
+			errs = append(errs, fmt.Errorf("%s:%d:%d: expected string after @include: %w",
+				filename, token.Line, token.Column, ErrExpectedStringAfterInclude))
+
+			continue
+		}
+
+		resolved, err := resolveIncludePath(baseDir, pathToken.Value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d:%d: %w", filename, token.Line, token.Column, err))
+
+			continue
+		}
+
+		errs = append(errs, checkIncludes(resolved, depth+1)...)
+	}
+
+	return errs
+}
+
+// IncludedFiles returns the path of every file that filename includes,
+// directly or through other includes, in the order first included and
+// without duplicates. Like CheckIncludes it inspects only the include
+// directives, but it stops at the first directive that does not resolve.
+func IncludedFiles(filename string) ([]string, error) {
+	var files []string
+
+	if err := collectIncludes(filename, 0, make(map[string]bool), &files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// collectIncludes appends the files included by filename at the given depth
+// to files, skipping those already seen.
+func collectIncludes(filename string, depth int, seen map[string]bool, files *[]string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	lexer := NewLexer(file)
+	file.Close() // The lexer has consumed the whole file
+
+	if lexer.err != nil {
+		return fmt.Errorf("%s: %w", filename, lexer.err)
+	}
+
+	for token := lexer.NextToken(); token.Type != TokenEOF; token = lexer.NextToken() {
+		if token.Type != TokenInclude {
+			continue
+		}
+
+		if depth >= maxIncludeDepth {
+			return fmt.Errorf("%s:%d:%d: include depth limit exceeded (%d): %w",
+				filename, token.Line, token.Column, maxIncludeDepth, ErrIncludeDepthExceeded)
+		}
+
+		pathToken := lexer.NextToken()
+		if pathToken.Type != TokenString {
+			return fmt.Errorf("%s:%d:%d: expected string after @include: %w",
+				filename, token.Line, token.Column, ErrExpectedStringAfterInclude)
+		}
+
+		resolved, err := resolveIncludePath(filepath.Dir(filename), pathToken.Value)
+		if err != nil {
+			return fmt.Errorf("%s:%d:%d: %w", filename, token.Line, token.Column, err)
+		}
+
+		if seen[resolved] {
+			continue
+		}
+
+		seen[resolved] = true
+		*files = append(*files, resolved)
+
+		if err := collectIncludes(resolved, depth+1, seen, files); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VerifyIncludes checks that the files filename includes, directly or
+// indirectly, are exactly those in expected, so that fragments added to or
+// dropped from a deployment are caught. Expected paths are relative to the
+// directory of filename unless absolute, and their order does not matter.
+// A mismatch returns ErrIncludeMismatch listing the unexpected and missing
+// files relative to that directory.
+func VerifyIncludes(filename string, expected []string) error {
+	files, err := IncludedFiles(filename)
+	if err != nil {
+		return err
+	}
+
+	baseDir := filepath.Dir(filename)
+
+	want := make(map[string]bool, len(expected))
+	for _, name := range expected {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(baseDir, name)
+		}
+
+		want[filepath.Clean(name)] = true
+	}
+
+	var unexpected, missing []string
+
+	for _, file := range files {
+		if want[file] {
+			delete(want, file)
+			continue
+		}
+
+		unexpected = append(unexpected, relativeTo(baseDir, file))
+	}
+
+	for name := range want {
+		missing = append(missing, relativeTo(baseDir, name))
+	}
+
+	if len(unexpected) == 0 && len(missing) == 0 {
+		return nil
+	}
+
+	slices.Sort(missing)
+
+	return fmt.Errorf("%s: unexpected %v, missing %v: %w", filename, unexpected, missing, ErrIncludeMismatch)
+}
+
+// relativeTo returns path relative to dir when it can be expressed that way.
+func relativeTo(dir, path string) string {
+	if rel, err := filepath.Rel(dir, path); err == nil {
+		return rel
+	}
+
+	return path
+}
@@ -1,11 +1,21 @@
 package libconfig
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
+)
+
+// Predefined lexer errors for better error handling and testing.
+var (
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrInvalidEncoding    = errors.New("input is not valid UTF-8")
+	ErrCommentStyle       = errors.New("comment style not allowed")
+	ErrUnterminatedString = errors.New("unterminated string")
 )
 
 // TokenType represents different types of tokens.
@@ -29,14 +39,26 @@ const (
 	TokenRightParen   // )
 	TokenInclude      // @include
 	TokenError
+	TokenNull         // null, with Options.Nulls or a keyword hook
+	TokenComment      // Only in ParseLossless results
+	TokenWhitespace   // Only in ParseLossless results
+	TokenAppendAssign // +=, with Options.AppendAssign
+	TokenAnchor       // &name, with Options.Anchors
 )
 
 // Token represents a single token.
 type Token struct {
-	Value  string
-	Type   TokenType
-	Line   int
-	Column int
+	Value    string
+	Comments []string // Comments directly preceding the token, kept with Options.PreserveComments
+	Type     TokenType
+	Line     int
+	Column   int
+	Start    int // Byte offset of the token's first byte in the input
+	End      int // Byte offset just past the token's last byte
+
+	// LineComment is a comment following the token on the same line, kept
+	// with Options.PreserveComments when the token can end a setting.
+	LineComment string
 }
 
 // String returns a string representation of the token.
@@ -81,58 +103,139 @@ func (tt TokenType) String() string {
 		return "INCLUDE"
 	case TokenError:
 		return "ERROR"
+	case TokenNull:
+		return "NULL"
+	case TokenComment:
+		return "COMMENT"
+	case TokenWhitespace:
+		return "WHITESPACE"
+	case TokenAppendAssign:
+		return "APPEND_ASSIGN"
+	case TokenAnchor:
+		return "ANCHOR"
 	default:
 		return "UNKNOWN"
 	}
 }
 
-// Lexer tokenizes libconfig input.
+// Lexer tokenizes libconfig input. Tokens are lexed one at a time as they
+// are requested, so an error in the input is found once lexing reaches it.
 type Lexer struct {
-	tokens   []Token
-	input    string
-	pos      int
-	line     int
-	column   int
-	tokenPos int
-	current  rune
+	input      string
+	opts       Options
+	pos        int
+	line       int
+	column     int
+	base       int   // Bytes skipped before input, such as a byte order mark
+	width      int   // Size in bytes of the current character
+	err        error // Set when the input cannot be lexed at all
+	directives []directive
+	current    rune
+	prev       Token // Last token lexed
+	lookahead  Token // Token lexed by PeekToken and not yet returned
+	buffered   bool  // Whether lookahead holds a token
+	started    bool  // Whether a token has been lexed, ending the file header
+	done       bool  // Whether the TokenEOF token has been lexed
 }
 
 // NewLexer creates a new lexer for the given input.
 func NewLexer(reader io.Reader) *Lexer {
+	return NewLexerWithOptions(reader, Options{})
+}
+
+// NewLexerWithOptions creates a new lexer for the given input using the
+// lexical options in opts.
+func NewLexerWithOptions(reader io.Reader, opts Options) *Lexer {
 	// Read all input into memory for easier processing
 	buf := strings.Builder{}
 	if _, err := io.Copy(&buf, reader); err != nil {
 		// Handle error gracefully by creating an empty lexer
 		return &Lexer{
 			input:  "",
+			opts:   opts,
 			pos:    0,
 			line:   1,
 			column: 1,
-			tokens: []Token{{Value: "", Type: TokenEOF, Line: 1, Column: 1}},
 		}
 	}
 
-	input := buf.String()
+	return newStringLexer(buf.String(), opts)
+}
+
+// newStringLexer creates a lexer that tokenizes input in place, without
+// copying it. The first token is lexed up front, so that the directives in
+// the file header are known before parsing starts.
+func newStringLexer(input string, opts Options) *Lexer {
+	if err := checkEncoding(input); err != nil {
+		return &Lexer{
+			input:  "",
+			opts:   opts,
+			line:   1,
+			column: 1,
+			err:    err,
+		}
+	}
+
+	trimmed := strings.TrimPrefix(input, utf8BOM)
 	lexer := &Lexer{
-		input:  input,
+		input:  trimmed,
+		opts:   opts,
 		pos:    0,
 		line:   1,
 		column: 1,
+		base:   len(input) - len(trimmed),
 	}
 
+	input = trimmed
+
 	if len(input) > 0 {
-		lexer.current = rune(input[0])
+		lexer.current, lexer.width = utf8.DecodeRuneInString(input)
 	}
 
-	// Tokenize the entire input
-	lexer.tokenize()
+	lexer.PeekToken()
 
 	return lexer
 }
 
+// utf8BOM is the byte order mark some editors write at the start of UTF-8
+// files. It is skipped.
+const utf8BOM = "\uFEFF"
+
+// checkEncoding verifies that input is UTF-8, recognizing UTF-16 byte order
+// marks so that the error can say what the input looks like.
+func checkEncoding(input string) error {
+	if strings.HasPrefix(input, "\xFE\xFF") || strings.HasPrefix(input, "\xFF\xFE") {
+		return fmt.Errorf("input looks like UTF-16 (byte order mark % X), convert it to UTF-8: %w", input[:2], ErrInvalidEncoding)
+	}
+
+	if utf8.ValidString(input) {
+		return nil
+	}
+
+	line, column := 1, 1
+
+	for i, r := range input {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(input[i:]); size == 1 {
+				return fmt.Errorf("invalid UTF-8 byte 0x%02X at line %d, column %d: %w", input[i], line, column, ErrInvalidEncoding)
+			}
+		}
+
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return ErrInvalidEncoding
+}
+
 // advance moves to the next character.
 func (l *Lexer) advance() {
-	if l.pos >= len(l.input)-1 {
+	next := l.pos + l.width
+	if next >= len(l.input) {
 		l.current = 0 // EOF
 		return
 	}
@@ -144,27 +247,60 @@ func (l *Lexer) advance() {
 		l.column++
 	}
 
-	l.pos++
-	l.current = rune(l.input[l.pos])
+	l.pos = next
+	l.current, l.width = utf8.DecodeRuneInString(l.input[next:])
 }
 
 // peek returns the next character without advancing.
 func (l *Lexer) peek() rune {
-	if l.pos+1 >= len(l.input) {
+	next := l.pos + l.width
+	if next >= len(l.input) {
 		return 0
 	}
 
-	return rune(l.input[l.pos+1])
+	r, _ := utf8.DecodeRuneInString(l.input[next:])
+
+	return r
 }
 
 // skipWhitespace skips whitespace characters.
 func (l *Lexer) skipWhitespace() {
-	for unicode.IsSpace(l.current) {
+	for unicode.IsSpace(l.current) || l.atLineContinuation() {
 		l.advance()
 	}
 }
 
-// skipComment skips comments (C-style, C++-style, and script-style).
+// atLineContinuation reports whether the current character is a backslash
+// ending its line, which Options.LineContinuation skips like whitespace.
+func (l *Lexer) atLineContinuation() bool {
+	if !l.opts.LineContinuation || l.current != '\\' {
+		return false
+	}
+
+	rest := l.input[l.pos+l.width:]
+
+	return strings.HasPrefix(rest, "\n") || strings.HasPrefix(rest, "\r\n")
+}
+
+// commentStyle returns the style of the comment starting at the current
+// character, or 0 if none starts there.
+func (l *Lexer) commentStyle() CommentStyle {
+	switch {
+	case l.current == '#':
+		return CommentHash
+	case l.current == '/' && l.peek() == '/':
+		return CommentLine
+	case l.current == '/' && l.peek() == '*':
+		return CommentBlock
+	case l.opts.SQLComments && l.current == '-' && l.peek() == '-':
+		return CommentSQL
+	default:
+		return 0
+	}
+}
+
+// skipComment skips comments (C-style, C++-style, script-style, and
+// SQL-style when enabled).
 func (l *Lexer) skipComment() bool {
 	if l.current == '/' {
 		next := l.peek()
@@ -193,8 +329,8 @@ func (l *Lexer) skipComment() bool {
 
 			return true
 		}
-	} else if l.current == '#' {
-		// Script-style comment: skip to end of line
+	} else if l.current == '#' || (l.opts.SQLComments && l.current == '-' && l.peek() == '-') {
+		// Script-style or SQL-style comment: skip to end of line
 		for l.current != '\n' && l.current != 0 {
 			l.advance()
 		}
@@ -205,13 +341,14 @@ func (l *Lexer) skipComment() bool {
 	return false
 }
 
-// readString reads a quoted string with escape sequence support.
-func (l *Lexer) readString() string {
+// readString reads a quoted string with escape sequence support. It
+// reports false if the string is not closed before the end of its line.
+func (l *Lexer) readString() (string, bool) {
 	var result strings.Builder
 
 	l.advance() // skip opening quote
 
-	for l.current != '"' && l.current != 0 {
+	for l.current != '"' && l.current != 0 && l.current != '\n' {
 		if l.current == '\\' {
 			l.advance()
 
@@ -273,11 +410,51 @@ func (l *Lexer) readString() string {
 		l.advance()
 	}
 
-	if l.current == '"' {
-		l.advance() // skip closing quote
+	if l.current != '"' {
+		return result.String(), false
 	}
 
-	return result.String()
+	l.advance() // skip closing quote
+
+	return result.String(), true
+}
+
+// readRawString reads a quoted string without escape processing, so that
+// backslashes in include paths such as "sub\config.cfg" survive intact. It
+// reports false if the string is not closed before the end of its line.
+func (l *Lexer) readRawString() (string, bool) {
+	l.advance() // skip opening quote
+
+	if l.current == 0 {
+		return "", false
+	}
+
+	start := l.pos
+
+	for l.current != '"' && l.current != 0 && l.current != '\n' {
+		l.advance()
+	}
+
+	end := l.offset()
+
+	// The path is copied so that it never refers to the input, which
+	// ParseFileMmap unmaps after parsing
+	path := strings.Clone(l.input[start:end])
+
+	if l.current != '"' {
+		return path, false
+	}
+
+	l.advance() // skip closing quote
+
+	return path, true
+}
+
+// afterIncludeKeyword reports whether the previous token introduces an
+// include directive, whose path string is read raw.
+func (l *Lexer) afterIncludeKeyword() bool {
+	return l.started && (l.prev.Type == TokenInclude ||
+		(l.opts.BareInclude && l.prev.Type == TokenIdentifier && l.prev.Value == "include"))
 }
 
 // readIdentifier reads an identifier.
@@ -389,115 +566,368 @@ func (l *Lexer) readNumber() (TokenType, string) {
 	return tokenType, result.String()
 }
 
-// tokenize processes the entire input and creates tokens.
-func (l *Lexer) tokenize() {
-	for l.current != 0 {
-		startLine := l.line
-		startColumn := l.column
+// scan lexes the next token and the comments before it. At the end of the
+// input it returns a TokenEOF token carrying the comments after the last
+// token.
+func (l *Lexer) scan() Token {
+	var comments []string
+
+	for l.skipWhitespace(); l.current != 0; l.skipWhitespace() {
+		start, line, column := l.pos, l.line, l.column
 
-		l.skipWhitespace()
+		if !l.skipCheckedComment(line, column) {
+			token := l.scanToken()
+			token.Comments = comments
+			l.scanLineComment(&token)
 
-		if l.current == 0 {
-			break
+			return token
 		}
 
-		if l.skipComment() {
-			continue
+		if l.opts.PreserveComments {
+			comments = append(comments, l.commentText(start))
 		}
 
-		switch l.current {
-		case '=', ':':
-			l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenAssign, Line: startLine, Column: startColumn})
-			l.advance()
-		case ';':
-			l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenSemicolon, Line: startLine, Column: startColumn})
-			l.advance()
-		case ',':
-			l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenComma, Line: startLine, Column: startColumn})
-			l.advance()
-		case '{':
-			l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenLeftBrace, Line: startLine, Column: startColumn})
-			l.advance()
-		case '}':
-			l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenRightBrace, Line: startLine, Column: startColumn})
-			l.advance()
-		case '[':
-			l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenLeftBracket, Line: startLine, Column: startColumn})
-			l.advance()
-		case ']':
-			l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenRightBracket, Line: startLine, Column: startColumn})
-			l.advance()
-		case '(':
-			l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenLeftParen, Line: startLine, Column: startColumn})
-			l.advance()
-		case ')':
-			l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenRightParen, Line: startLine, Column: startColumn})
-			l.advance()
-		case '"':
-			value := l.readString()
-			l.tokens = append(l.tokens, Token{Value: value, Type: TokenString, Line: startLine, Column: startColumn})
-		case '@':
+		// Directives are only recognized in the file header
+		if !l.started {
+			l.scanDirective(l.commentText(start), line, column)
+		}
+	}
+
+	end := l.base + len(l.input)
+
+	return Token{Value: "", Comments: comments, Type: TokenEOF, Line: l.line, Column: l.column, Start: end, End: end}
+}
+
+// skipCheckedComment skips a comment starting at the current character,
+// recording ErrCommentStyle if its style is not allowed, and reports
+// whether there was one.
+func (l *Lexer) skipCheckedComment(line, column int) bool {
+	if style := l.commentStyle(); style != 0 && !l.opts.allowsComment(style) && l.err == nil {
+		l.err = fmt.Errorf("%s comment at line %d, column %d: %w", style, line, column, ErrCommentStyle)
+	}
+
+	return l.skipComment()
+}
+
+// scanLineComment stores a comment following token on the same line in its
+// LineComment, with Options.PreserveComments, when the token can end a
+// setting.
+func (l *Lexer) scanLineComment(token *Token) {
+	if !l.opts.PreserveComments || !token.endsSetting() {
+		return
+	}
+
+	for l.current == ' ' || l.current == '\t' {
+		l.advance()
+	}
+
+	if start := l.pos; l.skipCheckedComment(l.line, l.column) {
+		token.LineComment = l.commentText(start)
+	}
+}
+
+// scanToken lexes the token starting at the current character, which is
+// not whitespace or a comment. Text that forms no token is returned as a
+// TokenError token.
+func (l *Lexer) scanToken() Token {
+	var token Token
+
+	startLine := l.line
+	startColumn := l.column
+	startPos := l.pos
+
+	switch l.current {
+	case '=', ':':
+		token = Token{Value: string(l.current), Type: TokenAssign, Line: startLine, Column: startColumn}
+		l.advance()
+	case '+':
+		if l.opts.AppendAssign && l.peek() == '=' {
+			token = Token{Value: "+=", Type: TokenAppendAssign, Line: startLine, Column: startColumn}
 			l.advance()
+		} else {
+			token = Token{Value: "+", Type: TokenError, Line: startLine, Column: startColumn}
+		}
 
-			if l.current == 'i' {
-				ident := l.readIdentifier()
-				if ident == "include" {
-					l.tokens = append(l.tokens, Token{Value: "@include", Type: TokenInclude, Line: startLine, Column: startColumn})
-				} else {
-					l.tokens = append(l.tokens, Token{Value: "@" + ident, Type: TokenError, Line: startLine, Column: startColumn})
-				}
-			} else {
-				l.tokens = append(l.tokens, Token{Value: "@", Type: TokenError, Line: startLine, Column: startColumn})
-			}
-		default:
-			switch {
-			case unicode.IsDigit(l.current) || (l.current == '-' && unicode.IsDigit(l.peek())):
-				// Handle negative numbers
-				sign := ""
-				if l.current == '-' {
-					sign = "-"
+		l.advance()
+	case '&':
+		l.advance()
 
-					l.advance()
-				}
+		if l.opts.Anchors && (unicode.IsLetter(l.current) || l.current == '_') {
+			token = Token{Value: l.readIdentifier(), Type: TokenAnchor, Line: startLine, Column: startColumn}
+		} else {
+			token = Token{Value: "&", Type: TokenError, Line: startLine, Column: startColumn}
+		}
+	case ';':
+		token = Token{Value: string(l.current), Type: TokenSemicolon, Line: startLine, Column: startColumn}
+		l.advance()
+	case ',':
+		token = Token{Value: string(l.current), Type: TokenComma, Line: startLine, Column: startColumn}
+		l.advance()
+	case '{':
+		token = Token{Value: string(l.current), Type: TokenLeftBrace, Line: startLine, Column: startColumn}
+		l.advance()
+	case '}':
+		token = Token{Value: string(l.current), Type: TokenRightBrace, Line: startLine, Column: startColumn}
+		l.advance()
+	case '[':
+		token = Token{Value: string(l.current), Type: TokenLeftBracket, Line: startLine, Column: startColumn}
+		l.advance()
+	case ']':
+		token = Token{Value: string(l.current), Type: TokenRightBracket, Line: startLine, Column: startColumn}
+		l.advance()
+	case '(':
+		token = Token{Value: string(l.current), Type: TokenLeftParen, Line: startLine, Column: startColumn}
+		l.advance()
+	case ')':
+		token = Token{Value: string(l.current), Type: TokenRightParen, Line: startLine, Column: startColumn}
+		l.advance()
+	case '"':
+		var (
+			value  string
+			closed bool
+		)
+
+		if l.afterIncludeKeyword() {
+			value, closed = l.readRawString()
+		} else {
+			value, closed = l.readString()
+		}
 
-				tokenType, value := l.readNumber()
-				l.tokens = append(l.tokens, Token{Value: sign + value, Type: tokenType, Line: startLine, Column: startColumn})
-			case unicode.IsLetter(l.current) || l.current == '_' || l.current == '*':
-				ident := l.readIdentifier()
-				// Check for boolean values
-				lower := strings.ToLower(ident)
-				if lower == "true" || lower == "false" {
-					l.tokens = append(l.tokens, Token{Value: lower, Type: TokenBoolean, Line: startLine, Column: startColumn})
-				} else {
-					l.tokens = append(l.tokens, Token{Value: ident, Type: TokenIdentifier, Line: startLine, Column: startColumn})
-				}
+		if closed {
+			token = Token{Value: value, Type: TokenString, Line: startLine, Column: startColumn}
+		} else {
+			// The value keeps the opening quote, which marks the error
+			// as an unterminated string for the parser
+			token = Token{Value: `"` + value, Type: TokenError, Line: startLine, Column: startColumn}
+		}
+	case '@':
+		l.advance()
+
+		if l.current == 'i' || (l.opts.Extends && l.current == 'e') {
+			ident := l.readIdentifier()
+
+			switch {
+			case ident == "include":
+				token = Token{Value: "@include", Type: TokenInclude, Line: startLine, Column: startColumn}
+			case ident == "extends" && l.opts.Extends:
+				token = Token{Value: extendsKey, Type: TokenIdentifier, Line: startLine, Column: startColumn}
 			default:
-				l.tokens = append(l.tokens, Token{Value: string(l.current), Type: TokenError, Line: startLine, Column: startColumn})
+				token = Token{Value: "@" + ident, Type: TokenError, Line: startLine, Column: startColumn}
+			}
+		} else {
+			token = Token{Value: "@", Type: TokenError, Line: startLine, Column: startColumn}
+		}
+	default:
+		switch {
+		case unicode.IsDigit(l.current) || (l.current == '-' && unicode.IsDigit(l.peek())):
+			// Handle negative numbers
+			sign := ""
+			if l.current == '-' {
+				sign = "-"
+
 				l.advance()
 			}
+
+			tokenType, value := l.readNumber()
+			token = Token{Value: sign + value, Type: tokenType, Line: startLine, Column: startColumn}
+		case unicode.IsLetter(l.current) || l.current == '_' || l.current == '*':
+			tokenType, value := l.classify(l.readIdentifier())
+			token = Token{Value: value, Type: tokenType, Line: startLine, Column: startColumn}
+		default:
+			token = Token{Value: string(l.current), Type: TokenError, Line: startLine, Column: startColumn}
+			l.advance()
 		}
 	}
 
-	l.tokens = append(l.tokens, Token{Value: "", Type: TokenEOF, Line: l.line, Column: l.column})
+	token.Start = l.base + startPos
+	token.End = l.base + l.offset()
+
+	return token
 }
 
-// NextToken returns the next token.
-func (l *Lexer) NextToken() Token {
-	if l.tokenPos >= len(l.tokens) {
-		return Token{Value: "", Type: TokenEOF, Line: l.line, Column: l.column}
+// endsSetting reports whether the token can be the last one of a setting,
+// so that a comment after it on the same line belongs to that setting.
+func (t *Token) endsSetting() bool {
+	switch t.Type {
+	case TokenSemicolon, TokenRightBrace, TokenRightBracket, TokenRightParen,
+		TokenString, TokenInteger, TokenFloat, TokenBoolean, TokenNull:
+		return true
+	default:
+		return false
 	}
+}
 
-	token := l.tokens[l.tokenPos]
-	l.tokenPos++
+// classify returns the token type and value of a bare identifier. The
+// Options.Keywords hook is consulted first; identifiers it does not
+// recognize are classified by defaultKeyword. Booleans are returned as
+// "true" or "false", nulls lower-cased and other identifiers as written.
+func (l *Lexer) classify(ident string) (TokenType, string) {
+	keyword, ok := Keyword{}, false
 
-	return token
+	if l.opts.Keywords != nil {
+		keyword, ok = l.opts.Keywords(ident)
+	}
+
+	if !ok {
+		keyword = defaultKeyword(ident, l.opts)
+	}
+
+	switch keyword.Type {
+	case TokenIdentifier:
+		return TokenIdentifier, ident
+	case TokenBoolean:
+		return TokenBoolean, strconv.FormatBool(keyword.Bool)
+	default:
+		return keyword.Type, strings.ToLower(ident)
+	}
+}
+
+// defaultKeyword classifies true and false as booleans, and null as null
+// with Options.Nulls, ignoring case.
+func defaultKeyword(ident string, opts Options) Keyword {
+	switch {
+	case strings.EqualFold(ident, "true"):
+		return Keyword{Type: TokenBoolean, Bool: true}
+	case strings.EqualFold(ident, "false"):
+		return Keyword{Type: TokenBoolean}
+	case opts.Nulls && strings.EqualFold(ident, "null"):
+		return Keyword{Type: TokenNull}
+	default:
+		return Keyword{Type: TokenIdentifier}
+	}
+}
+
+// Keyword is how Options.Keywords classifies a bare identifier.
+type Keyword struct {
+	Type TokenType // TokenBoolean, TokenNull or TokenIdentifier
+	Bool bool      // The value of a TokenBoolean keyword
+}
+
+// KeywordMap is a keyword set for Options.Keywords, mapping lower-case
+// identifiers to their classification, for example
+//
+//	KeywordMap{
+//		"yes":  {Type: TokenBoolean, Bool: true},
+//		"no":   {Type: TokenBoolean},
+//		"none": {Type: TokenNull},
+//	}
+type KeywordMap map[string]Keyword
+
+// Classify looks up ident case-insensitively. It has the signature of
+// Options.Keywords.
+func (m KeywordMap) Classify(ident string) (Keyword, bool) {
+	keyword, ok := m[strings.ToLower(ident)]
+	return keyword, ok
+}
+
+// offset returns the byte offset of the current character, or the length
+// of the input once it has all been consumed.
+func (l *Lexer) offset() int {
+	if l.current == 0 {
+		return len(l.input)
+	}
+
+	return l.pos
+}
+
+// directivePrefix introduces a directive comment such as # libconfig:strict.
+const directivePrefix = "libconfig:"
+
+// directive is a directive comment found in a file header.
+type directive struct {
+	name   string
+	line   int
+	column int
+}
+
+// scanDirective records comment as a directive if it has the form
+// "libconfig:name" after its comment markers.
+func (l *Lexer) scanDirective(comment string, line, column int) {
+	text := strings.TrimSuffix(comment, "*/")
+	text = strings.TrimSpace(strings.TrimLeft(text, "#/*-"))
+
+	if name, ok := strings.CutPrefix(text, directivePrefix); ok {
+		l.directives = append(l.directives, directive{name: strings.TrimSpace(name), line: line, column: column})
+	}
+}
+
+// commentText returns the text of the comment that started at input offset
+// start and has just been skipped, without trailing whitespace.
+func (l *Lexer) commentText(start int) string {
+	return strings.TrimRightFunc(l.input[start:l.offset()], unicode.IsSpace)
+}
+
+// Tokenize runs the lexer over input and returns its complete token stream,
+// ending with a TokenEOF token, for tools such as syntax highlighters and
+// formatters. Comments and whitespace are not tokens.
+//
+// Text that does not form a valid token, such as a stray character, is
+// returned in place as a TokenError token and lexing continues, so the
+// stream always covers the whole input. When any TokenError token is
+// present, the error reports the first one and wraps ErrInvalidToken.
+// Input that is not valid UTF-8 returns no tokens and ErrInvalidEncoding.
+func Tokenize(input string) ([]Token, error) {
+	lexer := NewLexer(strings.NewReader(input))
+	if lexer.err != nil {
+		return nil, lexer.err
+	}
+
+	tokens := lexer.drain()
+
+	for _, token := range tokens {
+		if token.Type == TokenError {
+			return tokens, fmt.Errorf("%q at line %d, column %d: %w", token.Value, token.Line, token.Column, ErrInvalidToken)
+		}
+	}
+
+	return tokens, nil
+}
+
+// NextToken returns the next token. Once the input is exhausted it keeps
+// returning TokenEOF tokens.
+func (l *Lexer) NextToken() Token {
+	if l.buffered {
+		l.buffered = false
+		return l.lookahead
+	}
+
+	return l.next()
 }
 
 // PeekToken returns the next token without consuming it.
 func (l *Lexer) PeekToken() Token {
-	if l.tokenPos >= len(l.tokens) {
+	if !l.buffered {
+		l.lookahead = l.next()
+		l.buffered = true
+	}
+
+	return l.lookahead
+}
+
+// next lexes the token after the last one lexed.
+func (l *Lexer) next() Token {
+	if l.done {
 		return Token{Value: "", Type: TokenEOF, Line: l.line, Column: l.column}
 	}
 
-	return l.tokens[l.tokenPos]
+	token := l.scan()
+	l.prev = token
+	l.started = true
+	l.done = token.Type == TokenEOF
+
+	return token
+}
+
+// drain returns the remaining tokens, ending with the TokenEOF token.
+func (l *Lexer) drain() []Token {
+	var tokens []Token
+
+	for {
+		token := l.NextToken()
+		tokens = append(tokens, token)
+
+		if token.Type == TokenEOF {
+			return tokens
+		}
+	}
 }
@@ -7,8 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"iter"
+	"math"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -25,6 +27,7 @@ const (
 	TypeArray
 	TypeGroup
 	TypeList
+	TypeNull
 )
 
 // String returns the string representation of the value type.
@@ -46,27 +49,69 @@ func (vt ValueType) String() string {
 		return "group"
 	case TypeList:
 		return "list"
+	case TypeNull:
+		return "null"
 	default:
 		return "unknown"
 	}
 }
 
+// Position identifies a location in libconfig source.
+type Position struct {
+	File   string // Empty when the source was not read from a file
+	Line   int
+	Column int
+}
+
+// String returns the position formatted as file:line:column, omitting the
+// file when it is unknown.
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Span is the byte range [Start, End) of a value's text in its source.
+type Span struct {
+	Start int
+	End   int
+}
+
 // Value represents a configuration value.
 type Value struct {
 	ArrayVal []Value
 	ListVal  []Value
 	StrVal   string
 	GroupVal map[string]Value
-	IntVal   int
-	Int64Val int64
-	FloatVal float64
-	Type     ValueType
-	BoolVal  bool
+	// Keys lists the names of a group's members in declaration order. It is
+	// maintained by the parser, Merge and Loader; use MemberKeys to read it.
+	Keys []string
+	// Comments holds the comments on the lines before a setting, and
+	// LineComment the comment after it on the same line, when parsed with
+	// Options.PreserveComments.
+	Comments    []string
+	LineComment string
+	// TrailingComments holds the comments after the last member of a
+	// group, when parsed with Options.PreserveComments.
+	TrailingComments []string
+	Pos              Position // Where the value was defined; zero for constructed values
+	Span             Span     // Byte range of the value's text, recorded with Options.TrackSpans
+	IntVal           int
+	Radix            int // Base an integer is written in: 2, 8 or 16; zero means decimal
+	Int64Val         int64
+	FloatVal         float64
+	FloatText        string // Float as written in the source, kept for round-trips; empty for constructed values
+	Type             ValueType
+	BoolVal          bool
 }
 
 // Config represents a libconfig configuration.
 type Config struct {
-	Root Value
+	Root     Value
+	frozen   bool
+	includes []IncludeRecord // Recorded with Options.RecordIncludes
 }
 
 // NewConfig creates a new empty configuration.
@@ -79,40 +124,401 @@ func NewConfig() *Config {
 	}
 }
 
-// ParseFile parses a libconfig file.
-func ParseFile(filename string) (*Config, error) {
-	file, err := os.Open(filename)
+// Freeze marks the configuration as read-only. Methods that modify the
+// configuration return ErrConfigFrozen once it is frozen. A frozen config is
+// safe for concurrent use by multiple goroutines calling Lookup and the typed
+// lookup methods, provided Freeze is called before the config is shared and
+// Root is not modified directly.
+func (c *Config) Freeze() {
+	c.frozen = true
+}
+
+// Frozen reports whether Freeze has been called on the configuration.
+func (c *Config) Frozen() bool {
+	return c.frozen
+}
+
+// Unwrap replaces the root of the configuration with the group at path, so
+// that a file wrapping all of its settings in one named group, such as
+// application = { ... };, can be looked up without the prefix. A missing
+// path returns ErrSettingNotFound, a value that is not a group returns
+// ErrNotGroup, and a frozen configuration returns ErrConfigFrozen.
+func (c *Config) Unwrap(path string) error {
+	if c.frozen {
+		return fmt.Errorf("cannot unwrap: %w", ErrConfigFrozen)
+	}
+
+	val, err := c.Lookup(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return err
 	}
 
-	defer func() {
-		file.Close() // Ignore close errors after successful read
-	}()
+	if val.Type != TypeGroup {
+		return fmt.Errorf("value at '%s' is %s: %w", path, article(val.Type), ErrNotGroup)
+	}
 
-	lexer := NewLexer(file)
-	baseDir := filepath.Dir(filename)
-	parser := NewParserWithBaseDir(lexer, baseDir)
+	c.Root = *val
 
-	return parser.Parse()
+	return nil
 }
 
-// ParseString parses a libconfig string.
+// Set stores a copy of value at path, creating the groups on the way that
+// do not exist yet and replacing any existing value. A new setting is added
+// after the existing members of its group; a replaced setting keeps its
+// preserved comments unless value has its own. Every component of path must
+// be a plain setting name, such as port or max-conns; others, including
+// array indices such as [0], return ErrInvalidSettingName. A value on the
+// way that is not a group returns ErrCannotLookupInNonGroup, an empty path
+// returns ErrSettingNotFound, and a frozen configuration returns
+// ErrConfigFrozen.
+func (c *Config) Set(path string, value Value) error {
+	if c.frozen {
+		return fmt.Errorf("cannot set '%s': %w", path, ErrConfigFrozen)
+	}
+
+	parts := Compile(path).parts
+	if len(parts) == 0 {
+		return fmt.Errorf("cannot set '%s': %w", path, ErrSettingNotFound)
+	}
+
+	for _, part := range parts {
+		if !isIdentifier(part) {
+			return fmt.Errorf("cannot set '%s': '%s' is not a setting name: %w", path, part, ErrInvalidSettingName)
+		}
+	}
+
+	var scratch Value
+	if old, _, err := c.find(parts, &scratch); err == nil && value.Comments == nil && value.LineComment == "" {
+		value.Comments, value.LineComment = old.Comments, old.LineComment
+	}
+
+	if err := setPath(&c.Root, parts, cloneValue(value)); err != nil {
+		return fmt.Errorf("setting '%s': %w", path, err)
+	}
+
+	return nil
+}
+
+// ParseFile parses a libconfig file.
+func ParseFile(filename string) (*Config, error) {
+	return ParseFileWithOptions(filename, Options{})
+}
+
+// ParseFileWithOptions parses a libconfig file using the given options.
+func ParseFileWithOptions(filename string, opts Options) (*Config, error) {
+	return parseFileWithDepth(filename, 0, opts)
+}
+
+// ParseString parses a libconfig string. Relative @include paths are
+// resolved against the process working directory; use ParseStringWithOptions
+// with Options.BaseDir to resolve them against another directory.
 func ParseString(input string) (*Config, error) {
 	return Parse(strings.NewReader(input))
 }
 
-// Parse parses libconfig data from a reader.
-func Parse(reader io.Reader) (*Config, error) {
+// ParseStringWithOptions parses a libconfig string using the given options.
+func ParseStringWithOptions(input string, opts Options) (*Config, error) {
+	return ParseWithOptions(strings.NewReader(input), opts)
+}
+
+// ParseBytes parses libconfig data held in memory. It behaves like
+// ParseString(string(data)) but copies data only once, rather than once for
+// the conversion and again when reading it into the lexer.
+func ParseBytes(data []byte) (*Config, error) {
+	return ParseBytesWithOptions(data, Options{})
+}
+
+// ParseBytesWithOptions parses libconfig data held in memory using the given
+// options.
+func ParseBytesWithOptions(data []byte, opts Options) (*Config, error) {
+	// The lexer keeps slices of its input in tokens and settings, so the
+	// string must not share memory with data, which the caller may reuse
+	lexer := newStringLexer(string(data), opts)
+	parser := NewParserWithOptions(lexer, opts)
+
+	return parser.Parse()
+}
+
+// ParseValue parses input holding a single value, such as 42, "text",
+// [ 1, 2 ] or { a = 1; }, rather than a list of settings. A single trailing
+// semicolon is allowed; any other text after the value returns
+// ErrTrailingData with its position.
+func ParseValue(input string) (Value, error) {
+	lexer := newStringLexer(input, Options{})
+	if lexer.err != nil {
+		return Value{}, lexer.err
+	}
+
+	p := NewParser(lexer)
+
+	val, err := p.parseValue()
+	if err != nil {
+		return Value{}, err
+	}
+
+	if p.current.Type == TokenSemicolon {
+		p.advance()
+	}
+
+	if p.current.Type != TokenEOF {
+		return Value{}, fmt.Errorf("%s %q after value at line %d, column %d: %w",
+			p.current.Type, p.current.Value, p.current.Line, p.current.Column, ErrTrailingData)
+	}
+
+	return val, nil
+}
+
+// ParseUntil parses the top-level settings read from reader only until it
+// finds the setting named key, and returns its value, for quick checks of
+// settings near the start of large files. Text after that setting is not
+// parsed, so errors in it go unreported; the input is still read in full,
+// but only tokenized up to the setting. If key is set more than once, the
+// first value is returned. A key that is not found returns
+// ErrSettingNotFound, unless a parse error comes first.
+func ParseUntil(reader io.Reader, key string) (*Value, error) {
 	lexer := NewLexer(reader)
-	parser := NewParser(lexer)
+	if lexer.err != nil {
+		return nil, lexer.err
+	}
+
+	p := NewParser(lexer)
+	root := NewGroupValue(make(map[string]Value))
+
+	for p.current.Type != TokenEOF {
+		var err error
+
+		switch {
+		case p.current.Type == TokenSemicolon:
+			p.advance()
+			continue
+		case p.atInclude():
+			err = p.parseInclude(&root)
+		default:
+			var name string
+
+			if name, err = p.parseSetting(&root); err == nil && name != key {
+				err = p.endSetting(name)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if val, ok := root.GroupVal[key]; ok {
+			return &val, nil
+		}
+	}
+
+	return nil, fmt.Errorf("setting '%s': %w", key, ErrSettingNotFound)
+}
+
+// Parse parses libconfig data from a reader. Relative @include paths are
+// resolved against the process working directory; use ParseWithOptions with
+// Options.BaseDir to resolve them against another directory.
+func Parse(reader io.Reader) (*Config, error) {
+	return ParseWithOptions(reader, Options{})
+}
+
+// ParseWithOptions parses libconfig data from a reader using the given options.
+func ParseWithOptions(reader io.Reader, opts Options) (*Config, error) {
+	lexer := NewLexerWithOptions(reader, opts)
+	parser := NewParserWithOptions(lexer, opts)
 
 	return parser.Parse()
 }
 
 // Lookup finds a setting by path (dot-separated).
 func (c *Config) Lookup(path string) (*Value, error) {
-	parts := strings.Split(path, ".")
+	if isSingleKey(path) {
+		val, err := c.lookupKey(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return &val, nil
+	}
+
+	return c.lookupParts(splitPath(path))
+}
+
+// LookupFirst tries each path in order and returns the value of the first
+// one that resolves, for settings that have moved and are still accepted
+// under their old path. If none resolves, it returns an error wrapping
+// ErrSettingNotFound that lists the paths tried.
+func (c *Config) LookupFirst(paths ...string) (*Value, error) {
+	for _, path := range paths {
+		if val, err := c.Lookup(path); err == nil {
+			return val, nil
+		}
+	}
+
+	return nil, fmt.Errorf("none of '%s': %w", strings.Join(paths, "', '"), ErrSettingNotFound)
+}
+
+// MarkDeprecated reports whether the setting at oldPath, which has been
+// renamed to newPath, is present, and if so returns a warning telling the
+// user to move it, such as "setting 'db_host' at line 3 is deprecated, use
+// 'database.host' instead". The warning also notes when
+// newPath is set as well, since the old setting is then likely ignored.
+// Read the value with LookupFirst(newPath, oldPath) so that both keep
+// working during a migration.
+func (c *Config) MarkDeprecated(oldPath, newPath string) (found bool, warning string) {
+	old, err := c.Lookup(oldPath)
+	if err != nil {
+		return false, ""
+	}
+
+	warning = fmt.Sprintf("setting '%s' at line %d is deprecated, use '%s' instead", oldPath, old.Pos.Line, newPath)
+
+	if current, err := c.Lookup(newPath); err == nil {
+		warning += fmt.Sprintf(" ('%s' is also set, at line %d)", newPath, current.Pos.Line)
+	}
+
+	return true, warning
+}
+
+// LookupSlice looks up an array or list by path and returns its elements,
+// telling an absent setting from an empty one: an absent setting returns
+// false and no error, while x = []; returns a non-nil empty slice and true.
+// A setting that is not an array or list returns ErrNotSequence.
+func (c *Config) LookupSlice(path string) ([]Value, bool, error) {
+	val, err := c.lookup(path)
+	if errors.Is(err, ErrSettingNotFound) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	var elements []Value
+
+	switch val.Type {
+	case TypeArray:
+		elements = val.ArrayVal
+	case TypeList:
+		elements = val.ListVal
+	default:
+		return nil, true, fmt.Errorf("value at '%s': %w", path, ErrNotSequence)
+	}
+
+	if elements == nil {
+		elements = []Value{}
+	}
+
+	return elements, true, nil
+}
+
+// LookupListElem looks up an array or list by path and returns its element
+// i, as described for Value.At.
+func (c *Config) LookupListElem(path string, i int) (*Value, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	elem, err := val.At(i)
+	if err != nil {
+		return nil, fmt.Errorf("value at '%s': %w", path, err)
+	}
+
+	return elem, nil
+}
+
+// LookupKeyedMap looks up an array or list of groups by path, such as
+// services = ( { name = "a"; ... }, { name = "b"; ... } );, and returns its
+// groups keyed by the string value of their keyField member. An element that
+// is not a group returns ErrNotGroup, a group without keyField returns
+// ErrSettingNotFound, a keyField that is not a string returns ErrNotString,
+// and a key shared by two groups returns ErrDuplicateKey, each naming the
+// element's index.
+func (c *Config) LookupKeyedMap(path, keyField string) (map[string]*Value, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if val.Type != TypeArray && val.Type != TypeList {
+		return nil, fmt.Errorf("value at '%s': %w", path, ErrNotSequence)
+	}
+
+	result := make(map[string]*Value, len(val.ArrayVal)+len(val.ListVal))
+
+	for i, element := range val.Iter() {
+		if element.Type != TypeGroup {
+			return nil, fmt.Errorf("element %d of '%s' is %s: %w", i, path, article(element.Type), ErrNotGroup)
+		}
+
+		key, ok := element.GroupVal[keyField]
+		if !ok {
+			return nil, fmt.Errorf("element %d of '%s' has no '%s': %w", i, path, keyField, ErrSettingNotFound)
+		}
+
+		if key.Type != TypeString {
+			return nil, wrongType(fmt.Sprintf("%s[%d].%s", path, i, keyField), key.Type, "a string", ErrNotString)
+		}
+
+		if _, ok := result[key.StrVal]; ok {
+			return nil, fmt.Errorf("element %d of '%s' repeats %s %q: %w", i, path, keyField, key.StrVal, ErrDuplicateKey)
+		}
+
+		result[key.StrVal] = &element
+	}
+
+	return result, nil
+}
+
+// LookupCompiled finds a setting by a path prepared with Compile. It behaves
+// like Lookup without parsing the path again.
+func (c *Config) LookupCompiled(p Path) (*Value, error) {
+	return c.lookupParts(p.parts)
+}
+
+// lookupParts walks the groups named by parts from the root, skipping empty
+// components.
+func (c *Config) lookupParts(parts []string) (*Value, error) {
+	// Each level is copied into the same variable, so a lookup allocates
+	// once however deep the path is
+	var val Value
+
+	current, part, err := c.find(parts, &val)
+
+	switch {
+	case errors.Is(err, ErrCannotLookupInNonGroup):
+		return nil, fmt.Errorf("cannot lookup '%s': %w", part, err)
+	case err != nil:
+		return nil, fmt.Errorf("setting '%s': %w", part, err)
+	}
+
+	return current, nil
+}
+
+// Exists reports whether path resolves to a value of any type, including
+// groups, arrays and lists. It is false when a component of the path is
+// missing or a value on the way is not a group. Unlike Lookup it builds no
+// error, so it is cheap to call for settings that are usually absent.
+func (c *Config) Exists(path string) bool {
+	var val Value
+
+	if isSingleKey(path) {
+		parts := [1]string{path}
+		_, _, err := c.find(parts[:], &val)
+
+		return err == nil
+	}
+
+	_, _, err := c.find(splitPath(path), &val)
+
+	return err == nil
+}
+
+// find walks the groups named by parts from the root, skipping empty
+// components, and returns the value found, which is the root or a copy held
+// in scratch. On failure it returns the component that could not be
+// resolved and ErrCannotLookupInNonGroup or ErrSettingNotFound, unwrapped,
+// so that callers only pay for an error message when they want one.
+func (c *Config) find(parts []string, scratch *Value) (*Value, string, error) {
 	current := &c.Root
 
 	for _, part := range parts {
@@ -121,98 +527,766 @@ func (c *Config) Lookup(path string) (*Value, error) {
 		}
 
 		if current.Type != TypeGroup {
-			return nil, fmt.Errorf("cannot lookup '%s': %w", part, ErrCannotLookupInNonGroup)
+			return nil, part, ErrCannotLookupInNonGroup
 		}
 
-		val, exists := current.GroupVal[part]
+		next, exists := current.GroupVal[part]
 		if !exists {
-			return nil, fmt.Errorf("setting '%s': %w", part, ErrSettingNotFound)
+			return nil, part, ErrSettingNotFound
 		}
 
-		current = &val
+		*scratch = next
+		current = scratch
 	}
 
-	return current, nil
+	return current, "", nil
+}
+
+// lookup resolves a path to a copy of its value. Single-key paths are
+// resolved directly against the root group without splitting the path, so
+// the typed lookups do not allocate for the common top-level case.
+func (c *Config) lookup(path string) (Value, error) {
+	if isSingleKey(path) {
+		return c.lookupKey(path)
+	}
+
+	val, err := c.Lookup(path)
+	if err != nil {
+		return Value{}, err
+	}
+
+	return *val, nil
+}
+
+// lookupKey finds a top-level setting by its key.
+func (c *Config) lookupKey(key string) (Value, error) {
+	if c.Root.Type != TypeGroup {
+		return Value{}, fmt.Errorf("cannot lookup '%s': %w", key, ErrCannotLookupInNonGroup)
+	}
+
+	val, exists := c.Root.GroupVal[key]
+	if !exists {
+		return Value{}, fmt.Errorf("setting '%s': %w", key, ErrSettingNotFound)
+	}
+
+	return val, nil
+}
+
+// isSingleKey reports whether path names a top-level setting directly.
+func isSingleKey(path string) bool {
+	return path != "" && strings.IndexByte(path, '.') < 0 && strings.IndexByte(path, '\\') < 0
+}
+
+// Span returns the byte range of the text of the value at path in the
+// source it was parsed from, for rewriting a single value in place. For a
+// group, array or list the range runs from its opening to its closing
+// delimiter; for concatenated strings it covers all the parts. Values from
+// an included file have offsets into that file, named by Pos.File. Spans are
+// only recorded when parsing with Options.TrackSpans; otherwise Span returns
+// ErrNoSpan.
+func (c *Config) Span(path string) (start, end int, err error) {
+	val, err := c.Lookup(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if val.Span.End == 0 {
+		return 0, 0, fmt.Errorf("value at '%s': %w", path, ErrNoSpan)
+	}
+
+	return val.Span.Start, val.Span.End, nil
+}
+
+// Positions returns the source position of every setting in the
+// configuration, keyed by its dot-separated path. Group members are reported
+// recursively; elements of arrays and lists are not addressable by path and
+// are omitted. A setting's position is the position of its name.
+func (c *Config) Positions() map[string]Position {
+	positions := make(map[string]Position)
+	collectPositions(&c.Root, "", positions)
+
+	return positions
+}
+
+// Section is a top-level setting of a configuration, as listed by Sections.
+type Section struct {
+	Name  string
+	Type  ValueType
+	Value *Value
+}
+
+// Sections returns the top-level settings of the configuration in
+// declaration order with their types, as the entry point for browsing the
+// configuration as a tree. Each Value is a copy, as from Lookup.
+func (c *Config) Sections() []Section {
+	keys := c.Root.MemberKeys()
+	sections := make([]Section, 0, len(keys))
+
+	for _, key := range keys {
+		member := c.Root.GroupVal[key]
+		sections = append(sections, Section{Name: key, Type: member.Type, Value: &member})
+	}
+
+	return sections
+}
+
+// Depth returns how deeply groups, arrays and lists nest in the
+// configuration: 0 for only top-level scalars, 1 for a top-level group of
+// scalars, and one more for each collection inside another. It is the
+// smallest Options.MaxDepth that accepts the configuration.
+func (c *Config) Depth() int {
+	return max(c.Root.depth()-1, 0)
+}
+
+// depth returns the nesting depth of v, counting v itself if it is a
+// collection.
+func (v *Value) depth() int {
+	deepest := 0
+
+	switch v.Type {
+	case TypeGroup:
+		for _, member := range v.GroupVal {
+			deepest = max(deepest, member.depth())
+		}
+	case TypeArray, TypeList:
+		for _, element := range v.Iter() {
+			deepest = max(deepest, element.depth())
+		}
+	default:
+		return 0
+	}
+
+	return deepest + 1
+}
+
+// collectPositions records the positions of the members of group under prefix.
+func collectPositions(group *Value, prefix string, positions map[string]Position) {
+	if group.Type != TypeGroup {
+		return
+	}
+
+	for key, member := range group.GroupVal {
+		path := joinPath(prefix, key)
+		positions[path] = member.Pos
+		collectPositions(&member, path, positions)
+	}
 }
 
 // LookupInt looks up an integer value by path.
 func (c *Config) LookupInt(path string) (int, error) {
-	val, err := c.Lookup(path)
+	val, err := c.lookup(path)
 	if err != nil {
 		return 0, err
 	}
 
-	switch val.Type {
+	return val.asInt(path)
+}
+
+// asInt returns an integer value as an int, reporting path on failure.
+func (v *Value) asInt(path string) (int, error) {
+	switch v.Type {
 	case TypeInt:
-		return val.IntVal, nil
+		return v.IntVal, nil
 	case TypeInt64:
-		if val.Int64Val > int64(^uint(0)>>1) || val.Int64Val < int64(-1<<(64-1)) {
-			return 0, fmt.Errorf("int64 value %d: %w", val.Int64Val, ErrIntegerOutOfRange)
+		if v.Int64Val > int64(^uint(0)>>1) || v.Int64Val < int64(-1<<(64-1)) {
+			return 0, fmt.Errorf("int64 value %d: %w", v.Int64Val, ErrIntegerOutOfRange)
 		}
 
-		return int(val.Int64Val), nil
+		return int(v.Int64Val), nil
 	default:
-		return 0, fmt.Errorf("value at '%s': %w", path, ErrNotInteger)
+		return 0, wrongType(path, v.Type, "an integer", ErrNotInteger)
 	}
 }
 
 // LookupInt64 looks up a 64-bit integer value by path.
 func (c *Config) LookupInt64(path string) (int64, error) {
-	val, err := c.Lookup(path)
+	val, err := c.lookup(path)
 	if err != nil {
 		return 0, err
 	}
 
-	switch val.Type {
+	return val.asInt64(path)
+}
+
+// asInt64 returns an integer value as an int64, reporting path on failure.
+func (v *Value) asInt64(path string) (int64, error) {
+	switch v.Type {
 	case TypeInt:
-		return int64(val.IntVal), nil
+		return int64(v.IntVal), nil
 	case TypeInt64:
-		return val.Int64Val, nil
+		return v.Int64Val, nil
 	default:
-		return 0, fmt.Errorf("value at '%s': %w", path, ErrNotInteger)
+		return 0, wrongType(path, v.Type, "an integer", ErrNotInteger)
 	}
 }
 
-// LookupFloat looks up a float value by path.
-func (c *Config) LookupFloat(path string) (float64, error) {
-	val, err := c.Lookup(path)
+// LookupIntFromScientific looks up an integer by path, also accepting a
+// float with no fractional part, so that counts written as max = 1e6; read
+// as 1000000. A float with a fractional part returns ErrNotInteger and one
+// outside the int64 range returns ErrIntegerOutOfRange.
+func (c *Config) LookupIntFromScientific(path string) (int64, error) {
+	val, err := c.lookup(path)
 	if err != nil {
 		return 0, err
 	}
 
+	if n, ok := val.int64(); ok {
+		return n, nil
+	}
+
 	if val.Type != TypeFloat {
-		return 0, fmt.Errorf("value at '%s': %w", path, ErrNotFloat)
+		return 0, wrongType(path, val.Type, "an integer", ErrNotInteger)
+	}
+
+	f := val.FloatVal
+	if f != math.Trunc(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("float %v at '%s' is not a whole number: %w", f, path, ErrNotInteger)
+	}
+
+	// float64(math.MaxInt64) rounds up to 2^63, which is out of range
+	if f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, fmt.Errorf("float %v at '%s': %w", f, path, ErrIntegerOutOfRange)
 	}
 
-	return val.FloatVal, nil
+	return int64(f), nil
+}
+
+// LookupFloat looks up a float value by path. Integer settings return
+// ErrNotFloat rather than being converted, which could lose precision.
+func (c *Config) LookupFloat(path string) (float64, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return val.asFloat(path)
+}
+
+// asFloat returns a float value, reporting path on failure.
+func (v *Value) asFloat(path string) (float64, error) {
+	if v.Type != TypeFloat {
+		return 0, wrongType(path, v.Type, "a float", ErrNotFloat)
+	}
+
+	return v.FloatVal, nil
 }
 
 // LookupBool looks up a boolean value by path.
 func (c *Config) LookupBool(path string) (bool, error) {
-	val, err := c.Lookup(path)
+	val, err := c.lookup(path)
 	if err != nil {
 		return false, err
 	}
 
-	if val.Type != TypeBool {
-		return false, fmt.Errorf("value at '%s': %w", path, ErrNotBoolean)
+	return val.asBool(path)
+}
+
+// asBool returns a boolean value, reporting path on failure.
+func (v *Value) asBool(path string) (bool, error) {
+	if v.Type != TypeBool {
+		return false, wrongType(path, v.Type, "a boolean", ErrNotBoolean)
 	}
 
-	return val.BoolVal, nil
+	return v.BoolVal, nil
+}
+
+// LookupBoolSliceLenient looks up an array or list of booleans by path, for
+// configs from tools without native booleans. Each element may be a
+// boolean, the integer 0 or 1, or one of the strings "true", "false", "yes",
+// "no", "on", "off", "1" and "0" in any case. The first element that is none
+// of these returns ErrNotBoolean with its index.
+func (c *Config) LookupBoolSliceLenient(path string) ([]bool, error) {
+	return lookupSlice(c, path, (*Value).lenientBool)
+}
+
+// lenientBool converts a boolean, 0 or 1, or a boolean word to a bool.
+func (v *Value) lenientBool() (bool, error) {
+	if v.Type == TypeBool {
+		return v.BoolVal, nil
+	}
+
+	if n, ok := v.int64(); ok {
+		if n != 0 && n != 1 {
+			return false, fmt.Errorf("integer %d is not 0 or 1: %w", n, ErrNotBoolean)
+		}
+
+		return n == 1, nil
+	}
+
+	if v.Type != TypeString {
+		return false, fmt.Errorf("%s is not a boolean: %w", article(v.Type), ErrNotBoolean)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(v.StrVal)) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("%q is not a boolean: %w", v.StrVal, ErrNotBoolean)
+	}
 }
 
 // LookupString looks up a string value by path.
 func (c *Config) LookupString(path string) (string, error) {
-	val, err := c.Lookup(path)
+	val, err := c.lookup(path)
+	if err != nil {
+		return "", err
+	}
+
+	return val.asString(path)
+}
+
+// asString returns a string value, reporting path on failure.
+func (v *Value) asString(path string) (string, error) {
+	if v.Type != TypeString {
+		return "", wrongType(path, v.Type, "a string", ErrNotString)
+	}
+
+	return v.StrVal, nil
+}
+
+// LookupStringTrimmed looks up a string value by path and returns it with
+// leading and trailing whitespace removed, for values such as " MyApp "
+// whose padding is accidental. The stored value is not modified; use
+// LookupString where whitespace is significant.
+func (c *Config) LookupStringTrimmed(path string) (string, error) {
+	val, err := c.LookupString(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(val), nil
+}
+
+// LookupStringUnwrap looks up a string value by path like LookupString, but
+// also accepts an array or list holding exactly one string, as some
+// generators write name = ( "solo" );, and returns that element. Sequences
+// of any other length return ErrNotString.
+func (c *Config) LookupStringUnwrap(path string) (string, error) {
+	val, err := c.lookupUnwrapped(path)
+	if err != nil {
+		return "", err
+	}
+
+	return val.asString(path)
+}
+
+// LookupIntUnwrap is LookupInt accepting a one-element array or list, as
+// LookupStringUnwrap does.
+func (c *Config) LookupIntUnwrap(path string) (int, error) {
+	val, err := c.lookupUnwrapped(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return val.asInt(path)
+}
+
+// LookupInt64Unwrap is LookupInt64 accepting a one-element array or list,
+// as LookupStringUnwrap does.
+func (c *Config) LookupInt64Unwrap(path string) (int64, error) {
+	val, err := c.lookupUnwrapped(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return val.asInt64(path)
+}
+
+// LookupFloatUnwrap is LookupFloat accepting a one-element array or list,
+// as LookupStringUnwrap does.
+func (c *Config) LookupFloatUnwrap(path string) (float64, error) {
+	val, err := c.lookupUnwrapped(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return val.asFloat(path)
+}
+
+// LookupBoolUnwrap is LookupBool accepting a one-element array or list, as
+// LookupStringUnwrap does.
+func (c *Config) LookupBoolUnwrap(path string) (bool, error) {
+	val, err := c.lookupUnwrapped(path)
+	if err != nil {
+		return false, err
+	}
+
+	return val.asBool(path)
+}
+
+// lookupUnwrapped looks up a value by path and replaces an array or list
+// with exactly one element by that element.
+func (c *Config) lookupUnwrapped(path string) (Value, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if (val.Type == TypeArray || val.Type == TypeList) && len(val.ArrayVal)+len(val.ListVal) == 1 {
+		element, _ := val.At(0)
+		return *element, nil
+	}
+
+	return val, nil
+}
+
+// LookupStringDefault looks up a string value by path, returning def if
+// the setting is missing, a group on the way is missing or not a group, or
+// the value is not a string.
+func (c *Config) LookupStringDefault(path, def string) string {
+	if val, err := c.LookupString(path); err == nil {
+		return val
+	}
+
+	return def
+}
+
+// LookupIntDefault looks up an integer value by path like LookupInt,
+// returning def where LookupStringDefault would.
+func (c *Config) LookupIntDefault(path string, def int) int {
+	if val, err := c.LookupInt(path); err == nil {
+		return val
+	}
+
+	return def
+}
+
+// LookupInt64Default looks up a 64-bit integer value by path like
+// LookupInt64, returning def where LookupStringDefault would.
+func (c *Config) LookupInt64Default(path string, def int64) int64 {
+	if val, err := c.LookupInt64(path); err == nil {
+		return val
+	}
+
+	return def
+}
+
+// LookupFloatDefault looks up a float value by path like LookupFloat,
+// returning def where LookupStringDefault would.
+func (c *Config) LookupFloatDefault(path string, def float64) float64 {
+	if val, err := c.LookupFloat(path); err == nil {
+		return val
+	}
+
+	return def
+}
+
+// LookupBoolDefault looks up a boolean value by path like LookupBool,
+// returning def where LookupStringDefault would.
+func (c *Config) LookupBoolDefault(path string, def bool) bool {
+	if val, err := c.LookupBool(path); err == nil {
+		return val
+	}
+
+	return def
+}
+
+// LookupRegexp looks up a string value by path and compiles it with
+// regexp.Compile, so that patterns are checked when the configuration is
+// loaded. A pattern that does not compile returns ErrInvalidRegexp with its
+// line, the pattern and the compiler's message.
+func (c *Config) LookupRegexp(path string) (*regexp.Regexp, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern, err := val.asString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("value at '%s' on line %d is %q: %s: %w", path, val.Pos.Line, pattern, err.Error(), ErrInvalidRegexp)
+	}
+
+	return re, nil
+}
+
+// LookupStringIn looks up a string value by path and checks that it is one
+// of allowed, as for strategy = "round_robin";. A value outside the set
+// returns ErrValueNotAllowed listing the allowed values, and other types
+// return ErrNotString.
+func (c *Config) LookupStringIn(path string, allowed []string) (string, error) {
+	return c.lookupStringIn(path, allowed, func(a, b string) bool { return a == b })
+}
+
+// LookupStringInFold is LookupStringIn comparing without regard to case, so
+// that "Round_Robin" matches "round_robin". It returns the matching entry
+// of allowed, spelled as there.
+func (c *Config) LookupStringInFold(path string, allowed []string) (string, error) {
+	return c.lookupStringIn(path, allowed, strings.EqualFold)
+}
+
+// lookupStringIn looks up a string by path and returns the entry of allowed
+// that equal reports it matches.
+func (c *Config) lookupStringIn(path string, allowed []string, equal func(a, b string) bool) (string, error) {
+	val, err := c.LookupString(path)
 	if err != nil {
 		return "", err
 	}
 
-	if val.Type != TypeString {
-		return "", fmt.Errorf("value at '%s': %w", path, ErrNotString)
+	for _, candidate := range allowed {
+		if equal(val, candidate) {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("value at '%s' is %q, want one of %q: %w", path, val, allowed, ErrValueNotAllowed)
+}
+
+// LookupTransform looks up a value by path and converts it with fn, so that
+// a setting can be read into a custom type, or normalized, with one call:
+//
+//	level, err := libconfig.LookupTransform(config, "log.level", parseLevel)
+//
+// Go methods cannot have type parameters, so this is a function taking the
+// configuration. Errors from fn are returned wrapped with the path.
+func LookupTransform[T any](c *Config, path string, fn func(Value) (T, error)) (T, error) {
+	var zero T
+
+	val, err := c.lookup(path)
+	if err != nil {
+		return zero, err
+	}
+
+	result, err := fn(val)
+	if err != nil {
+		return zero, fmt.Errorf("value at '%s': %w", path, err)
+	}
+
+	return result, nil
+}
+
+// LookupTyped looks up a value by path and returns its type together with its
+// native Go representation. Scalars map to int, int64, float64, bool and
+// string; arrays and lists map to []any; groups map to map[string]any.
+func (c *Config) LookupTyped(path string) (ValueType, any, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	return val.StrVal, nil
+	return val.Type, val.native(), nil
+}
+
+// LookupFlags looks up an array or list of flag names by path and combines
+// them into a bit set, ORing together the value each name has in bits. For
+// example, flags = ( "READ", "WRITE" ); with bits {"READ": 1, "WRITE": 2}
+// yields 3. An empty sequence yields 0. Names are matched exactly; a name
+// missing from bits returns ErrUnknownFlag.
+func (c *Config) LookupFlags(path string, bits map[string]int) (int, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if val.Type != TypeArray && val.Type != TypeList {
+		return 0, fmt.Errorf("value at '%s': %w", path, ErrNotSequence)
+	}
+
+	flags := 0
+
+	for i, element := range val.Iter() {
+		if element.Type != TypeString {
+			return 0, fmt.Errorf("value at '%s[%d]': %w", path, i, ErrNotString)
+		}
+
+		bit, ok := bits[element.StrVal]
+		if !ok {
+			return 0, fmt.Errorf("flag '%s' at '%s[%d]': %w", element.StrVal, path, i, ErrUnknownFlag)
+		}
+
+		flags |= bit
+	}
+
+	return flags, nil
+}
+
+// SiblingTypes returns the type of every other member of the group that
+// would contain path, keyed by member name, to help editors suggest a type
+// for a setting. The setting at path itself need not exist and is left out
+// of the result, but its parent group must exist.
+func (c *Config) SiblingTypes(path string) (map[string]ValueType, error) {
+	parts := splitPath(path)
+	name := parts[len(parts)-1]
+
+	parentPath := ""
+	for _, part := range parts[:len(parts)-1] {
+		parentPath = joinPath(parentPath, part)
+	}
+
+	parent, err := c.Lookup(parentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if parent.Type != TypeGroup {
+		return nil, fmt.Errorf("parent of '%s': %w", path, ErrCannotLookupInNonGroup)
+	}
+
+	types := make(map[string]ValueType, len(parent.GroupVal))
+	for key, member := range parent.GroupVal {
+		if key != name {
+			types[key] = member.Type
+		}
+	}
+
+	return types, nil
+}
+
+// MemberKeys returns the names of a group's members in declaration order.
+// Members that are not listed in Keys, such as those added to GroupVal
+// directly, follow in sorted order. It returns nil for other types.
+func (v *Value) MemberKeys() []string {
+	if v.Type != TypeGroup {
+		return nil
+	}
+
+	keys := make([]string, 0, len(v.GroupVal))
+	seen := make(map[string]bool, len(v.GroupVal))
+
+	for _, key := range v.Keys {
+		if _, ok := v.GroupVal[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+
+	if len(keys) == len(v.GroupVal) {
+		return keys
+	}
+
+	rest := make([]string, 0, len(v.GroupVal)-len(keys))
+	for key := range v.GroupVal {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+
+	sort.Strings(rest)
+
+	return append(keys, rest...)
+}
+
+// setMember stores member under key in a group, recording the key's
+// declaration order when it is new.
+func (v *Value) setMember(key string, member Value) {
+	if v.GroupVal == nil {
+		v.GroupVal = make(map[string]Value)
+	}
+
+	if _, exists := v.GroupVal[key]; !exists {
+		v.Keys = append(v.Keys, key)
+	}
+
+	v.GroupVal[key] = member
+}
+
+// At returns element i of an array or list, such as the label of
+// coord = ( 1.5, 2.5, "label" ); at index 2. Other types return
+// ErrNotSequence and an index outside the sequence returns
+// ErrIndexOutOfRange.
+func (v Value) At(i int) (*Value, error) {
+	var elements []Value
+
+	switch v.Type {
+	case TypeArray:
+		elements = v.ArrayVal
+	case TypeList:
+		elements = v.ListVal
+	default:
+		return nil, fmt.Errorf("cannot index a %s: %w", v.Type, ErrNotSequence)
+	}
+
+	if i < 0 || i >= len(elements) {
+		return nil, fmt.Errorf("index %d of %s with %d elements: %w", i, v.Type, len(elements), ErrIndexOutOfRange)
+	}
+
+	return &elements[i], nil
+}
+
+// Iter returns an iterator over the elements of an array or list, yielding
+// each index and element without copying the underlying slice. For any other
+// type the iterator yields nothing.
+func (v Value) Iter() iter.Seq2[int, Value] {
+	var elements []Value
+
+	switch v.Type {
+	case TypeArray:
+		elements = v.ArrayVal
+	case TypeList:
+		elements = v.ListVal
+	default:
+	}
+
+	return func(yield func(int, Value) bool) {
+		for i, element := range elements {
+			if !yield(i, element) {
+				return
+			}
+		}
+	}
+}
+
+// native converts the value into plain Go types, recursing into collections.
+func (v *Value) native() any {
+	switch v.Type {
+	case TypeInt:
+		return v.IntVal
+	case TypeInt64:
+		return v.Int64Val
+	case TypeFloat:
+		return v.FloatVal
+	case TypeBool:
+		return v.BoolVal
+	case TypeString:
+		return v.StrVal
+	case TypeArray:
+		return nativeSlice(v.ArrayVal)
+	case TypeList:
+		return nativeSlice(v.ListVal)
+	case TypeGroup:
+		result := make(map[string]any, len(v.GroupVal))
+		for key, member := range v.GroupVal {
+			result[key] = member.native()
+		}
+
+		return result
+	default:
+		return nil
+	}
+}
+
+// nativeSlice converts a slice of values into a slice of plain Go values.
+func nativeSlice(vals []Value) []any {
+	result := make([]any, len(vals))
+	for i := range vals {
+		result[i] = vals[i].native()
+	}
+
+	return result
+}
+
+// wrongType returns the error for a typed lookup of path that found a value
+// of type got instead of the kind described by want, such as
+// "value at 'database' is a group, not a string", wrapping sentinel.
+func wrongType(path string, got ValueType, want string, sentinel error) error {
+	return fmt.Errorf("value at '%s' is %s, not %s: %w", path, article(got), want, sentinel)
+}
+
+// article returns the name of t with its indefinite article, such as
+// "a group" or "an array".
+func article(t ValueType) string {
+	name := t.String()
+	if strings.ContainsRune("aeiou", rune(name[0])) {
+		return "an " + name
+	}
+
+	return "a " + name
 }
 
 // Helper functions for creating values
@@ -237,6 +1311,11 @@ func NewBoolValue(val bool) Value {
 	return Value{Type: TypeBool, BoolVal: val}
 }
 
+// NewNullValue creates a new null value.
+func NewNullValue() Value {
+	return Value{Type: TypeNull}
+}
+
 // NewStringValue creates a new string value.
 func NewStringValue(val string) Value {
 	return Value{Type: TypeString, StrVal: val}
@@ -267,20 +1346,30 @@ func parseIntegerLiteral(s string) (Value, error) {
 	}
 
 	var (
-		val int64
-		err error
+		val   int64
+		err   error
+		radix = 10
 	)
 
+	// A leading minus applies to prefixed literals too, as in -0xFF
+	sign, digits := "", s
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+
 	switch {
-	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+	case strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X"):
 		// Hexadecimal
-		val, err = strconv.ParseInt(s[2:], 16, 64)
-	case strings.HasPrefix(s, "0b") || strings.HasPrefix(s, "0B"):
+		radix = 16
+		val, err = strconv.ParseInt(sign+digits[2:], 16, 64)
+	case strings.HasPrefix(digits, "0b") || strings.HasPrefix(digits, "0B"):
 		// Binary
-		val, err = strconv.ParseInt(s[2:], 2, 64)
-	case strings.HasPrefix(s, "0o") || strings.HasPrefix(s, "0O") || strings.HasPrefix(s, "0q") || strings.HasPrefix(s, "0Q"):
+		radix = 2
+		val, err = strconv.ParseInt(sign+digits[2:], 2, 64)
+	case strings.HasPrefix(digits, "0o") || strings.HasPrefix(digits, "0O") || strings.HasPrefix(digits, "0q") || strings.HasPrefix(digits, "0Q"):
 		// Octal (new format)
-		val, err = strconv.ParseInt(s[2:], 8, 64)
+		radix = 8
+		val, err = strconv.ParseInt(sign+digits[2:], 8, 64)
 	default:
 		// Decimal
 		val, err = strconv.ParseInt(s, 10, 64)
@@ -291,11 +1380,18 @@ func parseIntegerLiteral(s string) (Value, error) {
 	}
 
 	// Determine if we should return 32-bit or 64-bit based on value and suffix
+	var result Value
 	if isLong || val > int64(^uint(0)>>1) || val < int64(-1<<(64-1)) {
-		return NewInt64Value(val), nil
+		result = NewInt64Value(val)
+	} else {
+		result = NewIntValue(int(val))
+	}
+
+	if radix != 10 {
+		result.Radix = radix
 	}
 
-	return NewIntValue(int(val)), nil
+	return result, nil
 }
 
 // Predefined errors for better error handling and testing.
@@ -307,4 +1403,13 @@ var (
 	ErrNotBoolean             = errors.New("value is not a boolean")
 	ErrNotString              = errors.New("value is not a string")
 	ErrIntegerOutOfRange      = errors.New("integer value out of range")
+	ErrConfigFrozen           = errors.New("config is frozen")
+	ErrNotSequence            = errors.New("value is not an array or list")
+	ErrUnknownFlag            = errors.New("unknown flag")
+	ErrNoSpan                 = errors.New("no source span recorded")
+	ErrTrailingData           = errors.New("unexpected data after value")
+	ErrIndexOutOfRange        = errors.New("index out of range")
+	ErrInvalidRegexp          = errors.New("invalid regular expression")
+	ErrValueNotAllowed        = errors.New("value is not allowed")
+	ErrInvalidSettingName     = errors.New("invalid setting name")
 )
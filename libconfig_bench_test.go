@@ -2,6 +2,9 @@ package libconfig
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -396,3 +399,159 @@ func BenchmarkValueConstruction(b *testing.B) {
 		_ = NewListValue([]Value{NewStringValue("mixed"), NewIntValue(42)})
 	}
 }
+
+// BenchmarkLookupSingleKey benchmarks the single-key fast path, which should not allocate.
+func BenchmarkLookupSingleKey(b *testing.B) {
+	config, err := ParseString(`
+		name = "test";
+		port = 8080;
+	`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for b.Loop() {
+		_, err := config.LookupString("name")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_, err = config.LookupInt("port")
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkBytesConfig is a config held as bytes, as when read from a file
+// or network buffer.
+var benchmarkBytesConfig = func() []byte {
+	var settings []string
+	for i := 0; i < 500; i++ {
+		settings = append(settings, fmt.Sprintf(`setting_%d = "value %d";`, i, i))
+	}
+
+	return []byte(strings.Join(settings, "\n"))
+}()
+
+// BenchmarkParseBytes benchmarks parsing a byte slice directly.
+func BenchmarkParseBytes(b *testing.B) {
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for b.Loop() {
+		_, err := ParseBytes(benchmarkBytesConfig)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseStringFromBytes benchmarks converting a byte slice to a
+// string and parsing that, for comparison with BenchmarkParseBytes.
+func BenchmarkParseStringFromBytes(b *testing.B) {
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for b.Loop() {
+		_, err := ParseString(string(benchmarkBytesConfig))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLookupPath benchmarks looking up a nested path given as a string.
+func BenchmarkLookupPath(b *testing.B) {
+	config, err := ParseString(`app = { server = { ssl = { port = 8443; }; }; };`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for b.Loop() {
+		if _, err := config.Lookup("app.server.ssl.port"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkLookupCompiled benchmarks looking up the same nested path
+// compiled once, for comparison with BenchmarkLookupPath.
+func BenchmarkLookupCompiled(b *testing.B) {
+	config, err := ParseString(`app = { server = { ssl = { port = 8443; }; }; };`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	path := Compile("app.server.ssl.port")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for b.Loop() {
+		if _, err := config.LookupCompiled(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWriteLargeArray benchmarks serializing a large array, reporting
+// allocations to show that the output is streamed rather than built in
+// memory.
+func BenchmarkWriteLargeArray(b *testing.B) {
+	elements := make([]Value, 100_000)
+	for i := range elements {
+		elements[i] = NewIntValue(i)
+	}
+
+	config := NewConfig()
+	config.Root.setMember("large_array", NewArrayValue(elements))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for b.Loop() {
+		if err := config.Write(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseFileMmap compares the allocations of parsing a large file
+// read into the heap with parsing it memory-mapped.
+func BenchmarkParseFileMmap(b *testing.B) {
+	var sb strings.Builder
+
+	for i := range 20000 {
+		fmt.Fprintf(&sb, "# Setting %d\nsetting_%d = { name = \"value %d\"; enabled = true; };\n", i, i, i)
+	}
+
+	filename := filepath.Join(b.TempDir(), "large.cfg")
+	if err := os.WriteFile(filename, []byte(sb.String()), 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bm := range []struct {
+		name  string
+		parse func(string) (*Config, error)
+	}{
+		{"ParseFile", ParseFile},
+		{"ParseFileMmap", ParseFileMmap},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for b.Loop() {
+				if _, err := bm.parse(filename); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
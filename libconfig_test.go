@@ -1,11 +1,19 @@
 package libconfig
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 // errorReader is a custom reader that always returns an error
@@ -42,12 +50,13 @@ func TestNewLexerWithIOError(t *testing.T) {
 	}
 
 	// Verify it has exactly one EOF token
-	if len(lexer.tokens) != 1 {
-		t.Errorf("Expected 1 token, got %d", len(lexer.tokens))
+	tokens := lexer.drain()
+	if len(tokens) != 1 {
+		t.Errorf("Expected 1 token, got %d", len(tokens))
 	}
 
-	if len(lexer.tokens) > 0 {
-		token := lexer.tokens[0]
+	if len(tokens) > 0 {
+		token := tokens[0]
 		if token.Type != TokenEOF {
 			t.Errorf("Expected EOF token, got %s", token.Type)
 		}
@@ -1936,6 +1945,40 @@ func TestRealWorldConfig(t *testing.T) {
 	if err != nil || cpuThreshold != 80.0 {
 		t.Errorf("Expected CPU threshold 80.0, got %f", cpuThreshold)
 	}
+
+	// Flatten the nested settings into one struct with dotted-path tags
+	var flat struct {
+		Name        string  `libconfig:"app.name"`
+		Port        int     `libconfig:"app.server.port"`
+		SSL         bool    `libconfig:"app.server.ssl.enabled"`
+		DBHost      string  `libconfig:"app.database.connection.host"`
+		DBPort      uint16  `libconfig:"app.database.connection.port"`
+		IdleTimeout float64 `libconfig:"app.database.pool.idle_timeout"`
+		CPU         float32 `libconfig:"monitoring.thresholds.cpu_usage"`
+		Missing     string  `libconfig:"app.server.missing"`
+		Monitoring  struct {
+			Interval int  `libconfig:"interval"`
+			Enabled  bool `libconfig:"enabled"`
+		} `libconfig:"monitoring"`
+	}
+
+	if err := config.Unmarshal(&flat); err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+
+	if flat.Name != "MyApp" || flat.Port != 8080 || !flat.SSL || flat.DBHost != "localhost" || flat.DBPort != 5432 ||
+		flat.IdleTimeout != 300.0 || flat.CPU != 80.0 || flat.Missing != "" ||
+		flat.Monitoring.Interval != 60 || !flat.Monitoring.Enabled {
+		t.Errorf("Unexpected flat decode result: %+v", flat)
+	}
+
+	var wrongShape struct {
+		Port int `libconfig:"app.name.port"`
+	}
+
+	if err := config.Unmarshal(&wrongShape); !errors.Is(err, ErrNotGroup) {
+		t.Errorf("Expected ErrNotGroup for a path through a string, got %v", err)
+	}
 }
 
 func TestEscapeSequenceInRegex(t *testing.T) {
@@ -1956,3 +1999,5369 @@ func TestEscapeSequenceInRegex(t *testing.T) {
 		t.Errorf("Expected %q, got %q", expected, pattern)
 	}
 }
+
+// TestLookupTyped tests LookupTyped for scalars, arrays and groups
+func TestLookupTyped(t *testing.T) {
+	config, err := ParseString(`
+		port = 8080;
+		servers = [ "web1", "web2" ];
+		database = { host = "localhost"; port = 5432; };
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	tests := []struct {
+		path         string
+		expectedType ValueType
+		expected     any
+	}{
+		{"port", TypeInt, 8080},
+		{"servers", TypeArray, []any{"web1", "web2"}},
+		{"database", TypeGroup, map[string]any{"host": "localhost", "port": 5432}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			typ, val, err := config.LookupTyped(tt.path)
+			if err != nil {
+				t.Fatalf("Failed to lookup %s: %v", tt.path, err)
+			}
+
+			if typ != tt.expectedType {
+				t.Errorf("Expected type %s, got %s", tt.expectedType, typ)
+			}
+
+			if !reflect.DeepEqual(val, tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, val)
+			}
+		})
+	}
+
+	if _, _, err := config.LookupTyped("missing"); err == nil {
+		t.Error("Expected error for missing path")
+	}
+}
+
+// TestFreeze tests that a frozen config reports its state and serves concurrent lookups
+func TestFreeze(t *testing.T) {
+	config, err := ParseString(`
+		name = "MyApp";
+		database = { host = "localhost"; port = 5432; };
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if config.Frozen() {
+		t.Error("Expected a freshly parsed config not to be frozen")
+	}
+
+	config.Freeze()
+
+	if !config.Frozen() {
+		t.Error("Expected config to be frozen after Freeze")
+	}
+
+	done := make(chan struct{})
+
+	for i := 0; i < 8; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+
+			for j := 0; j < 100; j++ {
+				if _, err := config.LookupString("database.host"); err != nil {
+					t.Errorf("Unexpected lookup error: %v", err)
+					return
+				}
+
+				if _, err := config.LookupString("name"); err != nil {
+					t.Errorf("Unexpected lookup error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+}
+
+// TestBareIncludeOption tests that `include` without `@` is only a directive when enabled
+func TestBareIncludeOption(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "fragment.cfg"), []byte(`fragment_setting = 7;`), 0o644); err != nil {
+		t.Fatalf("Failed to write included file: %v", err)
+	}
+
+	mainFile := filepath.Join(tmpDir, "main.cfg")
+	if err := os.WriteFile(mainFile, []byte(`
+		name = "main";
+		include "fragment.cfg";
+		group = { include "fragment.cfg" };
+	`), 0o644); err != nil {
+		t.Fatalf("Failed to write main file: %v", err)
+	}
+
+	config, err := ParseFileWithOptions(mainFile, Options{BareInclude: true})
+	if err != nil {
+		t.Fatalf("Failed to parse with bare includes: %v", err)
+	}
+
+	if val, err := config.LookupInt("fragment_setting"); err != nil || val != 7 {
+		t.Errorf("Expected fragment_setting=7, got %d (err: %v)", val, err)
+	}
+
+	if val, err := config.LookupInt("group.fragment_setting"); err != nil || val != 7 {
+		t.Errorf("Expected group.fragment_setting=7, got %d (err: %v)", val, err)
+	}
+
+	// Without the option the bare form is not an include directive
+	if _, err := ParseFile(mainFile); err == nil {
+		t.Error("Expected bare include to be rejected by default")
+	}
+
+	// include remains a valid setting name, with and without the option
+	for _, opts := range []Options{{}, {BareInclude: true}} {
+		config, err := ParseStringWithOptions(`include = "yes";`, opts)
+		if err != nil {
+			t.Fatalf("Failed to parse include as identifier: %v", err)
+		}
+
+		if val, err := config.LookupString("include"); err != nil || val != "yes" {
+			t.Errorf("Expected include='yes', got '%s' (err: %v)", val, err)
+		}
+	}
+}
+
+// TestCheckIncludes tests that CheckIncludes reports only unresolved include directives
+func TestCheckIncludes(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "good.cfg"), []byte(`good = 1;`), 0o644); err != nil {
+		t.Fatalf("Failed to write included file: %v", err)
+	}
+
+	mainFile := filepath.Join(tmpDir, "main.cfg")
+	if err := os.WriteFile(mainFile, []byte(`name = "main";
+@include "good"
+@include "missing.cfg"
+broken = ;
+`), 0o644); err != nil {
+		t.Fatalf("Failed to write main file: %v", err)
+	}
+
+	errs := CheckIncludes(mainFile)
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error, got %d: %v", len(errs), errs)
+	}
+
+	if !errors.Is(errs[0], ErrIncludeFileNotFound) {
+		t.Errorf("Expected ErrIncludeFileNotFound, got %v", errs[0])
+	}
+
+	msg := errs[0].Error()
+	if !strings.Contains(msg, "main.cfg:3:1") {
+		t.Errorf("Expected error to report the directive position, got: %s", msg)
+	}
+
+	if !strings.Contains(msg, "missing.cfg.cnf") {
+		t.Errorf("Expected error to list the paths tried, got: %s", msg)
+	}
+
+	if errs := CheckIncludes(filepath.Join(tmpDir, "good.cfg")); errs != nil {
+		t.Errorf("Expected no errors for a file without includes, got %v", errs)
+	}
+}
+
+// TestSQLCommentsOption tests that `--` comments are only recognized when enabled
+func TestSQLCommentsOption(t *testing.T) {
+	input := `
+		-- leading comment
+		offset = -5; -- trailing comment
+		name = "app";
+	`
+
+	config, err := ParseStringWithOptions(input, Options{SQLComments: true})
+	if err != nil {
+		t.Fatalf("Failed to parse with SQL comments: %v", err)
+	}
+
+	offset, err := config.LookupInt("offset")
+	if err != nil || offset != -5 {
+		t.Errorf("Expected offset=-5, got %d (err: %v)", offset, err)
+	}
+
+	name, err := config.LookupString("name")
+	if err != nil || name != "app" {
+		t.Errorf("Expected name='app', got '%s' (err: %v)", name, err)
+	}
+
+	if _, err := ParseString(input); err == nil {
+		t.Error("Expected `--` comments to be rejected by default")
+	}
+}
+
+// TestValueLiteral tests rendering scalar values as libconfig literals
+func TestValueLiteral(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    Value
+		expected string
+	}{
+		{"int", NewIntValue(42), "42"},
+		{"negative_int", NewIntValue(-7), "-7"},
+		{"int64", NewInt64Value(42), "42L"},
+		{"big_int64", NewInt64Value(9223372036854775807), "9223372036854775807L"},
+		{"float", NewFloatValue(3.14), "3.14"},
+		{"whole_float", NewFloatValue(2), "2.0"},
+		{"small_float", NewFloatValue(1.23e-10), "1.23e-10"},
+		{"bool_true", NewBoolValue(true), "true"},
+		{"bool_false", NewBoolValue(false), "false"},
+		{"string", NewStringValue("hello"), `"hello"`},
+		{"escaped_string", NewStringValue("say \"hi\"\n\tC:\\path\x01"), `"say \"hi\"\n\tC:\\path\x01"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			literal, err := tt.value.Literal()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if literal != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, literal)
+			}
+
+			// The literal must parse back to the same value
+			config, err := ParseString("value = " + literal + ";")
+			if err != nil {
+				t.Fatalf("Failed to re-parse literal %s: %v", literal, err)
+			}
+
+			// Source metadata is not part of the value
+			reparsed := config.Root.GroupVal["value"]
+			reparsed.Pos = Position{}
+			reparsed.FloatText = ""
+
+			if !reflect.DeepEqual(reparsed, tt.value) {
+				t.Errorf("Expected %#v after re-parse, got %#v", tt.value, reparsed)
+			}
+		})
+	}
+
+	for _, collection := range []Value{NewArrayValue(nil), NewGroupValue(nil), NewListValue(nil)} {
+		if _, err := collection.Literal(); !errors.Is(err, ErrNotScalar) {
+			t.Errorf("Expected ErrNotScalar for %s, got %v", collection.Type, err)
+		}
+	}
+}
+
+// TestIncludeBackslashPaths tests that Windows-style separators in include paths resolve
+func TestIncludeBackslashPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(tmpDir, "sub", "nested"), 0o755); err != nil {
+		t.Fatalf("Failed to create sub directory: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "sub", "config.cfg"), []byte(`single = 1;`), 0o644); err != nil {
+		t.Fatalf("Failed to write included file: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "sub", "nested", "new.cfg"), []byte(`nested = 2;`), 0o644); err != nil {
+		t.Fatalf("Failed to write included file: %v", err)
+	}
+
+	mainFile := filepath.Join(tmpDir, "main.cfg")
+	if err := os.WriteFile(mainFile, []byte(`
+		@include "sub\config.cfg"
+		@include "sub\\nested\\new.cfg"
+		escaped = "tab\there";
+	`), 0o644); err != nil {
+		t.Fatalf("Failed to write main file: %v", err)
+	}
+
+	config, err := ParseFile(mainFile)
+	if err != nil {
+		t.Fatalf("Failed to parse file with backslash includes: %v", err)
+	}
+
+	if val, err := config.LookupInt("single"); err != nil || val != 1 {
+		t.Errorf("Expected single=1, got %d (err: %v)", val, err)
+	}
+
+	if val, err := config.LookupInt("nested"); err != nil || val != 2 {
+		t.Errorf("Expected nested=2, got %d (err: %v)", val, err)
+	}
+
+	// Escape processing still applies to ordinary strings
+	if val, err := config.LookupString("escaped"); err != nil || val != "tab\there" {
+		t.Errorf("Expected escaped string, got %q (err: %v)", val, err)
+	}
+}
+
+// TestPositions tests that Positions reports where each setting was defined
+func TestPositions(t *testing.T) {
+	tmpDir := t.TempDir()
+	filename := filepath.Join(tmpDir, "app.cfg")
+
+	content := `name = "MyApp";
+database = {
+  host = "localhost";
+    port = 5432;
+};
+servers = [ "web1", "web2" ];
+`
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	config, err := ParseFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	positions := config.Positions()
+
+	expected := map[string]Position{
+		"name":          {File: filename, Line: 1, Column: 1},
+		"database":      {File: filename, Line: 2, Column: 1},
+		"database.host": {File: filename, Line: 3, Column: 3},
+		"database.port": {File: filename, Line: 4, Column: 5},
+		"servers":       {File: filename, Line: 6, Column: 1},
+	}
+
+	if !reflect.DeepEqual(positions, expected) {
+		t.Errorf("Expected positions %v, got %v", expected, positions)
+	}
+
+	// Strings have no file name
+	config, err = ParseString("a = 1;\n  b = 2;")
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if pos := config.Positions()["b"]; pos.String() != "2:3" {
+		t.Errorf("Expected position 2:3, got %s", pos)
+	}
+}
+
+// TestUnmarshalUnknownKeys tests the unknown-key callback and strict mode of UnmarshalWithOptions
+func TestUnmarshalUnknownKeys(t *testing.T) {
+	type Server struct {
+		Host string `libconfig:"host"`
+		Port int    `libconfig:"port"`
+	}
+
+	type AppConfig struct {
+		Name   string `libconfig:"name"`
+		Server Server `libconfig:"server"`
+	}
+
+	config, err := ParseString(`
+		name = "MyApp";
+		server = {
+			host = "localhost";
+			prot = 8080;
+		};
+		debug = true;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	// By default unknown keys are ignored
+	var lenient AppConfig
+	if err := config.Unmarshal(&lenient); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if lenient.Name != "MyApp" || lenient.Server.Host != "localhost" {
+		t.Errorf("Unexpected decoded value: %+v", lenient)
+	}
+
+	// The callback sees every unknown key
+	var unknown []string
+
+	var withCallback AppConfig
+	if err := config.UnmarshalWithOptions(&withCallback, UnmarshalOptions{
+		UnknownKey: func(path string) { unknown = append(unknown, path) },
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sort.Strings(unknown)
+
+	if !reflect.DeepEqual(unknown, []string{"debug", "server.prot"}) {
+		t.Errorf("Expected unknown keys [debug server.prot], got %v", unknown)
+	}
+
+	// Strict mode turns unknown keys into an error
+	var strict AppConfig
+
+	err = config.UnmarshalWithOptions(&strict, UnmarshalOptions{DisallowUnknownKeys: true})
+	if !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Expected ErrUnknownKey, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "server.prot") || !strings.Contains(err.Error(), "debug") {
+		t.Errorf("Expected error to name both unknown keys, got: %v", err)
+	}
+}
+
+// TestUnmarshalErrors tests Unmarshal target validation and type mismatches
+func TestUnmarshalErrors(t *testing.T) {
+	config, err := ParseString(`port = "eighty"; small = 300;`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	var notPointer struct{}
+	if err := config.Unmarshal(notPointer); !errors.Is(err, ErrInvalidUnmarshalTarget) {
+		t.Errorf("Expected ErrInvalidUnmarshalTarget, got %v", err)
+	}
+
+	var mismatch struct {
+		Port int `libconfig:"port"`
+	}
+	if err := config.Unmarshal(&mismatch); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("Expected ErrNotInteger, got %v", err)
+	} else if !strings.Contains(err.Error(), "value at 'port' is a string, not an integer") {
+		t.Errorf("Expected the error to name the setting and the type found, got %v", err)
+	}
+
+	var nested struct {
+		Small struct{ Limit int } `libconfig:"small"`
+	}
+	if err := config.Unmarshal(&nested); !errors.Is(err, ErrNotGroup) || !strings.Contains(err.Error(), "is an int, not a group") {
+		t.Errorf("Expected ErrNotGroup naming the int found, got %v", err)
+	}
+
+	var overflow struct {
+		Small int8 `libconfig:"small"`
+	}
+	if err := config.Unmarshal(&overflow); !errors.Is(err, ErrIntegerOutOfRange) {
+		t.Errorf("Expected ErrIntegerOutOfRange, got %v", err)
+	}
+}
+
+// TestParseStringBaseDir tests that Options.BaseDir resolves includes for string input
+func TestParseStringBaseDir(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "fragment.cfg"), []byte(`fragment = "found";`), 0o644); err != nil {
+		t.Fatalf("Failed to write included file: %v", err)
+	}
+
+	input := `@include "fragment.cfg"`
+
+	config, err := ParseStringWithOptions(input, Options{BaseDir: tmpDir})
+	if err != nil {
+		t.Fatalf("Failed to parse with base directory: %v", err)
+	}
+
+	if val, err := config.LookupString("fragment"); err != nil || val != "found" {
+		t.Errorf("Expected fragment='found', got '%s' (err: %v)", val, err)
+	}
+
+	// Without a base directory the include is resolved against the working directory
+	if _, err := ParseString(input); !errors.Is(err, ErrIncludeFileNotFound) {
+		t.Errorf("Expected ErrIncludeFileNotFound without a base directory, got %v", err)
+	}
+}
+
+// TestLoaderPrecedence tests that Loader applies defaults, files, environment and overrides in order
+func TestLoaderPrecedence(t *testing.T) {
+	defaults, err := ParseString(`
+		name = "default";
+		port = 1;
+		debug = false;
+		database = { host = "default-host"; port = 1; pool = 5; };
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse defaults: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "app.cfg")
+	if err := os.WriteFile(filename, []byte(`
+		port = 2;
+		debug = true;
+		database = { host = "file-host"; port = 2; };
+	`), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	t.Setenv("LOADERTEST_DEBUG", "false")
+	t.Setenv("LOADERTEST_DATABASE__PORT", "3")
+	t.Setenv("LOADERTEST_DATABASE__USER", "env-user")
+
+	override, err := ParseString(`database = { port = 4; };`)
+	if err != nil {
+		t.Fatalf("Failed to parse override: %v", err)
+	}
+
+	config, err := NewLoader().
+		AddDefaults(defaults).
+		AddFile(filename).
+		AddEnv("LOADERTEST").
+		AddOverride(override).
+		Build()
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	expectString := func(path, expected string) {
+		t.Helper()
+
+		if val, err := config.LookupString(path); err != nil || val != expected {
+			t.Errorf("Expected %s=%q, got %q (err: %v)", path, expected, val, err)
+		}
+	}
+
+	expectInt := func(path string, expected int) {
+		t.Helper()
+
+		if val, err := config.LookupInt(path); err != nil || val != expected {
+			t.Errorf("Expected %s=%d, got %d (err: %v)", path, expected, val, err)
+		}
+	}
+
+	expectString("name", "default")
+	expectInt("port", 2)
+	expectString("database.host", "file-host")
+	expectInt("database.pool", 5)
+	expectString("database.user", "env-user")
+	expectInt("database.port", 4)
+
+	if debug, err := config.LookupBool("debug"); err != nil || debug {
+		t.Errorf("Expected debug=false from the environment, got %t (err: %v)", debug, err)
+	}
+
+	// The sources themselves are left untouched
+	if host, _ := defaults.LookupString("database.host"); host != "default-host" {
+		t.Errorf("Expected defaults to be unchanged, got database.host=%q", host)
+	}
+}
+
+// TestLoaderCollectsErrors tests that Build keeps going when a source fails
+func TestLoaderCollectsErrors(t *testing.T) {
+	defaults, err := ParseString(`name = "default";`)
+	if err != nil {
+		t.Fatalf("Failed to parse defaults: %v", err)
+	}
+
+	config, err := NewLoader().
+		AddDefaults(defaults).
+		AddFile(filepath.Join(t.TempDir(), "missing.cfg")).
+		Build()
+	if err == nil {
+		t.Error("Expected an error for the missing file")
+	}
+
+	if name, _ := config.LookupString("name"); name != "default" {
+		t.Errorf("Expected name='default' despite the failed source, got %q", name)
+	}
+}
+
+// TestMergeFrozen tests that Merge refuses to modify a frozen config
+func TestMergeFrozen(t *testing.T) {
+	config := NewConfig()
+	config.Freeze()
+
+	if err := config.Merge(NewConfig()); !errors.Is(err, ErrConfigFrozen) {
+		t.Errorf("Expected ErrConfigFrozen, got %v", err)
+	}
+}
+
+// TestValueIter tests iterating over array and list elements
+func TestValueIter(t *testing.T) {
+	const count = 10000
+
+	items := make([]string, count)
+	for i := range items {
+		items[i] = fmt.Sprintf("%d", i+1)
+	}
+
+	config, err := ParseString("numbers = [ " + strings.Join(items, ", ") + " ];")
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	numbers, err := config.Lookup("numbers")
+	if err != nil {
+		t.Fatalf("Failed to lookup numbers: %v", err)
+	}
+
+	sum, seen := 0, 0
+	for i, element := range numbers.Iter() {
+		if i != seen {
+			t.Fatalf("Expected index %d, got %d", seen, i)
+		}
+
+		sum += element.IntVal
+		seen++
+	}
+
+	if expected := count * (count + 1) / 2; sum != expected {
+		t.Errorf("Expected sum %d, got %d", expected, sum)
+	}
+
+	// Breaking out early stops the iteration
+	seen = 0
+	for range numbers.Iter() {
+		seen++
+		if seen == 3 {
+			break
+		}
+	}
+
+	if seen != 3 {
+		t.Errorf("Expected to stop after 3 elements, got %d", seen)
+	}
+
+	list := NewListValue([]Value{NewStringValue("a"), NewIntValue(1)})
+	seen = 0
+
+	for range list.Iter() {
+		seen++
+	}
+
+	if seen != 2 {
+		t.Errorf("Expected 2 list elements, got %d", seen)
+	}
+
+	for range NewIntValue(1).Iter() {
+		t.Error("Expected no elements for a scalar")
+	}
+}
+
+// TestConfigHash tests that Hash ignores declaration order and formatting but detects changes
+func TestConfigHash(t *testing.T) {
+	first, err := ParseString(`
+		name = "MyApp";
+		port = 8080;
+		database = { host = "localhost"; port = 5432; };
+		servers = [ "web1", "web2" ];
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	second, err := ParseString(`
+		# Same settings, different order and layout
+		servers = ["web1","web2"];
+		database : { port : 5432; host : "localhost"; };
+		port = 8080; name = "MyApp";
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if first.Hash() != second.Hash() {
+		t.Errorf("Expected equivalent configs to hash equally, got %x and %x", first.Hash(), second.Hash())
+	}
+
+	if first.Hash() != first.Hash() {
+		t.Error("Expected Hash to be deterministic")
+	}
+
+	changed, err := ParseString(`
+		name = "MyApp";
+		port = 8080;
+		database = { host = "localhost"; port = 5433; };
+		servers = [ "web1", "web2" ];
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if first.Hash() == changed.Hash() {
+		t.Error("Expected a changed value to change the hash")
+	}
+
+	// An array and a list with the same elements are different values
+	array, _ := ParseString(`x = [ 1, 2 ];`)
+	list, _ := ParseString(`x = ( 1, 2 );`)
+
+	if array.Hash() == list.Hash() {
+		t.Error("Expected array and list to hash differently")
+	}
+}
+
+// TestWriteRoundTripRadix tests that Write keeps hex, binary and octal integers in their original base.
+func TestWriteRoundTripRadix(t *testing.T) {
+	config, err := ParseString(`
+		mask = 0xff;
+		flags = 0b1010;
+		mode = 0o755;
+		big = 0x7FFFFFFFFFL;
+		count = 42;
+		name = "app";
+		ratio = 0.5;
+		ports = [ 0x50, 0x1BB ];
+		server = { enabled = true; modes = ( 0q644, "x", { } ); };
+		empty = [ ];
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := config.Write(&sb); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	text := sb.String()
+	for _, want := range []string{"mask = 0xFF;", "flags = 0b1010;", "mode = 0o755;", "big = 0x7FFFFFFFFFL;", "count = 42;", "[ 0x50, 0x1BB ]", "0o644"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, text)
+		}
+	}
+
+	reparsed, err := ParseString(text)
+	if err != nil {
+		t.Fatalf("Failed to parse written config: %v\n%s", err, text)
+	}
+
+	if config.Hash() != reparsed.Hash() {
+		t.Errorf("Expected written config to parse back to the same settings, got:\n%s", text)
+	}
+
+	mask, _ := reparsed.Lookup("mask")
+	if mask.Radix != 16 {
+		t.Errorf("Expected mask to keep radix 16, got %d", mask.Radix)
+	}
+
+	// Negative values carry the sign before the prefix
+	literal, err := Value{Type: TypeInt, IntVal: -16, Radix: 16}.Literal()
+	if err != nil || literal != "-0x10" {
+		t.Errorf("Expected -0x10, got %q (%v)", literal, err)
+	}
+}
+
+// TestDottedKeyRoundTrip tests that quoted keys containing dots are addressable and survive Write.
+func TestDottedKeyRoundTrip(t *testing.T) {
+	config, err := ParseString(`
+		"a.b" = 1;
+		plain = "x";
+		hosts = { "example.com" = { port = 443; }; "back\\slash" = true; };
+		"true" = false;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if got, err := config.LookupInt(`a\.b`); err != nil || got != 1 {
+		t.Errorf("Expected a\\.b to be 1, got %d (%v)", got, err)
+	}
+
+	path := "hosts." + EscapeKey("example.com") + ".port"
+	if got, err := config.LookupInt(path); err != nil || got != 443 {
+		t.Errorf("Expected %s to be 443, got %d (%v)", path, got, err)
+	}
+
+	if got, err := config.LookupBool(`hosts.back\\slash`); err != nil || !got {
+		t.Errorf("Expected hosts.back\\\\slash to be true, got %v (%v)", got, err)
+	}
+
+	if _, err := config.Lookup("a.b"); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected unescaped a.b to be treated as a nested path, got %v", err)
+	}
+
+	if _, ok := config.Positions()[`hosts.example\.com.port`]; !ok {
+		t.Error("Expected Positions to use escaped paths")
+	}
+
+	var sb strings.Builder
+	if err := config.Write(&sb); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	text := sb.String()
+	for _, want := range []string{`"a.b" = 1;`, `"example.com" = {`, `"true" = false;`, `plain = "x";`} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, text)
+		}
+	}
+
+	reparsed, err := ParseString(text)
+	if err != nil {
+		t.Fatalf("Failed to parse written config: %v\n%s", err, text)
+	}
+
+	if config.Hash() != reparsed.Hash() {
+		t.Errorf("Expected round-trip to preserve settings, got:\n%s", text)
+	}
+
+	if got, err := reparsed.LookupInt(`a\.b`); err != nil || got != 1 {
+		t.Errorf("Expected a\\.b to be 1 after round-trip, got %d (%v)", got, err)
+	}
+}
+
+// TestCheck tests running per-path rules and collecting their violations.
+func TestCheck(t *testing.T) {
+	config, err := ParseString(`
+		server = { host = "localhost"; port = 70000; };
+		workers = 4;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	errPortRange := errors.New("port out of range")
+	portInRange := func(v *Value) error {
+		port, ok := v.int64()
+		if !ok || port < 1 || port > 65535 {
+			return fmt.Errorf("%v: %w", v.native(), errPortRange)
+		}
+
+		return nil
+	}
+
+	violations := config.Check(map[string]func(*Value) error{
+		"server.port": portInRange,
+		"server.host": func(v *Value) error {
+			if v.Type != TypeString {
+				return ErrNotString
+			}
+
+			return nil
+		},
+		"workers":   func(*Value) error { return nil },
+		"log.level": func(*Value) error { return nil },
+	})
+
+	if len(violations) != 2 {
+		t.Fatalf("Expected 2 violations, got %d: %v", len(violations), violations)
+	}
+
+	if !errors.Is(violations[0], ErrSettingNotFound) {
+		t.Errorf("Expected missing log.level to be reported first, got %v", violations[0])
+	}
+
+	if !errors.Is(violations[1], errPortRange) || !strings.Contains(violations[1].Error(), "server.port") {
+		t.Errorf("Expected out-of-range server.port, got %v", violations[1])
+	}
+
+	if violations := config.Check(map[string]func(*Value) error{"workers": portInRange}); violations != nil {
+		t.Errorf("Expected no violations, got %v", violations)
+	}
+}
+
+// TestTrailingComments tests that comments after the last setting survive parse and Write.
+func TestTrailingComments(t *testing.T) {
+	input := `
+		name = "app";
+		server = {
+			port = 8080;
+			// port must stay below 10000
+		};
+		# final note
+		/* end of file */`
+
+	config, err := ParseStringWithOptions(input, Options{PreserveComments: true})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	expected := []string{"# final note", "/* end of file */"}
+	if !reflect.DeepEqual(config.Root.TrailingComments, expected) {
+		t.Errorf("Expected root trailing comments %q, got %q", expected, config.Root.TrailingComments)
+	}
+
+	server, _ := config.Lookup("server")
+	if len(server.TrailingComments) != 1 || server.TrailingComments[0] != "// port must stay below 10000" {
+		t.Errorf("Expected group trailing comment, got %q", server.TrailingComments)
+	}
+
+	var sb strings.Builder
+	if err := config.Write(&sb); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	text := sb.String()
+	if !strings.HasSuffix(text, "# final note\n/* end of file */\n") {
+		t.Errorf("Expected output to end with the trailing comments, got:\n%s", text)
+	}
+
+	reparsed, err := ParseStringWithOptions(text, Options{PreserveComments: true})
+	if err != nil {
+		t.Fatalf("Failed to parse written config: %v\n%s", err, text)
+	}
+
+	if !reflect.DeepEqual(reparsed.Root.TrailingComments, expected) {
+		t.Errorf("Expected trailing comments to survive round-trip, got %q", reparsed.Root.TrailingComments)
+	}
+
+	// Comments are discarded unless requested
+	plain, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if plain.Root.TrailingComments != nil {
+		t.Errorf("Expected no comments without PreserveComments, got %q", plain.Root.TrailingComments)
+	}
+}
+
+// mapResolver serves includes from memory and blocks on names it does not have.
+type mapResolver map[string]string
+
+func (r mapResolver) Resolve(ctx context.Context, _, path string) (io.ReadCloser, string, error) {
+	if content, ok := r[path]; ok {
+		return io.NopCloser(strings.NewReader(content)), path, nil
+	}
+
+	<-ctx.Done()
+
+	return nil, "", ctx.Err()
+}
+
+// TestIncludeResolverTimeout tests custom include resolvers and the per-include timeout.
+func TestIncludeResolverTimeout(t *testing.T) {
+	resolver := mapResolver{"db.cfg": `host = "db.local";`}
+	opts := Options{IncludeResolver: resolver, IncludeTimeout: 50 * time.Millisecond}
+
+	config, err := ParseStringWithOptions(`database = { @include "db.cfg" };`, opts)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if host, err := config.LookupString("database.host"); err != nil || host != "db.local" {
+		t.Errorf("Expected database.host from resolver, got %q (%v)", host, err)
+	}
+
+	pos := config.Positions()["database.host"]
+	if pos.File != "db.cfg" {
+		t.Errorf("Expected position in db.cfg, got %s", pos)
+	}
+
+	start := time.Now()
+
+	_, err = ParseStringWithOptions(`@include "//slow-mount/app.cfg"`, opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a deadline exceeded error, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the hung include to time out promptly, took %v", elapsed)
+	}
+
+	// A source that fails while being read is an error, not an empty file
+	failing := readerResolver(func() io.ReadCloser { return io.NopCloser(&errorReader{}) })
+
+	_, err = ParseStringWithOptions(`@include "remote.cfg"`, Options{IncludeResolver: failing})
+	if err == nil || !strings.Contains(err.Error(), "failed to read include 'remote.cfg'") {
+		t.Errorf("Expected the read error for remote.cfg, got %v", err)
+	}
+
+	// Reading is bounded by the timeout as well as resolving
+	blocking := readerResolver(func() io.ReadCloser {
+		reader, _ := io.Pipe()
+		return reader
+	})
+	start = time.Now()
+
+	_, err = ParseStringWithOptions(`@include "remote.cfg"`, Options{IncludeResolver: blocking, IncludeTimeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a deadline exceeded error for a blocked read, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the blocked read to time out promptly, took %v", elapsed)
+	}
+}
+
+// readerResolver resolves every include to a reader from the function.
+type readerResolver func() io.ReadCloser
+
+func (r readerResolver) Resolve(_ context.Context, _, path string) (io.ReadCloser, string, error) {
+	return r(), path, nil
+}
+
+// TestNegativeNumbers tests that a minus sign binds only to a directly following number.
+func TestNegativeNumbers(t *testing.T) {
+	config, err := ParseString(`
+		a = -5;
+		b = -0xFF;
+		c = -0b101L;
+		d = -0x8000000000000000L;
+		e = [ -1, -0o17 ];
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	for path, expected := range map[string]int{"a": -5, "b": -255} {
+		if val, err := config.LookupInt(path); err != nil || val != expected {
+			t.Errorf("Expected %s to be %d, got %d (%v)", path, expected, val, err)
+		}
+	}
+
+	if val, err := config.LookupInt64("c"); err != nil || val != -5 {
+		t.Errorf("Expected c to be -5, got %d (%v)", val, err)
+	}
+
+	if val, err := config.LookupInt64("d"); err != nil || val != -1<<63 {
+		t.Errorf("Expected d to be the minimum int64, got %d (%v)", val, err)
+	}
+
+	e, _ := config.Lookup("e")
+	if e.ArrayVal[1].IntVal != -15 || e.ArrayVal[1].Radix != 8 {
+		t.Errorf("Expected -0o17 to be -15 in radix 8, got %d in radix %d", e.ArrayVal[1].IntVal, e.ArrayVal[1].Radix)
+	}
+
+	var sb strings.Builder
+	if err := config.Write(&sb); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	for _, want := range []string{"b = -0xFF;", "d = -0x8000000000000000L;", "[ -1, -0o17 ]"} {
+		if !strings.Contains(sb.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, sb.String())
+		}
+	}
+
+	// A sign separated from its number is rejected
+	for _, input := range []string{`a = - 5;`, `a = [ 1, - 2 ];`, `a = -;`} {
+		if _, err := ParseString(input); !errors.Is(err, ErrDetachedSign) {
+			t.Errorf("Expected ErrDetachedSign for %q, got %v", input, err)
+		}
+	}
+}
+
+// TestSectionText tests serializing a single subtree that parses back on its own.
+func TestSectionText(t *testing.T) {
+	config, err := ParseString(`
+		name = "platform";
+		services = {
+			api = {
+				image = "api:1.4";
+				ports = [ 80, 443 ];
+				limits = { cpu = 0.5; memory = 0x200; };
+			};
+			worker = { image = "worker:2.0"; };
+		};
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	text, err := config.SectionText("services.api")
+	if err != nil {
+		t.Fatalf("Failed to get section text: %v", err)
+	}
+
+	if !strings.HasPrefix(text, "api = {\n") || strings.Contains(text, "worker") || strings.Contains(text, "platform") {
+		t.Errorf("Expected only the api section, got:\n%s", text)
+	}
+
+	section, err := ParseString(text)
+	if err != nil {
+		t.Fatalf("Failed to parse section text: %v\n%s", err, text)
+	}
+
+	original, _ := config.Lookup("services")
+	standalone := Config{Root: NewGroupValue(map[string]Value{"api": original.GroupVal["api"]})}
+
+	if section.Hash() != standalone.Hash() {
+		t.Errorf("Expected section to parse back to the same subtree, got:\n%s", text)
+	}
+
+	if memory, err := section.LookupInt("api.limits.memory"); err != nil || memory != 512 {
+		t.Errorf("Expected api.limits.memory to be 512, got %d (%v)", memory, err)
+	}
+
+	if text, err := config.SectionText("name"); err != nil || text != "name = \"platform\";\n" {
+		t.Errorf("Expected scalar section text, got %q (%v)", text, err)
+	}
+
+	if _, err := config.SectionText("services.db"); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound, got %v", err)
+	}
+}
+
+// TestResourceLimitBoundaries tests that MaxSettings and MaxDepth trip exactly one past the limit.
+func TestResourceLimitBoundaries(t *testing.T) {
+	const limit = 50
+
+	settings := func(n int) string {
+		var sb strings.Builder
+		for i := range n {
+			fmt.Fprintf(&sb, "s%d = %d;\n", i, i)
+		}
+
+		return sb.String()
+	}
+
+	if _, err := ParseStringWithOptions(settings(limit), Options{MaxSettings: limit}); err != nil {
+		t.Errorf("Expected %d settings to be allowed, got %v", limit, err)
+	}
+
+	if _, err := ParseStringWithOptions(settings(limit+1), Options{MaxSettings: limit}); !errors.Is(err, ErrTooManySettings) {
+		t.Errorf("Expected ErrTooManySettings for %d settings, got %v", limit+1, err)
+	}
+
+	// Array elements count as settings: one setting plus limit-1 elements
+	elements := strings.Repeat("1, ", limit-2) + "1"
+	if _, err := ParseStringWithOptions("a = [ "+elements+" ];", Options{MaxSettings: limit}); err != nil {
+		t.Errorf("Expected an array filling the limit to be allowed, got %v", err)
+	}
+
+	if _, err := ParseStringWithOptions("a = [ "+elements+", 1 ];", Options{MaxSettings: limit}); !errors.Is(err, ErrTooManySettings) {
+		t.Errorf("Expected ErrTooManySettings for an array past the limit, got %v", err)
+	}
+
+	nested := func(n int) string {
+		return "a = " + strings.Repeat("( ", n) + "1" + strings.Repeat(" )", n) + ";"
+	}
+
+	if _, err := ParseStringWithOptions(nested(limit), Options{MaxDepth: limit}); err != nil {
+		t.Errorf("Expected nesting depth %d to be allowed, got %v", limit, err)
+	}
+
+	if _, err := ParseStringWithOptions(nested(limit+1), Options{MaxDepth: limit}); !errors.Is(err, ErrMaxDepthExceeded) {
+		t.Errorf("Expected ErrMaxDepthExceeded for depth %d, got %v", limit+1, err)
+	}
+
+	// Sibling collections do not accumulate depth
+	siblings := "a = { b = { }; c = [ 1 ]; d = ( 2 ); };"
+	if _, err := ParseStringWithOptions(siblings, Options{MaxDepth: 2}); err != nil {
+		t.Errorf("Expected sibling collections within the depth limit, got %v", err)
+	}
+
+	// Settings and depth carry over into included files
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "inc.cfg"), []byte(`x = 1; y = { z = 2; };`), 0o644); err != nil {
+		t.Fatalf("Failed to write include file: %v", err)
+	}
+
+	opts := Options{BaseDir: tempDir, MaxSettings: 5}
+	if _, err := ParseStringWithOptions(`a = 1; g = { @include "inc.cfg" };`, opts); err != nil {
+		t.Errorf("Expected 5 settings across the include to be allowed, got %v", err)
+	}
+
+	if _, err := ParseStringWithOptions(`a = 1; b = 2; g = { @include "inc.cfg" };`, opts); !errors.Is(err, ErrTooManySettings) {
+		t.Errorf("Expected ErrTooManySettings counting included settings, got %v", err)
+	}
+
+	opts = Options{BaseDir: tempDir, MaxDepth: 1}
+	if _, err := ParseStringWithOptions(`@include "inc.cfg"`, opts); err != nil {
+		t.Errorf("Expected top-level include within the depth limit, got %v", err)
+	}
+
+	if _, err := ParseStringWithOptions(`g = { @include "inc.cfg" };`, opts); !errors.Is(err, ErrMaxDepthExceeded) {
+		t.Errorf("Expected ErrMaxDepthExceeded counting the including group, got %v", err)
+	}
+}
+
+// TestEmptyStatements tests that stray and doubled semicolons are ignored.
+func TestEmptyStatements(t *testing.T) {
+	inputs := []string{
+		`a = 1;; b = 2;`,
+		`; a = 1; b = 2;`,
+		`a = 1; b = 2;;;`,
+		`a = 1; g = { ; x = 3;; }; b = 2;`,
+	}
+
+	for _, input := range inputs {
+		config, err := ParseString(input)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", input, err)
+			continue
+		}
+
+		if a, _ := config.LookupInt("a"); a != 1 {
+			t.Errorf("Expected a = 1 in %q, got %d", input, a)
+		}
+
+		if b, _ := config.LookupInt("b"); b != 2 {
+			t.Errorf("Expected b = 2 in %q, got %d", input, b)
+		}
+	}
+
+	config, err := ParseString(`g = { ; x = 3;; };`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if x, err := config.LookupInt("g.x"); err != nil || x != 3 {
+		t.Errorf("Expected g.x = 3, got %d (%v)", x, err)
+	}
+
+	// Semicolons are still not allowed between array elements
+	if _, err := ParseString(`a = [ 1;; 2 ];`); err == nil {
+		t.Error("Expected an error for semicolons inside an array")
+	}
+}
+
+// TestTokenize tests the public token stream for a small config.
+func TestTokenize(t *testing.T) {
+	tokens, err := Tokenize("name = \"app\"; # comment\nports = [ 80, 0x1BB ];")
+	if err != nil {
+		t.Fatalf("Failed to tokenize: %v", err)
+	}
+
+	expected := []Token{
+		{Value: "name", Type: TokenIdentifier, Line: 1, Column: 1, Start: 0, End: 4},
+		{Value: "=", Type: TokenAssign, Line: 1, Column: 6, Start: 5, End: 6},
+		{Value: "app", Type: TokenString, Line: 1, Column: 8, Start: 7, End: 12},
+		{Value: ";", Type: TokenSemicolon, Line: 1, Column: 13, Start: 12, End: 13},
+		{Value: "ports", Type: TokenIdentifier, Line: 2, Column: 1, Start: 24, End: 29},
+		{Value: "=", Type: TokenAssign, Line: 2, Column: 7, Start: 30, End: 31},
+		{Value: "[", Type: TokenLeftBracket, Line: 2, Column: 9, Start: 32, End: 33},
+		{Value: "80", Type: TokenInteger, Line: 2, Column: 11, Start: 34, End: 36},
+		{Value: ",", Type: TokenComma, Line: 2, Column: 13, Start: 36, End: 37},
+		{Value: "0x1BB", Type: TokenInteger, Line: 2, Column: 15, Start: 38, End: 43},
+		{Value: "]", Type: TokenRightBracket, Line: 2, Column: 21, Start: 44, End: 45},
+		{Value: ";", Type: TokenSemicolon, Line: 2, Column: 22, Start: 45, End: 46},
+		{Value: "", Type: TokenEOF, Line: 2, Column: 22, Start: 46, End: 46},
+	}
+
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Unexpected token stream:\n got %v\nwant %v", tokens, expected)
+	}
+
+	tokens, err = Tokenize(`a = 1 $ b`)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Expected ErrInvalidToken, got %v", err)
+	}
+
+	if len(tokens) != 6 || tokens[3].Type != TokenError || tokens[3].Value != "$" || tokens[5].Type != TokenEOF {
+		t.Errorf("Expected the stray character as a TokenError followed by the rest of the input, got %v", tokens)
+	}
+}
+
+// TestLookupFlags tests combining flag names into a bit set.
+func TestLookupFlags(t *testing.T) {
+	config, err := ParseString(`
+		perms = ( "READ", "WRITE" );
+		admin = [ "READ", "WRITE", "EXEC", "READ" ];
+		none = ( );
+		bad = ( "READ", "DELETE" );
+		mixed = ( "READ", 4 );
+		single = "READ";
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	bits := map[string]int{"READ": 1 << 0, "WRITE": 1 << 1, "EXEC": 1 << 2}
+
+	tests := map[string]int{"perms": 3, "admin": 7, "none": 0}
+	for path, expected := range tests {
+		if flags, err := config.LookupFlags(path, bits); err != nil || flags != expected {
+			t.Errorf("Expected %s to be %d, got %d (%v)", path, expected, flags, err)
+		}
+	}
+
+	_, err = config.LookupFlags("bad", bits)
+	if !errors.Is(err, ErrUnknownFlag) || !strings.Contains(err.Error(), "DELETE") {
+		t.Errorf("Expected ErrUnknownFlag naming DELETE, got %v", err)
+	}
+
+	if _, err := config.LookupFlags("mixed", bits); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected ErrNotString, got %v", err)
+	}
+
+	if _, err := config.LookupFlags("single", bits); !errors.Is(err, ErrNotSequence) {
+		t.Errorf("Expected ErrNotSequence, got %v", err)
+	}
+}
+
+// TestSiblingTypes tests reporting the types of the other members of a path's parent group.
+func TestSiblingTypes(t *testing.T) {
+	config, err := ParseString(`
+		name = "app";
+		server = {
+			host = "localhost";
+			port = 8080;
+			timeout = 2.5;
+			tls = false;
+			routes = [ "/", "/api" ];
+			limits = { rps = 100; };
+		};
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	types, err := config.SiblingTypes("server.retries")
+	if err != nil {
+		t.Fatalf("Failed to get sibling types: %v", err)
+	}
+
+	expected := map[string]ValueType{
+		"host":    TypeString,
+		"port":    TypeInt,
+		"timeout": TypeFloat,
+		"tls":     TypeBool,
+		"routes":  TypeArray,
+		"limits":  TypeGroup,
+	}
+
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected %v, got %v", expected, types)
+	}
+
+	// An existing setting is excluded from its own siblings
+	types, err = config.SiblingTypes("server.port")
+	if err != nil {
+		t.Fatalf("Failed to get sibling types: %v", err)
+	}
+
+	if _, ok := types["port"]; ok || len(types) != len(expected)-1 {
+		t.Errorf("Expected siblings of server.port without port, got %v", types)
+	}
+
+	if types, err := config.SiblingTypes("version"); err != nil || types["name"] != TypeString || types["server"] != TypeGroup {
+		t.Errorf("Expected top-level siblings, got %v (%v)", types, err)
+	}
+
+	if _, err := config.SiblingTypes("missing.key"); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound for a missing parent, got %v", err)
+	}
+
+	if _, err := config.SiblingTypes("name.key"); !errors.Is(err, ErrCannotLookupInNonGroup) {
+		t.Errorf("Expected ErrCannotLookupInNonGroup for a scalar parent, got %v", err)
+	}
+}
+
+// TestFloatTextRoundTrip tests that floats keep their source formatting when written.
+func TestFloatTextRoundTrip(t *testing.T) {
+	config, err := ParseString(`
+		a = 1.0;
+		b = 1e3;
+		c = 3.140;
+		d = -2.50E-3;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := config.Write(&sb); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	expected := "a = 1.0;\nb = 1e3;\nc = 3.140;\nd = -2.50E-3;\n"
+	if sb.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, sb.String())
+	}
+
+	reparsed, err := ParseString(sb.String())
+	if err != nil {
+		t.Fatalf("Failed to parse written config: %v", err)
+	}
+
+	if config.Hash() != reparsed.Hash() {
+		t.Error("Expected the written floats to parse back to the same values")
+	}
+
+	// Constructed floats and floats changed after parsing use the default format
+	if literal, _ := NewFloatValue(1000).Literal(); literal != "1000.0" {
+		t.Errorf("Expected 1000.0 for a constructed float, got %s", literal)
+	}
+
+	changed := config.Root.GroupVal["c"]
+	changed.FloatVal = 2.5
+
+	if literal, _ := changed.Literal(); literal != "2.5" {
+		t.Errorf("Expected stale FloatText to be ignored, got %s", literal)
+	}
+}
+
+// TestWriteOptions tests serializing with different house styles.
+func TestWriteOptions(t *testing.T) {
+	config, err := ParseString(`
+		name = "app";
+		server = { port = 8080; host = "localhost"; };
+		tags = [ "a", "b" ];
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     WriteOptions
+		expected string
+	}{
+		{
+			name: "tabs in declaration order",
+			opts: WriteOptions{Indent: "\t", Assign: ": ", OmitSemicolons: true},
+			expected: "name: \"app\"\n" +
+				"server: {\n\tport: 8080\n\thost: \"localhost\"\n}\n" +
+				"tags: [ \"a\", \"b\" ]\n",
+		},
+		{
+			name: "compact sorted",
+			opts: WriteOptions{Indent: "  ", Assign: "=", SortKeys: true},
+			expected: "name=\"app\";\n" +
+				"server={\n  host=\"localhost\";\n  port=8080;\n};\n" +
+				"tags=[ \"a\", \"b\" ];\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			if err := config.WriteWithOptions(&sb, tt.opts); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+
+			if sb.String() != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, sb.String())
+			}
+
+			reparsed, err := ParseString(sb.String())
+			if err != nil {
+				t.Fatalf("Failed to parse written config: %v", err)
+			}
+
+			if reparsed.Hash() != config.Hash() {
+				t.Error("Expected the written config to parse back to the same settings")
+			}
+		})
+	}
+
+	var sb strings.Builder
+	if err := config.Write(&sb); err != nil || !strings.Contains(sb.String(), "    host = \"localhost\";\n    port = 8080;") {
+		t.Errorf("Expected default style with sorted keys, got:\n%s (%v)", sb.String(), err)
+	}
+
+	for _, opts := range []WriteOptions{{Indent: "--"}, {Assign: " -> "}} {
+		if err := config.WriteWithOptions(io.Discard, opts); !errors.Is(err, ErrInvalidWriteOptions) {
+			t.Errorf("Expected ErrInvalidWriteOptions for %+v, got %v", opts, err)
+		}
+	}
+}
+
+// TestInputEncoding tests BOM handling, UTF-8 decoding and rejection of other encodings.
+func TestInputEncoding(t *testing.T) {
+	config, err := ParseString("\uFEFFname = \"café ☕\"; größe = 3;")
+	if err != nil {
+		t.Fatalf("Failed to parse config with a UTF-8 BOM: %v", err)
+	}
+
+	if name, err := config.LookupString("name"); err != nil || name != "café ☕" {
+		t.Errorf("Expected name to be %q, got %q (%v)", "café ☕", name, err)
+	}
+
+	if size, err := config.LookupInt("größe"); err != nil || size != 3 {
+		t.Errorf("Expected größe to be 3, got %d (%v)", size, err)
+	}
+
+	// Positions count characters, not bytes
+	if pos := config.Positions()["größe"]; pos.Column != 18 {
+		t.Errorf("Expected größe at column 18, got %s", pos)
+	}
+
+	_, err = ParseString("name = \"ok\";\nbad = \"\xC3\x28\";")
+	if !errors.Is(err, ErrInvalidEncoding) || !strings.Contains(err.Error(), "line 2, column 8") {
+		t.Errorf("Expected ErrInvalidEncoding at line 2, column 8, got %v", err)
+	}
+
+	for _, bom := range []string{"\xFF\xFE", "\xFE\xFF"} {
+		utf16 := bom + "n\x00a\x00m\x00e\x00"
+
+		_, err := ParseString(utf16)
+		if !errors.Is(err, ErrInvalidEncoding) || !strings.Contains(err.Error(), "UTF-16") {
+			t.Errorf("Expected a UTF-16 ErrInvalidEncoding for BOM % X, got %v", bom, err)
+		}
+	}
+
+	if _, err := Tokenize("a = \xFF;"); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("Expected Tokenize to report ErrInvalidEncoding, got %v", err)
+	}
+}
+
+// TestLint tests that Lint reports several distinct problems in one pass.
+func TestLint(t *testing.T) {
+	tempDir := t.TempDir()
+	mainFile := filepath.Join(tempDir, "main.cfg")
+	content := `name = "app";
+port = ;
+name = "other";
+server = {
+    host = "localhost"
+    timeout 30;
+    retries = 3;
+};
+@include "missing.cfg"
+@include "extra.cfg"
+deep = ` + strings.Repeat("( ", 70) + strings.Repeat(" )", 70) + `;
+last = true;
+`
+	extra := `ok = 1;
+bad = [ 1, "two" ];
+`
+
+	if err := os.WriteFile(mainFile, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "extra.cfg"), []byte(extra), 0o644); err != nil {
+		t.Fatalf("Failed to write include: %v", err)
+	}
+
+	diagnostics := Lint(mainFile)
+
+	expected := []struct {
+		err      error
+		file     string
+		line     int
+		severity Severity
+	}{
+		{ErrUnexpectedToken, "main.cfg", 2, SeverityError},
+		{ErrDuplicateKey, "main.cfg", 3, SeverityWarning},
+		{ErrExpectedAssignment, "main.cfg", 6, SeverityError},
+		{ErrMaxDepthExceeded, "main.cfg", 11, SeverityError},
+		{ErrIncludeFileNotFound, "main.cfg", 9, SeverityError},
+		{ErrArrayTypeMismatch, "extra.cfg", 2, SeverityError},
+	}
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %v", len(expected), len(diagnostics), diagnostics)
+	}
+
+	for i, want := range expected {
+		got := diagnostics[i]
+		if !errors.Is(got.Err, want.err) || filepath.Base(got.Pos.File) != want.file ||
+			got.Pos.Line != want.line || got.Severity != want.severity {
+			t.Errorf("Diagnostic %d: expected %v in %s line %d (%s), got %s", i, want.err, want.file, want.line, want.severity, got)
+		}
+	}
+
+	clean := filepath.Join(tempDir, "clean.cfg")
+	if err := os.WriteFile(clean, []byte(`a = 1; b = { c = [ 1, 2 ]; };`), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if diagnostics := Lint(clean); diagnostics != nil {
+		t.Errorf("Expected no diagnostics for a clean file, got %v", diagnostics)
+	}
+}
+
+// TestLookupStringTrimmed tests trimming accidental padding without changing the stored value.
+func TestLookupStringTrimmed(t *testing.T) {
+	config, err := ParseString(`
+		name = " MyApp ";
+		path = "\t/var/lib/app\n";
+		port = 8080;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if name, err := config.LookupStringTrimmed("name"); err != nil || name != "MyApp" {
+		t.Errorf("Expected MyApp, got %q (%v)", name, err)
+	}
+
+	if path, err := config.LookupStringTrimmed("path"); err != nil || path != "/var/lib/app" {
+		t.Errorf("Expected /var/lib/app, got %q (%v)", path, err)
+	}
+
+	if name, _ := config.LookupString("name"); name != " MyApp " {
+		t.Errorf("Expected the stored value to keep its padding, got %q", name)
+	}
+
+	if _, err := config.LookupStringTrimmed("port"); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected ErrNotString, got %v", err)
+	}
+}
+
+// TestLookupIntFromScientific tests reading whole floats in scientific notation as integers.
+func TestLookupIntFromScientific(t *testing.T) {
+	config, err := ParseString(`
+		max = 1e6;
+		big = 9.2e18;
+		plain = 42;
+		long = 5000000000L;
+		half = 1.5e0;
+		huge = 1e19;
+		name = "x";
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	tests := map[string]int64{"max": 1000000, "big": 9200000000000000000, "plain": 42, "long": 5000000000}
+	for path, expected := range tests {
+		if n, err := config.LookupIntFromScientific(path); err != nil || n != expected {
+			t.Errorf("Expected %s to be %d, got %d (%v)", path, expected, n, err)
+		}
+	}
+
+	if _, err := config.LookupIntFromScientific("half"); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("Expected ErrNotInteger for 1.5e0, got %v", err)
+	}
+
+	if _, err := config.LookupIntFromScientific("huge"); !errors.Is(err, ErrIntegerOutOfRange) {
+		t.Errorf("Expected ErrIntegerOutOfRange for 1e19, got %v", err)
+	}
+
+	if _, err := config.LookupIntFromScientific("name"); !errors.Is(err, ErrNotInteger) {
+		t.Errorf("Expected ErrNotInteger for a string, got %v", err)
+	}
+}
+
+// TestDirectiveComments tests header directives that change parsing for a single file.
+func TestDirectiveComments(t *testing.T) {
+	loose := `a = 1
+b = 2;`
+
+	if _, err := ParseString(loose); err != nil {
+		t.Fatalf("Expected optional semicolons by default, got %v", err)
+	}
+
+	_, err := ParseString("# libconfig:strict\n" + loose)
+	if !errors.Is(err, ErrExpectedSemicolon) || !strings.Contains(err.Error(), "'a'") {
+		t.Errorf("Expected ErrExpectedSemicolon after 'a', got %v", err)
+	}
+
+	if _, err := ParseString("// libconfig:strict\na = 1; g = { x = 2 };"); !errors.Is(err, ErrExpectedSemicolon) {
+		t.Errorf("Expected strict mode to apply inside groups, got %v", err)
+	}
+
+	if _, err := ParseStringWithOptions(loose, Options{StrictSemicolons: true}); !errors.Is(err, ErrExpectedSemicolon) {
+		t.Errorf("Expected Options.StrictSemicolons to require semicolons, got %v", err)
+	}
+
+	// Directives after the first setting and unknown directives are ignored
+	if _, err := ParseString("a = 1;\n# libconfig:strict\nb = 2\n"); err != nil {
+		t.Errorf("Expected a directive after the header to be ignored, got %v", err)
+	}
+
+	if _, err := ParseString("# libconfig:fancy\n" + loose); err != nil {
+		t.Errorf("Expected an unknown directive to be ignored, got %v", err)
+	}
+
+	// Directives are scoped to their own file
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "inc.cfg"), []byte("x = 1\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write include: %v", err)
+	}
+
+	config, err := ParseStringWithOptions("# libconfig:strict\n@include \"inc.cfg\"\ny = 2;", Options{BaseDir: tempDir})
+	if err != nil {
+		t.Fatalf("Expected the include to be parsed without strict mode, got %v", err)
+	}
+
+	if x, _ := config.LookupInt("x"); x != 1 {
+		t.Errorf("Expected x from the include, got %d", x)
+	}
+
+	_, err = ParseStringWithOptions("/* libconfig:no-includes */\n@include \"inc.cfg\"", Options{BaseDir: tempDir})
+	if !errors.Is(err, ErrIncludesDisabled) {
+		t.Errorf("Expected ErrIncludesDisabled, got %v", err)
+	}
+
+	// Lint warns about unknown directives and reports every missing semicolon
+	lintFile := filepath.Join(tempDir, "lint.cfg")
+	if err := os.WriteFile(lintFile, []byte("# libconfig:strict\n# libconfig:fancy\na = 1\nb = 2\nc = 3;\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	diagnostics := Lint(lintFile)
+	if len(diagnostics) != 3 || !errors.Is(diagnostics[0].Err, ErrUnknownDirective) || diagnostics[0].Severity != SeverityWarning ||
+		!errors.Is(diagnostics[1].Err, ErrExpectedSemicolon) || !errors.Is(diagnostics[2].Err, ErrExpectedSemicolon) {
+		t.Errorf("Expected an unknown directive warning and two semicolon errors, got %v", diagnostics)
+	}
+}
+
+// TestValueSpans tests that tracked spans cover exactly the text of each value.
+func TestValueSpans(t *testing.T) {
+	input := "\uFEFF# header\nname = \"café\";\nserver = {\n    port = 0x1F90;\n    hosts = [ \"a\", \"b\" ];\n};\nmotd = \"hello, \"\n       \"world\";\nratio = -2.5e3;\n"
+
+	config, err := ParseStringWithOptions(input, Options{TrackSpans: true})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	expected := map[string]string{
+		"name":         `"café"`,
+		"server.port":  "0x1F90",
+		"server.hosts": `[ "a", "b" ]`,
+		"server":       "{\n    port = 0x1F90;\n    hosts = [ \"a\", \"b\" ];\n}",
+		"motd":         "\"hello, \"\n       \"world\"",
+		"ratio":        "-2.5e3",
+	}
+
+	for path, text := range expected {
+		start, end, err := config.Span(path)
+		if err != nil {
+			t.Errorf("Failed to get span of %s: %v", path, err)
+			continue
+		}
+
+		if got := input[start:end]; got != text {
+			t.Errorf("Expected span of %s to be %q, got %q", path, text, got)
+		}
+	}
+
+	// Splicing a new literal into the span rewrites just that value
+	start, end, _ := config.Span("server.port")
+	edited, err := ParseString(input[:start] + "9090" + input[end:])
+	if err != nil {
+		t.Fatalf("Failed to parse edited config: %v", err)
+	}
+
+	if port, _ := edited.LookupInt("server.port"); port != 9090 {
+		t.Errorf("Expected edited port 9090, got %d", port)
+	}
+
+	untracked, _ := ParseString(input)
+	if _, _, err := untracked.Span("name"); !errors.Is(err, ErrNoSpan) {
+		t.Errorf("Expected ErrNoSpan without TrackSpans, got %v", err)
+	}
+}
+
+// TestParseBytes tests that ParseBytes matches ParseString and does not alias its input.
+func TestParseBytes(t *testing.T) {
+	inputs := []string{
+		"name = \"app\";\nport = 0x1F90;\nhosts = [ \"a\", \"b\" ];\nserver = { debug = true; };",
+		"\uFEFFname = \"café\";",
+		"",
+		"name = ;",
+		"bad = \"\xFF\";",
+	}
+
+	for _, input := range inputs {
+		want, wantErr := ParseString(input)
+		got, gotErr := ParseBytes([]byte(input))
+
+		if (wantErr == nil) != (gotErr == nil) || (wantErr != nil && wantErr.Error() != gotErr.Error()) {
+			t.Errorf("Expected error %v for %q, got %v", wantErr, input, gotErr)
+			continue
+		}
+
+		if wantErr == nil && !reflect.DeepEqual(want.Root, got.Root) {
+			t.Errorf("Expected %+v for %q, got %+v", want.Root, input, got.Root)
+		}
+	}
+
+	data := []byte(`name = "app";`)
+
+	config, err := ParseBytes(data)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	copy(data, "XXXXXXXXXXXXX")
+
+	if name, _ := config.LookupString("name"); name != "app" {
+		t.Errorf("Expected name to survive reuse of the input buffer, got %q", name)
+	}
+
+	if _, ok := config.Root.GroupVal["name"]; !ok {
+		t.Errorf("Expected key to survive reuse of the input buffer, got %v", config.Root.MemberKeys())
+	}
+}
+
+// TestNullArrayElements tests that nulls are compatible with any array element type.
+func TestNullArrayElements(t *testing.T) {
+	opts := Options{Nulls: true}
+
+	config, err := ParseStringWithOptions(`
+		ports = [ 80, null, 443 ];
+		leading = [ NULL, "a", "b" ];
+		empty = [ null, null ];
+		mixed = ( null, 1, "x" );
+		missing = null;
+	`, opts)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	ports, _ := config.Lookup("ports")
+	if len(ports.ArrayVal) != 3 || ports.ArrayVal[0].Type != TypeInt || ports.ArrayVal[1].Type != TypeNull ||
+		ports.ArrayVal[2].IntVal != 443 {
+		t.Errorf("Expected nullable int array, got %+v", ports.ArrayVal)
+	}
+
+	leading, _ := config.Lookup("leading")
+	if leading.ArrayVal[0].Type != TypeNull || leading.ArrayVal[1].Type != TypeString {
+		t.Errorf("Expected leading null followed by strings, got %+v", leading.ArrayVal)
+	}
+
+	empty, _ := config.Lookup("empty")
+	for i, element := range empty.ArrayVal {
+		if element.Type != TypeNull {
+			t.Errorf("Expected element %d of all-null array to be null, got %s", i, element.Type)
+		}
+	}
+
+	if typ, val, _ := config.LookupTyped("missing"); typ != TypeNull || val != nil {
+		t.Errorf("Expected null setting, got %s %v", typ, val)
+	}
+
+	// The element type is fixed by the first non-null element
+	_, err = ParseStringWithOptions(`bad = [ null, 1, "two" ];`, opts)
+	if !errors.Is(err, ErrArrayTypeMismatch) {
+		t.Errorf("Expected ErrArrayTypeMismatch, got %v", err)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "got int and string") {
+		t.Errorf("Expected mismatch against the first non-null type, got %v", err)
+	}
+
+	// Without the option null is not a value
+	if _, err := ParseString(`ports = [ 80, null ];`); !errors.Is(err, ErrUnexpectedToken) {
+		t.Errorf("Expected ErrUnexpectedToken without Options.Nulls, got %v", err)
+	}
+
+	var buf strings.Builder
+	if err := config.Write(&buf); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	reparsed, err := ParseStringWithOptions(buf.String(), opts)
+	if err != nil {
+		t.Fatalf("Failed to parse written config: %v\n%s", err, buf.String())
+	}
+
+	if reparsed.Hash() != config.Hash() {
+		t.Errorf("Expected written config to round-trip, got:\n%s", buf.String())
+	}
+}
+
+// TestLookupCompiled tests that compiled paths resolve like their string form.
+func TestLookupCompiled(t *testing.T) {
+	config, err := ParseString(`
+		app = { server = { port = 8080; "example.com" = { tls = true; }; }; };
+		name = "svc";
+		list = ( 1, 2 );
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	paths := []string{"app.server.port", `app.server.example\.com.tls`, "name", "", ".name.", "app.missing", "list.x"}
+
+	for _, path := range paths {
+		want, wantErr := config.Lookup(path)
+		got, gotErr := config.LookupCompiled(Compile(path))
+
+		if !errors.Is(gotErr, errors.Unwrap(wantErr)) || (wantErr == nil) != (gotErr == nil) {
+			t.Errorf("Expected error %v for %q, got %v", wantErr, path, gotErr)
+			continue
+		}
+
+		if wantErr == nil && !reflect.DeepEqual(want, got) {
+			t.Errorf("Expected %+v for %q, got %+v", want, path, got)
+		}
+	}
+
+	// A compiled path is reusable across configs
+	path := Compile("app.server.port")
+	other, _ := ParseString(`app = { server = { port = 9090; }; };`)
+
+	if val, err := other.LookupCompiled(path); err != nil || val.IntVal != 9090 {
+		t.Errorf("Expected 9090 from second config, got %v, %v", val, err)
+	}
+
+	if path.String() != "app.server.port" {
+		t.Errorf("Expected path text app.server.port, got %s", path.String())
+	}
+}
+
+// TestUnmarshalPrecisionLoss tests that lossy numeric conversions are reported instead of rounded.
+func TestUnmarshalPrecisionLoss(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		target any
+		lossy  bool
+	}{
+		{"int64 within 53 bits", "v = 9007199254740992L;", &struct{ V float64 }{}, false},
+		{"int64 beyond 53 bits", "v = 9007199254740993L;", &struct{ V float64 }{}, true},
+		{"max int64", "v = 9223372036854775807L;", &struct{ V float64 }{}, true},
+		{"min int64", "v = -9223372036854775808L;", &struct{ V float64 }{}, false},
+		{"int within 24 bits", "v = 16777216;", &struct{ V float32 }{}, false},
+		{"int beyond 24 bits", "v = 16777217;", &struct{ V float32 }{}, true},
+		{"float overflowing float32", "v = 1e300;", &struct{ V float32 }{}, true},
+		{"float rounded into float32", "v = 0.1;", &struct{ V float32 }{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseString(tt.input)
+			if err != nil {
+				t.Fatalf("Failed to parse config: %v", err)
+			}
+
+			err = config.Unmarshal(tt.target)
+			if tt.lossy && !errors.Is(err, ErrPrecisionLoss) {
+				t.Errorf("Expected ErrPrecisionLoss, got %v", err)
+			}
+
+			if !tt.lossy && err != nil {
+				t.Errorf("Expected exact conversion, got %v", err)
+			}
+		})
+	}
+}
+
+// TestExtends tests group inheritance through @extends and _extends keys.
+func TestExtends(t *testing.T) {
+	config, err := ParseStringWithOptions(`
+		web2 = { @extends = "web1"; port = 8081; tls = { cert = "web2.pem"; }; };
+		web1 = { @extends = "base"; host = "web1.local"; port = 8080; tls = { enabled = true; cert = "web1.pem"; }; };
+		base = { timeout = 30; host = "localhost"; };
+		sites = {
+			shared = { root = "/srv"; };
+			blog = { _extends = "sites.shared"; name = "blog"; };
+		};
+	`, Options{Extends: true})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	tests := map[string]any{
+		"web2.port":        8081,
+		"web2.host":        "web1.local",
+		"web2.timeout":     30,
+		"web2.tls.enabled": true,
+		"web2.tls.cert":    "web2.pem",
+		"web1.timeout":     30,
+		"sites.blog.root":  "/srv",
+		"sites.blog.name":  "blog",
+	}
+
+	for path, want := range tests {
+		_, got, err := config.LookupTyped(path)
+		if err != nil {
+			t.Errorf("Failed to look up %s: %v", path, err)
+			continue
+		}
+
+		if got != want {
+			t.Errorf("Expected %s to be %v, got %v", path, want, got)
+		}
+	}
+
+	for _, path := range []string{"web2.@extends", "web1.@extends", "sites.blog._extends"} {
+		if _, err := config.Lookup(path); !errors.Is(err, ErrSettingNotFound) {
+			t.Errorf("Expected %s to be removed, got %v", path, err)
+		}
+	}
+
+	web2, _ := config.Lookup("web2")
+	if keys := web2.MemberKeys(); !reflect.DeepEqual(keys, []string{"timeout", "host", "port", "tls"}) {
+		t.Errorf("Expected inherited keys before own keys, got %v", keys)
+	}
+
+	// Without the option @extends is not a setting name and _extends is kept
+	if _, err := ParseString(`a = { @extends = "b"; }; b = { };`); !errors.Is(err, ErrExpectedIdentifier) {
+		t.Errorf("Expected ErrExpectedIdentifier without Options.Extends, got %v", err)
+	}
+
+	plain, err := ParseString(`a = { _extends = "b"; }; b = { x = 1; };`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if _, err := plain.LookupString("a._extends"); err != nil {
+		t.Errorf("Expected _extends to be an ordinary setting, got %v", err)
+	}
+}
+
+// TestExtendsErrors tests that cyclic and invalid inheritance is rejected.
+func TestExtendsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"self", `a = { @extends = "a"; };`, ErrExtendsCycle},
+		{"cycle", `a = { @extends = "b"; }; b = { @extends = "c"; }; c = { @extends = "a"; };`, ErrExtendsCycle},
+		{"ancestor", `a = { b = { @extends = "a"; }; };`, ErrExtendsCycle},
+		{"not a string", `a = { @extends = 1; };`, ErrInvalidExtends},
+		{"not a group", `a = { @extends = "b"; }; b = 1;`, ErrInvalidExtends},
+		{"missing", `a = { @extends = "b"; };`, ErrSettingNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseStringWithOptions(tt.input, Options{Extends: true})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	config, _ := ParseString(`a = { _extends = "b"; }; b = { };`)
+	config.Freeze()
+
+	if err := config.ResolveExtends(); !errors.Is(err, ErrConfigFrozen) {
+		t.Errorf("Expected ErrConfigFrozen, got %v", err)
+	}
+}
+
+// TestFromStruct tests building a configuration from a tagged struct.
+func TestFromStruct(t *testing.T) {
+	type TLS struct {
+		Enabled bool   `libconfig:"enabled"`
+		Cert    string `libconfig:"cert"`
+	}
+
+	port := 8080
+
+	source := struct {
+		Name     string            `libconfig:"name"`
+		Port     *int              `libconfig:"port"`
+		Big      int64             `libconfig:"big"`
+		Ratio    float64           `libconfig:"ratio"`
+		Hosts    []string          `libconfig:"hosts"`
+		Mixed    []any             `libconfig:"mixed"`
+		Labels   map[string]string `libconfig:"labels"`
+		TLS      TLS               `libconfig:"tls"`
+		Timeout  int               `libconfig:"server.timeout"`
+		Skipped  string            `libconfig:"-"`
+		Nothing  *string           `libconfig:"nothing"`
+		internal string
+	}{
+		Name:     "app",
+		Port:     &port,
+		Big:      1,
+		Ratio:    0.5,
+		Hosts:    []string{"a", "b"},
+		Mixed:    []any{1, "two"},
+		Labels:   map[string]string{"b": "2", "a": "1"},
+		TLS:      TLS{Enabled: true, Cert: "c.pem"},
+		Timeout:  30,
+		Skipped:  "x",
+		internal: "y",
+	}
+
+	config, err := FromStruct(&source)
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := config.WriteWithOptions(&buf, WriteOptions{Indent: "  ", Assign: " = "}); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	expected := `name = "app";
+port = 8080;
+big = 1L;
+ratio = 0.5;
+hosts = [ "a", "b" ];
+mixed = ( 1, "two" );
+labels = {
+  a = "1";
+  b = "2";
+};
+tls = {
+  enabled = true;
+  cert = "c.pem";
+};
+server = {
+  timeout = 30;
+};
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	if _, err := FromStruct(42); !errors.Is(err, ErrInvalidMarshalSource) {
+		t.Errorf("Expected ErrInvalidMarshalSource, got %v", err)
+	}
+
+	if _, err := FromStruct(struct{ C chan int }{}); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("Expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+// TestFromStructOmitEmpty tests that omitempty fields holding zero values are left out.
+func TestFromStructOmitEmpty(t *testing.T) {
+	source := struct {
+		Name    string         `libconfig:"name,omitempty"`
+		Port    int            `libconfig:"port,omitempty"`
+		Debug   bool           `libconfig:"debug,omitempty"`
+		Hosts   []string       `libconfig:"hosts,omitempty"`
+		Labels  map[string]int `libconfig:"labels,omitempty"`
+		Timeout float64        `libconfig:",omitempty"`
+		Retries int            `libconfig:"retries"`
+		Kept    int            `libconfig:"kept,omitempty"`
+	}{Kept: 3}
+
+	config, err := FromStruct(source)
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	if keys := config.Root.MemberKeys(); !reflect.DeepEqual(keys, []string{"retries", "kept"}) {
+		t.Errorf("Expected only retries and kept, got %v", keys)
+	}
+
+	source.Hosts = []string{}
+	source.Timeout = 1.5
+
+	config, err = FromStruct(source)
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	if _, err := config.Lookup("hosts"); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected empty slice to be omitted, got %v", err)
+	}
+
+	if timeout, err := config.LookupFloat("Timeout"); err != nil || timeout != 1.5 {
+		t.Errorf("Expected Timeout 1.5 under the field name, got %v, %v", timeout, err)
+	}
+}
+
+// TestValidate tests that every schema violation is reported.
+func TestValidate(t *testing.T) {
+	config, err := ParseString(`
+		name = "app";
+		port = 70000;
+		ratio = 0.5;
+		debug = "yes";
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	minPort, maxPort := 1.0, 65535.0
+
+	err = config.Validate(Schema{
+		"name":  {Required: true, Types: []ValueType{TypeString}},
+		"port":  {Required: true, Types: []ValueType{TypeInt, TypeInt64}, Min: &minPort, Max: &maxPort},
+		"ratio": {Types: []ValueType{TypeFloat}, Max: &maxPort},
+		"debug": {Types: []ValueType{TypeBool}},
+		"host":  {Required: true},
+		"extra": {Types: []ValueType{TypeInt}},
+	})
+
+	for _, want := range []error{ErrMissingRequired, ErrSchemaType, ErrOutOfRange} {
+		if !errors.Is(err, want) {
+			t.Errorf("Expected %v in %v", want, err)
+		}
+	}
+
+	if err == nil || len(strings.Split(err.Error(), "\n")) != 3 {
+		t.Errorf("Expected 3 violations, got %v", err)
+	}
+
+	if err := config.Validate(Schema{"name": {Required: true}}); err != nil {
+		t.Errorf("Expected no violations, got %v", err)
+	}
+}
+
+// TestDecode tests that Decode reports all schema violations in one error before unmarshaling.
+func TestDecode(t *testing.T) {
+	config, err := ParseString(`
+		port = "8080";
+		name = "app";
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	var app struct {
+		Host string `libconfig:"host"`
+		Port int    `libconfig:"port"`
+		Name string `libconfig:"name"`
+	}
+
+	schema := Schema{
+		"host": {Required: true, Types: []ValueType{TypeString}},
+		"port": {Required: true, Types: []ValueType{TypeInt}},
+	}
+
+	err = config.Decode(&app, schema)
+	if !errors.Is(err, ErrMissingRequired) || !errors.Is(err, ErrSchemaType) {
+		t.Errorf("Expected missing host and mistyped port in one error, got %v", err)
+	}
+
+	if app.Name != "" {
+		t.Errorf("Expected struct to be untouched after violations, got %+v", app)
+	}
+
+	config, _ = ParseString(`host = "db"; port = 5432; name = "app";`)
+	if err := config.Decode(&app, schema); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+
+	if app.Host != "db" || app.Port != 5432 || app.Name != "app" {
+		t.Errorf("Unexpected decode result: %+v", app)
+	}
+}
+
+// TestParseValue tests parsing a single value and the handling of text after it.
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Value
+	}{
+		{"42", NewIntValue(42)},
+		{"42;", NewIntValue(42)},
+		{"  42 ;\n", NewIntValue(42)},
+		{`"a" "b"`, NewStringValue("ab")},
+		{"[ 1, 2 ]", NewArrayValue([]Value{NewIntValue(1), NewIntValue(2)})},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseValue(tt.input)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", tt.input, err)
+			continue
+		}
+
+		if got.Type != tt.want.Type || got.IntVal != tt.want.IntVal || got.StrVal != tt.want.StrVal ||
+			len(got.ArrayVal) != len(tt.want.ArrayVal) {
+			t.Errorf("Expected %+v for %q, got %+v", tt.want, tt.input, got)
+		}
+	}
+
+	group, err := ParseValue("{ a = 1; b = \"x\"; }")
+	if err != nil || group.Type != TypeGroup || len(group.GroupVal) != 2 {
+		t.Errorf("Expected a group with two members, got %+v, %v", group, err)
+	}
+
+	errorTests := []struct {
+		input string
+		want  error
+		text  string
+	}{
+		{"42 foo", ErrTrailingData, "column 4"},
+		{"42;;", ErrTrailingData, "column 4"},
+		{"42; 43", ErrTrailingData, "column 5"},
+		{"", ErrUnexpectedToken, ""},
+		{";", ErrUnexpectedToken, ""},
+	}
+
+	for _, tt := range errorTests {
+		_, err := ParseValue(tt.input)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Expected %v for %q, got %v", tt.want, tt.input, err)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), tt.text) {
+			t.Errorf("Expected error for %q to contain %q, got %v", tt.input, tt.text, err)
+		}
+	}
+}
+
+// TestAdjacentStringsInSequences tests that adjacent strings in arrays and lists form one element.
+func TestAdjacentStringsInSequences(t *testing.T) {
+	config, err := ParseString(`
+		array = [ "a" "b", "c" ];
+		list = ( "x" "y" "z", 1, "w" );
+		multiline = [
+			"first "   // comment between parts
+			"line",
+			"second"
+		];
+		trailing = [ "p" "q", ];
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	tests := map[string][]any{
+		"array":     {"ab", "c"},
+		"list":      {"xyz", 1, "w"},
+		"multiline": {"first line", "second"},
+		"trailing":  {"pq"},
+	}
+
+	for path, want := range tests {
+		_, got, err := config.LookupTyped(path)
+		if err != nil {
+			t.Errorf("Failed to look up %s: %v", path, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %s to be %v, got %v", path, want, got)
+		}
+	}
+
+	// Without a comma adjacent elements other than strings are still an error
+	if _, err := ParseString(`bad = [ "a" 1 ];`); !errors.Is(err, ErrExpectedToken) {
+		t.Errorf("Expected ErrExpectedToken for a missing comma, got %v", err)
+	}
+}
+
+// TestLookupFirst tests falling back through a chain of paths.
+func TestLookupFirst(t *testing.T) {
+	config, err := ParseString(`
+		legacy_port = 8080;
+		server = { host = "localhost"; };
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	val, err := config.LookupFirst("server.port", "legacy_port")
+	if err != nil || val.IntVal != 8080 {
+		t.Errorf("Expected fallback to legacy_port 8080, got %v, %v", val, err)
+	}
+
+	val, err = config.LookupFirst("server.host", "legacy_host")
+	if err != nil || val.StrVal != "localhost" {
+		t.Errorf("Expected first path to win, got %v, %v", val, err)
+	}
+
+	_, err = config.LookupFirst("server.host.name", "port", "server.port")
+	if !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound when no path resolves, got %v", err)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "'server.host.name', 'port', 'server.port'") {
+		t.Errorf("Expected error to list the paths tried, got %v", err)
+	}
+
+	if _, err := config.LookupFirst(); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound for no paths, got %v", err)
+	}
+}
+
+// TestMergeMap tests merging generic Go data into a configuration.
+func TestMergeMap(t *testing.T) {
+	config, err := ParseString(`
+		name = "app";
+		server = { host = "localhost"; port = 8080; };
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	err = config.MergeMap(map[string]any{
+		"server": map[string]any{
+			"port": 9090,
+			"tls":  map[string]any{"enabled": true},
+		},
+		"hosts":   []any{"a", "b"},
+		"mixed":   []any{1, "x"},
+		"ratio":   0.5,
+		"big":     int64(1) << 40,
+		"nothing": nil,
+	})
+	if err != nil {
+		t.Fatalf("Failed to merge map: %v", err)
+	}
+
+	expected := map[string]any{
+		"name": "app",
+		"server": map[string]any{
+			"host": "localhost",
+			"port": 9090,
+			"tls":  map[string]any{"enabled": true},
+		},
+		"hosts": []any{"a", "b"},
+		"mixed": []any{1, "x"},
+		"ratio": 0.5,
+		"big":   int64(1) << 40,
+	}
+
+	if got := config.ToMap(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	hosts, _ := config.Lookup("hosts")
+	mixed, _ := config.Lookup("mixed")
+
+	if hosts.Type != TypeArray || mixed.Type != TypeList {
+		t.Errorf("Expected hosts array and mixed list, got %s and %s", hosts.Type, mixed.Type)
+	}
+
+	err = config.MergeMap(map[string]any{"server": map[string]any{"handler": func() {}}})
+	if !errors.Is(err, ErrUnsupportedType) || !strings.Contains(err.Error(), "server.handler") {
+		t.Errorf("Expected ErrUnsupportedType naming server.handler, got %v", err)
+	}
+
+	config.Freeze()
+
+	if err := config.MergeMap(map[string]any{"x": 1}); !errors.Is(err, ErrConfigFrozen) {
+		t.Errorf("Expected ErrConfigFrozen, got %v", err)
+	}
+}
+
+// TestValueAt tests positional access to array and list elements.
+func TestValueAt(t *testing.T) {
+	config, err := ParseString(`
+		coord = ( 1.5, 2.5, "label" );
+		ports = [ 80, 443 ];
+		name = "app";
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	coord, _ := config.Lookup("coord")
+
+	x, err := coord.At(0)
+	if err != nil || x.FloatVal != 1.5 {
+		t.Errorf("Expected coord[0] to be 1.5, got %v, %v", x, err)
+	}
+
+	label, err := coord.At(2)
+	if err != nil || label.StrVal != "label" {
+		t.Errorf("Expected coord[2] to be label, got %v, %v", label, err)
+	}
+
+	port, err := config.LookupListElem("ports", 1)
+	if err != nil || port.IntVal != 443 {
+		t.Errorf("Expected ports[1] to be 443, got %v, %v", port, err)
+	}
+
+	for _, i := range []int{-1, 3} {
+		if _, err := coord.At(i); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("Expected ErrIndexOutOfRange for index %d, got %v", i, err)
+		}
+	}
+
+	if _, err := config.LookupListElem("ports", 2); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("Expected ErrIndexOutOfRange, got %v", err)
+	}
+
+	if _, err := config.LookupListElem("name", 0); !errors.Is(err, ErrNotSequence) {
+		t.Errorf("Expected ErrNotSequence, got %v", err)
+	}
+
+	if _, err := config.LookupListElem("missing", 0); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound, got %v", err)
+	}
+}
+
+// TestExportFormats tests the YAML and TOML exports of a small config.
+func TestExportFormats(t *testing.T) {
+	config, err := ParseString(`
+		name = "app \"one\"";
+		port = 0x1F90;
+		big = 9007199254740993L;
+		ratio = 1e3;
+		hosts = [ "a", "b" ];
+		mixed = ( 1, "x", { k = true; } );
+		server = {
+			host = "localhost";
+			tls = { enabled = true; };
+		};
+		"my key" = 1;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	data, err := config.MarshalYAML()
+	if err != nil {
+		t.Fatalf("Failed to marshal YAML: %v", err)
+	}
+
+	expectedMap := map[string]any{
+		"name":   `app "one"`,
+		"port":   8080,
+		"big":    int64(9007199254740993),
+		"ratio":  1000.0,
+		"hosts":  []any{"a", "b"},
+		"mixed":  []any{1, "x", map[string]any{"k": true}},
+		"server": map[string]any{"host": "localhost", "tls": map[string]any{"enabled": true}},
+		"my key": 1,
+	}
+
+	if !reflect.DeepEqual(data, expectedMap) {
+		t.Errorf("Expected YAML data %v, got %v", expectedMap, data)
+	}
+
+	toml, err := config.ToTOML()
+	if err != nil {
+		t.Fatalf("Failed to convert to TOML: %v", err)
+	}
+
+	expected := `name = "app \"one\""
+port = 8080
+big = 9007199254740993
+ratio = 1000.0
+hosts = ["a", "b"]
+mixed = [1, "x", { k = true }]
+"my key" = 1
+
+[server]
+host = "localhost"
+
+[server.tls]
+enabled = true
+`
+	if string(toml) != expected {
+		t.Errorf("Expected TOML:\n%s\ngot:\n%s", expected, toml)
+	}
+
+	nulls, _ := ParseStringWithOptions(`a = null;`, Options{Nulls: true})
+	if _, err := nulls.ToTOML(); !errors.Is(err, ErrNotRepresentable) {
+		t.Errorf("Expected ErrNotRepresentable for null, got %v", err)
+	}
+}
+
+// TestLookupDurationsAndSizes tests duration and byte size lookups, singly and in sequences.
+func TestLookupDurationsAndSizes(t *testing.T) {
+	config, err := ParseString(`
+		timeout = "1m30s";
+		windows = [ "1s", "1m", "1h" ];
+		bad_windows = ( "1s", "soon", "1h" );
+		buffer = "64KiB";
+		limits = [ "512", "64KB", "64K", "1.5GB", "2TiB", "10 mb" ];
+		raw = 4096;
+		bad_sizes = [ "1MB", "12XB" ];
+		name = "app";
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if d, err := config.LookupDuration("timeout"); err != nil || d != 90*time.Second {
+		t.Errorf("Expected 1m30s, got %v, %v", d, err)
+	}
+
+	windows, err := config.LookupDurationSlice("windows")
+	if err != nil || !reflect.DeepEqual(windows, []time.Duration{time.Second, time.Minute, time.Hour}) {
+		t.Errorf("Expected [1s 1m 1h], got %v, %v", windows, err)
+	}
+
+	_, err = config.LookupDurationSlice("bad_windows")
+	if !errors.Is(err, ErrInvalidDuration) || !strings.Contains(err.Error(), "element 1 of 'bad_windows'") {
+		t.Errorf("Expected ErrInvalidDuration at element 1, got %v", err)
+	}
+
+	if n, err := config.LookupBytes("buffer"); err != nil || n != 65536 {
+		t.Errorf("Expected 65536 bytes, got %d, %v", n, err)
+	}
+
+	if n, err := config.LookupBytes("raw"); err != nil || n != 4096 {
+		t.Errorf("Expected 4096 bytes, got %d, %v", n, err)
+	}
+
+	limits, err := config.LookupBytesSlice("limits")
+	if err != nil || !reflect.DeepEqual(limits, []int64{512, 64000, 65536, 1500000000, 2 << 40, 10000000}) {
+		t.Errorf("Unexpected sizes %v, %v", limits, err)
+	}
+
+	_, err = config.LookupBytesSlice("bad_sizes")
+	if !errors.Is(err, ErrInvalidSize) || !strings.Contains(err.Error(), "element 1 of 'bad_sizes'") {
+		t.Errorf("Expected ErrInvalidSize at element 1, got %v", err)
+	}
+
+	if _, err := config.LookupDurationSlice("name"); !errors.Is(err, ErrNotSequence) {
+		t.Errorf("Expected ErrNotSequence, got %v", err)
+	}
+
+	if _, err := config.LookupDuration("raw"); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected ErrNotString, got %v", err)
+	}
+}
+
+// TestKeywordHook tests registering a custom keyword set through Options.Keywords.
+func TestKeywordHook(t *testing.T) {
+	keywords := KeywordMap{
+		"yes":      {Type: TokenBoolean, Bool: true},
+		"no":       {Type: TokenBoolean},
+		"on":       {Type: TokenBoolean, Bool: true},
+		"off":      {Type: TokenBoolean},
+		"nein":     {Type: TokenBoolean},
+		"disabled": {Type: TokenBoolean},
+		"none":     {Type: TokenNull},
+	}
+
+	config, err := ParseStringWithOptions(`
+		a = yes; b = No; c = ON; d = off;
+		e = TRUE; f = false;
+		g = none;
+		h = [ 1, None, 3 ];
+		i = nein; j = disabled;
+	`, Options{Keywords: keywords.Classify})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	expected := map[string]bool{"a": true, "b": false, "c": true, "d": false, "e": true, "f": false, "i": false, "j": false}
+	for path, want := range expected {
+		if got, err := config.LookupBool(path); err != nil || got != want {
+			t.Errorf("Expected %s to be %t, got %t, %v", path, want, got, err)
+		}
+	}
+
+	if typ, _, _ := config.LookupTyped("g"); typ != TypeNull {
+		t.Errorf("Expected none to be null, got %s", typ)
+	}
+
+	if elem, err := config.LookupListElem("h", 1); err != nil || elem.Type != TypeNull {
+		t.Errorf("Expected None array element to be null, got %v, %v", elem, err)
+	}
+
+	// The hook can also take a built-in keyword back
+	tokens, err := Tokenize(`true`)
+	if err != nil || tokens[0].Type != TokenBoolean {
+		t.Fatalf("Expected true to be a boolean by default, got %v, %v", tokens, err)
+	}
+
+	plain := func(ident string) (Keyword, bool) { return Keyword{Type: TokenIdentifier}, ident == "true" }
+
+	if _, err := ParseStringWithOptions(`a = true;`, Options{Keywords: plain}); !errors.Is(err, ErrUnexpectedToken) {
+		t.Errorf("Expected true to be an identifier through the hook, got %v", err)
+	}
+
+	// Without the hook these are ordinary identifiers
+	if _, err := ParseString(`a = yes;`); !errors.Is(err, ErrUnexpectedToken) {
+		t.Errorf("Expected ErrUnexpectedToken without a keyword hook, got %v", err)
+	}
+}
+
+// TestNestedSlices tests decoding arrays of arrays into nested slices.
+func TestNestedSlices(t *testing.T) {
+	config, err := ParseString(`
+		grid = [ [ 1, 2, 3 ], [ 4, 5, 6 ] ];
+		ragged = ( [ 1 ], [ ], [ 2, 3 ] );
+		bad = ( [ 1, 2, 3 ], ( 4, 5, "six" ) );
+		flat = [ 1, 2 ];
+		names = [ "a", "b" ];
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	grid, err := config.LookupIntMatrix("grid")
+	if err != nil || !reflect.DeepEqual(grid, [][]int{{1, 2, 3}, {4, 5, 6}}) {
+		t.Errorf("Expected 2x3 grid, got %v, %v", grid, err)
+	}
+
+	ragged, err := config.LookupIntMatrix("ragged")
+	if err != nil || !reflect.DeepEqual(ragged, [][]int{{1}, {}, {2, 3}}) {
+		t.Errorf("Expected ragged rows, got %v, %v", ragged, err)
+	}
+
+	_, err = config.LookupIntMatrix("bad")
+	if !errors.Is(err, ErrNotInteger) || !strings.Contains(err.Error(), "'bad[1][2]'") {
+		t.Errorf("Expected ErrNotInteger at bad[1][2], got %v", err)
+	}
+
+	_, err = config.LookupIntMatrix("flat")
+	if !errors.Is(err, ErrNotSequence) || !strings.Contains(err.Error(), "'flat[0]'") {
+		t.Errorf("Expected ErrNotSequence at flat[0], got %v", err)
+	}
+
+	var target struct {
+		Grid  [][]int64 `libconfig:"grid"`
+		Names []string  `libconfig:"names"`
+	}
+
+	if err := config.Unmarshal(&target); err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+
+	if !reflect.DeepEqual(target.Grid, [][]int64{{1, 2, 3}, {4, 5, 6}}) || !reflect.DeepEqual(target.Names, []string{"a", "b"}) {
+		t.Errorf("Unexpected unmarshal result: %+v", target)
+	}
+}
+
+// TestLookupSlice tests telling absent collections from empty ones.
+func TestLookupSlice(t *testing.T) {
+	config, err := ParseString(`
+		empty = [ ];
+		empty_list = ( );
+		hosts = [ "a", "b" ];
+		name = "app";
+		server = { };
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	// Lookup itself distinguishes the two cases
+	if _, err := config.Lookup("missing"); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound for an absent key, got %v", err)
+	}
+
+	if val, err := config.Lookup("empty"); err != nil || val.Type != TypeArray || len(val.ArrayVal) != 0 {
+		t.Errorf("Expected an empty array, got %v, %v", val, err)
+	}
+
+	for _, path := range []string{"empty", "empty_list"} {
+		elements, present, err := config.LookupSlice(path)
+		if err != nil || !present || elements == nil || len(elements) != 0 {
+			t.Errorf("Expected %s to be present and empty, got %v, %t, %v", path, elements, present, err)
+		}
+	}
+
+	for _, path := range []string{"missing", "server.missing"} {
+		elements, present, err := config.LookupSlice(path)
+		if err != nil || present || elements != nil {
+			t.Errorf("Expected %s to be absent, got %v, %t, %v", path, elements, present, err)
+		}
+	}
+
+	if elements, present, err := config.LookupSlice("hosts"); err != nil || !present || len(elements) != 2 {
+		t.Errorf("Expected two hosts, got %v, %t, %v", elements, present, err)
+	}
+
+	if _, present, err := config.LookupSlice("name"); !present || !errors.Is(err, ErrNotSequence) {
+		t.Errorf("Expected ErrNotSequence for a present string, got %t, %v", present, err)
+	}
+
+	if _, _, err := config.LookupSlice("name.x"); !errors.Is(err, ErrCannotLookupInNonGroup) {
+		t.Errorf("Expected ErrCannotLookupInNonGroup, got %v", err)
+	}
+}
+
+// failingWriter accepts limit bytes and then fails.
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		n := w.limit
+		w.limit = 0
+
+		return n, io.ErrShortWrite
+	}
+
+	w.limit -= len(p)
+
+	return len(p), nil
+}
+
+// TestWriteStreaming tests that Write streams its output and reports write failures.
+func TestWriteStreaming(t *testing.T) {
+	elements := make([]Value, 10_000)
+	for i := range elements {
+		elements[i] = NewIntValue(i)
+	}
+
+	config := NewConfig()
+	config.Root.setMember("large", NewArrayValue(elements))
+	config.Root.setMember("name", NewStringValue("app"))
+
+	var buf strings.Builder
+
+	n, err := config.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected WriteTo to report %d bytes, got %d", buf.Len(), n)
+	}
+
+	reparsed, err := ParseString(buf.String())
+	if err != nil {
+		t.Fatalf("Failed to parse written config: %v", err)
+	}
+
+	if last, err := reparsed.LookupListElem("large", 9999); err != nil || last.IntVal != 9999 {
+		t.Errorf("Expected last element 9999, got %v, %v", last, err)
+	}
+
+	// Output larger than the buffer reaches the writer before the end
+	err = config.Write(&failingWriter{limit: 100})
+	if !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("Expected io.ErrShortWrite, got %v", err)
+	}
+}
+
+// TestLookupTypeMismatch tests that typed lookups of collections name the type found.
+func TestLookupTypeMismatch(t *testing.T) {
+	config, err := ParseString(`
+		database = { host = "localhost"; };
+		ports = [ 80, 443 ];
+		servers = ( "a", "b" );
+		name = "app";
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	lookups := []struct {
+		name     string
+		want     string
+		sentinel error
+		lookup   func(path string) error
+	}{
+		{"LookupInt", "an integer", ErrNotInteger, func(path string) error {
+			_, err := config.LookupInt(path)
+			return err
+		}},
+		{"LookupInt64", "an integer", ErrNotInteger, func(path string) error {
+			_, err := config.LookupInt64(path)
+			return err
+		}},
+		{"LookupIntFromScientific", "an integer", ErrNotInteger, func(path string) error {
+			_, err := config.LookupIntFromScientific(path)
+			return err
+		}},
+		{"LookupFloat", "a float", ErrNotFloat, func(path string) error {
+			_, err := config.LookupFloat(path)
+			return err
+		}},
+		{"LookupBool", "a boolean", ErrNotBoolean, func(path string) error {
+			_, err := config.LookupBool(path)
+			return err
+		}},
+		{"LookupString", "a string", ErrNotString, func(path string) error {
+			_, err := config.LookupString(path)
+			return err
+		}},
+	}
+
+	found := map[string]string{
+		"database": "a group",
+		"ports":    "an array",
+		"servers":  "a list",
+	}
+
+	for _, l := range lookups {
+		for path, got := range found {
+			err := l.lookup(path)
+			if !errors.Is(err, l.sentinel) {
+				t.Errorf("%s(%q): expected %v, got %v", l.name, path, l.sentinel, err)
+				continue
+			}
+
+			want := fmt.Sprintf("value at '%s' is %s, not %s", path, got, l.want)
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s(%q): expected error containing %q, got %q", l.name, path, want, err)
+			}
+		}
+	}
+
+	// Scalars of the wrong type are named too
+	_, err = config.LookupInt("name")
+	if err == nil || !strings.Contains(err.Error(), "is a string, not an integer") {
+		t.Errorf("Expected string/integer mismatch, got %v", err)
+	}
+}
+
+// TestIncludeInSequences tests that includes inside arrays and lists splice in the included elements.
+func TestIncludeInSequences(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"more_plugins.cfg": `"c", "d",`,
+		"bracketed.cfg":    `[ "e", "f" ]`,
+		"nested.cfg":       `"x", @include "bracketed.cfg"`,
+		"servers.cfg":      `{ host = "b"; }, 42`,
+		"numbers.cfg":      `1, 2`,
+		"mixed.cfg":        `3, "four"`,
+		"main.cfg": `
+			plugins = [ "a", @include "more_plugins.cfg", "b" ];
+			wrapped = [ @include "bracketed.cfg" ];
+			nested = [ @include "nested.cfg" ];
+			servers = ( { host = "a"; }, @include "servers.cfg" );
+			names = [ "a", @include "numbers.cfg" ];
+		`,
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	_, err := ParseFile(filepath.Join(tempDir, "main.cfg"))
+	if !errors.Is(err, ErrArrayTypeMismatch) {
+		t.Fatalf("Expected ErrArrayTypeMismatch for spliced integers, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "numbers.cfg:1:1") {
+		t.Errorf("Expected the mismatch to point into numbers.cfg, got %v", err)
+	}
+
+	main := strings.Replace(files["main.cfg"], `names = [ "a", @include "numbers.cfg" ];`, "", 1)
+	if err := os.WriteFile(filepath.Join(tempDir, "main.cfg"), []byte(main), 0o644); err != nil {
+		t.Fatalf("Failed to write main.cfg: %v", err)
+	}
+
+	config, err := ParseFile(filepath.Join(tempDir, "main.cfg"))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	expected := map[string][]string{
+		"plugins": {"a", "c", "d", "b"},
+		"wrapped": {"e", "f"},
+		"nested":  {"x", "e", "f"},
+	}
+
+	for path, want := range expected {
+		elements, _, err := config.LookupSlice(path)
+
+		var got []string
+		for _, element := range elements {
+			got = append(got, element.StrVal)
+		}
+
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %s = %v, got %v, %v", path, want, got, err)
+		}
+	}
+
+	servers, _ := config.Lookup("servers")
+	if servers.Type != TypeList || len(servers.ListVal) != 3 {
+		t.Fatalf("Expected a list of 3 servers, got %v", servers)
+	}
+
+	if servers.ListVal[1].GroupVal["host"].StrVal != "b" || servers.ListVal[2].IntVal != 42 {
+		t.Errorf("Expected spliced group and integer, got %v", servers.ListVal)
+	}
+
+	// Lint checks included element files as elements rather than settings
+	if diagnostics := Lint(filepath.Join(tempDir, "main.cfg")); diagnostics != nil {
+		t.Errorf("Expected no diagnostics, got %v", diagnostics)
+	}
+
+	_, err = ParseStringWithOptions(`a = [ 1, @include "x.cfg" ];`, Options{DisableIncludes: true})
+	if !errors.Is(err, ErrIncludesDisabled) {
+		t.Errorf("Expected ErrIncludesDisabled, got %v", err)
+	}
+
+	_, err = ParseStringWithOptions(`a = [ 1, @include "mixed.cfg" ];`, Options{BaseDir: tempDir})
+	if !errors.Is(err, ErrArrayTypeMismatch) {
+		t.Errorf("Expected ErrArrayTypeMismatch, got %v", err)
+	}
+}
+
+// TestUnwrap tests replacing the root with a single named group.
+func TestUnwrap(t *testing.T) {
+	config, err := ParseString(`
+		application: {
+			name = "app";
+			server = { port = 8080; };
+		};
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if err := config.Unwrap("missing"); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound, got %v", err)
+	}
+
+	if err := config.Unwrap("application.name"); !errors.Is(err, ErrNotGroup) {
+		t.Errorf("Expected ErrNotGroup, got %v", err)
+	}
+
+	if err := config.Unwrap("application"); err != nil {
+		t.Fatalf("Failed to unwrap config: %v", err)
+	}
+
+	if name, err := config.LookupString("name"); err != nil || name != "app" {
+		t.Errorf("Expected name = app, got %q, %v", name, err)
+	}
+
+	if port, err := config.LookupInt("server.port"); err != nil || port != 8080 {
+		t.Errorf("Expected server.port = 8080, got %d, %v", port, err)
+	}
+
+	config.Freeze()
+
+	if err := config.Unwrap("server"); !errors.Is(err, ErrConfigFrozen) {
+		t.Errorf("Expected ErrConfigFrozen, got %v", err)
+	}
+}
+
+// TestUnexpectedEOF tests that input ending inside a collection points back to its opening delimiter.
+func TestUnexpectedEOF(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"group", "name = \"app\";\ngroup = {\n  key = \"value\"", "expected '}' to close the group opened at line 2, column 9"},
+		{"group mid-setting", "group = {\n  key =", "expected '}' to close the group opened at line 1, column 9"},
+		{"array", "ports = [ 80,\n  443", "expected ']' to close the array opened at line 1, column 9"},
+		{"array after comma", "ports = [ 80,", "expected ']' to close the array opened at line 1, column 9"},
+		{"list", "a = 1;\nitems = (\n  \"one\",\n  \"two\"", "expected ')' to close the list opened at line 2, column 9"},
+		{"innermost", "outer = {\n  inner = [ 1, 2", "expected ']' to close the array opened at line 2, column 11"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseString(tt.input)
+			if !errors.Is(err, ErrUnexpectedEOF) {
+				t.Fatalf("Expected ErrUnexpectedEOF, got %v", err)
+			}
+
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %q", tt.want, err)
+			}
+
+			if !errors.Is(err, ErrExpectedToken) {
+				t.Errorf("Expected the error to also wrap ErrExpectedToken, got %v", err)
+			}
+		})
+	}
+
+	// Other failures at the end of the input keep their cause
+	_, err := ParseStringWithOptions(`g = { a = 1; @include "nope.cfg"`, Options{BaseDir: t.TempDir()})
+	if !errors.Is(err, ErrIncludeFileNotFound) || errors.Is(err, ErrUnexpectedEOF) {
+		t.Errorf("Expected ErrIncludeFileNotFound, got %v", err)
+	}
+}
+
+// TestValueBytes tests serializing a value to libconfig text and parsing it back.
+func TestValueBytes(t *testing.T) {
+	config, err := ParseString(`
+		plugin = {
+			name = "json \"passthrough\"";
+			payload = "{\"a\": [1, 2]}";
+			limits = { size = 0x400; ratio = 1.5; };
+			tags = [ "a", "b" ];
+			hooks = ( { on = "start"; }, 42L );
+		};
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	plugin, err := config.Lookup("plugin")
+	if err != nil {
+		t.Fatalf("Failed to look up plugin: %v", err)
+	}
+
+	text := plugin.Bytes()
+	if !bytes.HasPrefix(text, []byte("{\n")) {
+		t.Errorf("Expected group text, got %q", text)
+	}
+
+	reparsed, err := ParseValue(string(text))
+	if err != nil {
+		t.Fatalf("Failed to parse value bytes %q: %v", text, err)
+	}
+
+	if again := reparsed.Bytes(); !bytes.Equal(again, text) {
+		t.Errorf("Expected round trip to keep %q, got %q", text, again)
+	}
+
+	if payload := reparsed.GroupVal["payload"].StrVal; payload != `{"a": [1, 2]}` {
+		t.Errorf("Expected payload to survive untouched, got %q", payload)
+	}
+
+	if got := string(NewIntValue(42).Bytes()); got != "42" {
+		t.Errorf("Expected scalar bytes 42, got %q", got)
+	}
+
+	if got := NewFloatValue(math.NaN()).Bytes(); got != nil {
+		t.Errorf("Expected nil for NaN, got %q", got)
+	}
+}
+
+// TestParseTolerant tests that tolerant parsing skips invalid tokens and reports them.
+func TestParseTolerant(t *testing.T) {
+	input := `name = "app";
+$ port = 8080;
+ports = [ 80, @443 ];
+debug = true;
+`
+
+	if _, err := ParseString(input); !errors.Is(err, ErrExpectedIdentifier) {
+		t.Fatalf("Expected ParseString to fail on the stray character, got %v", err)
+	}
+
+	config, diagnostics, err := ParseTolerant(input, Options{})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	expected := []Position{{Line: 2, Column: 1}, {Line: 3, Column: 15}}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %v", len(expected), diagnostics)
+	}
+
+	for i, want := range expected {
+		if !errors.Is(diagnostics[i].Err, ErrInvalidToken) || diagnostics[i].Pos != want {
+			t.Errorf("Diagnostic %d: expected ErrInvalidToken at %s, got %s", i, want, diagnostics[i])
+		}
+	}
+
+	if port, err := config.LookupInt("port"); err != nil || port != 8080 {
+		t.Errorf("Expected port = 8080, got %d, %v", port, err)
+	}
+
+	if debug, err := config.LookupBool("debug"); err != nil || !debug {
+		t.Errorf("Expected debug = true, got %v, %v", debug, err)
+	}
+
+	if ports, _, err := config.LookupSlice("ports"); err != nil || len(ports) != 2 {
+		t.Errorf("Expected 2 ports, got %v, %v", ports, err)
+	}
+
+	// Syntax errors beyond invalid tokens still fail, with the diagnostics so far
+	_, diagnostics, err = ParseTolerant("$ a = ;", Options{})
+	if !errors.Is(err, ErrUnexpectedToken) || len(diagnostics) != 1 {
+		t.Errorf("Expected ErrUnexpectedToken with 1 diagnostic, got %v, %v", err, diagnostics)
+	}
+
+	// The settings parsed before the error are returned with it
+	config, _, err = ParseTolerant("port = 8080; $ name = \"x\"; bad = ;", Options{})
+	if !errors.Is(err, ErrUnexpectedToken) {
+		t.Fatalf("Expected ErrUnexpectedToken, got %v", err)
+	}
+
+	if config == nil {
+		t.Fatalf("Expected the partial config, got nil")
+	}
+
+	if port, err := config.LookupInt("port"); err != nil || port != 8080 {
+		t.Errorf("Expected port = 8080, got %d, %v", port, err)
+	}
+
+	if name, err := config.LookupString("name"); err != nil || name != "x" {
+		t.Errorf("Expected name = \"x\", got %q, %v", name, err)
+	}
+}
+
+// logLevel is a custom type read through LookupTransform.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+)
+
+var errUnknownLevel = errors.New("unknown log level")
+
+// parseLevel converts a string value such as "WARN" into a logLevel.
+func parseLevel(v Value) (logLevel, error) {
+	if v.Type != TypeString {
+		return 0, ErrNotString
+	}
+
+	switch strings.ToLower(strings.TrimSpace(v.StrVal)) {
+	case "debug":
+		return levelDebug, nil
+	case "info":
+		return levelInfo, nil
+	case "warn":
+		return levelWarn, nil
+	default:
+		return 0, fmt.Errorf("%q: %w", v.StrVal, errUnknownLevel)
+	}
+}
+
+// TestLookupTransform tests reading settings into custom types with a transform.
+func TestLookupTransform(t *testing.T) {
+	config, err := ParseString(`
+		log = { level = " WARN "; fallback = "verbose"; file = "/var/log//app/../app.log"; };
+		port = 8080;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	level, err := LookupTransform(config, "log.level", parseLevel)
+	if err != nil || level != levelWarn {
+		t.Errorf("Expected levelWarn, got %v, %v", level, err)
+	}
+
+	_, err = LookupTransform(config, "log.fallback", parseLevel)
+	if !errors.Is(err, errUnknownLevel) || !strings.Contains(err.Error(), "log.fallback") {
+		t.Errorf("Expected errUnknownLevel naming the path, got %v", err)
+	}
+
+	if _, err := LookupTransform(config, "port", parseLevel); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected ErrNotString, got %v", err)
+	}
+
+	if _, err := LookupTransform(config, "log.missing", parseLevel); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound, got %v", err)
+	}
+
+	clean := func(v Value) (string, error) {
+		return filepath.Clean(v.StrVal), nil
+	}
+
+	if file, err := LookupTransform(config, "log.file", clean); err != nil || file != "/var/log/app.log" {
+		t.Errorf("Expected cleaned path, got %q, %v", file, err)
+	}
+}
+
+// TestNegativeArrayElements tests that a leading minus sign does not change an array's element type.
+func TestNegativeArrayElements(t *testing.T) {
+	config, err := ParseString(`
+		negative = [ -1, -2, -3 ];
+		tight = [-1,-2,-3];
+		floats = [ -1.5, -2.0, -1e3 ];
+		mixed = [ -1, 2, -3, 0 ];
+		positive_first = [ 1, -2 ];
+		hex = [ -0x10, 0x10 ];
+		long = [ -1L, 2L ];
+		mixed_floats = [ 0.5, -0.5 ];
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	expected := map[string]struct {
+		elementType ValueType
+		first       string
+	}{
+		"negative":       {TypeInt, "-1"},
+		"tight":          {TypeInt, "-1"},
+		"floats":         {TypeFloat, "-1.5"},
+		"mixed":          {TypeInt, "-1"},
+		"positive_first": {TypeInt, "1"},
+		"hex":            {TypeInt, "-16"},
+		"long":           {TypeInt64, "-1"},
+		"mixed_floats":   {TypeFloat, "0.5"},
+	}
+
+	for path, want := range expected {
+		val, err := config.Lookup(path)
+		if err != nil {
+			t.Errorf("Failed to look up %s: %v", path, err)
+			continue
+		}
+
+		for i, element := range val.ArrayVal {
+			if element.Type != want.elementType {
+				t.Errorf("Expected %s[%d] to be %s, got %s", path, i, want.elementType, element.Type)
+			}
+		}
+
+		if first := fmt.Sprint(val.ArrayVal[0].native()); first != want.first {
+			t.Errorf("Expected %s[0] = %s, got %s", path, want.first, first)
+		}
+	}
+
+	// A sign never turns an integer into a float or back
+	for _, input := range []string{`a = [ -1, -1.5 ];`, `a = [ -1.5, -1 ];`, `a = [ 1, -1.5 ];`} {
+		if _, err := ParseString(input); !errors.Is(err, ErrArrayTypeMismatch) {
+			t.Errorf("Expected ErrArrayTypeMismatch for %s, got %v", input, err)
+		}
+	}
+}
+
+// TestAllowedComments tests restricting the comment styles a file may use.
+func TestAllowedComments(t *testing.T) {
+	input := `# house style
+name = "app";
+/* block */
+port = 8080; // trailing
+`
+
+	if _, err := ParseString(input); err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	_, err := ParseStringWithOptions(input, Options{AllowedComments: CommentHash | CommentBlock})
+	if !errors.Is(err, ErrCommentStyle) {
+		t.Fatalf("Expected ErrCommentStyle, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "'//' comment at line 4, column 14") {
+		t.Errorf("Expected the error to point at the // comment, got %v", err)
+	}
+
+	// The first disallowed comment is reported
+	_, err = ParseStringWithOptions(input, Options{AllowedComments: CommentHash})
+	if err == nil || !strings.Contains(err.Error(), "'/*' comment at line 3, column 1") {
+		t.Errorf("Expected the error to point at the block comment, got %v", err)
+	}
+
+	config, err := ParseStringWithOptions("# only hash comments\nport = 8080; # here too\n", Options{AllowedComments: CommentHash})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if port, err := config.LookupInt("port"); err != nil || port != 8080 {
+		t.Errorf("Expected port = 8080, got %d, %v", port, err)
+	}
+}
+
+// TestLookupQuantity tests normalizing quantities with unit suffixes to a base unit.
+func TestLookupQuantity(t *testing.T) {
+	config, err := ParseString(`
+		resources = {
+			cpu = "500m";
+			cores = "2";
+			memory = "256Mi";
+			disk = "1.5Gi";
+			replicas = 3;
+			bad_unit = "10Xi";
+			bad_number = "1..5Mi";
+			limits = [ 1, 2 ];
+		};
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	cpu := map[string]float64{"m": 0.001, "": 1}
+	memory := map[string]float64{"": 1, "Ki": 1 << 10, "Mi": 1 << 20, "Gi": 1 << 30}
+
+	tests := []struct {
+		path  string
+		units map[string]float64
+		want  float64
+	}{
+		{"resources.cpu", cpu, 0.5},
+		{"resources.cores", cpu, 2},
+		{"resources.memory", memory, 256 << 20},
+		{"resources.disk", memory, 1.5 * (1 << 30)},
+		{"resources.replicas", memory, 3},
+	}
+
+	for _, tt := range tests {
+		got, err := config.LookupQuantity(tt.path, tt.units)
+		if err != nil || got != tt.want {
+			t.Errorf("Expected %s = %v, got %v, %v", tt.path, tt.want, got, err)
+		}
+	}
+
+	_, err = config.LookupQuantity("resources.bad_unit", memory)
+	if !errors.Is(err, ErrUnknownUnit) || !strings.Contains(err.Error(), `"Gi", "Ki", "Mi"`) {
+		t.Errorf("Expected ErrUnknownUnit listing the known units, got %v", err)
+	}
+
+	if _, err := config.LookupQuantity("resources.memory", cpu); !errors.Is(err, ErrUnknownUnit) {
+		t.Errorf("Expected ErrUnknownUnit for a unit from another table, got %v", err)
+	}
+
+	if _, err := config.LookupQuantity("resources.bad_number", memory); !errors.Is(err, ErrInvalidQuantity) {
+		t.Errorf("Expected ErrInvalidQuantity, got %v", err)
+	}
+
+	if _, err := config.LookupQuantity("resources.limits", memory); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected ErrNotString, got %v", err)
+	}
+}
+
+// TestVerifyIncludes tests checking a config's includes against a manifest.
+func TestVerifyIncludes(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"main.cfg":      "@include \"a.cfg\"\n@include \"sub/b\"\nname = \"app\";\n",
+		"a.cfg":         "@include \"sub/b.cfg\"\na = 1;\n",
+		"sub/b.cfg":     "b = 2;\n",
+		"sub/other.cfg": "c = 3;\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	mainFile := filepath.Join(tempDir, "main.cfg")
+
+	included, err := IncludedFiles(mainFile)
+	if err != nil {
+		t.Fatalf("Failed to list includes: %v", err)
+	}
+
+	want := []string{filepath.Join(tempDir, "a.cfg"), filepath.Join(tempDir, "sub", "b.cfg")}
+	if !reflect.DeepEqual(included, want) {
+		t.Errorf("Expected includes %v, got %v", want, included)
+	}
+
+	if err := VerifyIncludes(mainFile, []string{"sub/b.cfg", "a.cfg"}); err != nil {
+		t.Errorf("Expected matching manifest to pass, got %v", err)
+	}
+
+	err = VerifyIncludes(mainFile, []string{"a.cfg", "sub/other.cfg"})
+	if !errors.Is(err, ErrIncludeMismatch) {
+		t.Fatalf("Expected ErrIncludeMismatch, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "unexpected [sub/b.cfg], missing [sub/other.cfg]") {
+		t.Errorf("Expected the mismatch to list both files, got %v", err)
+	}
+
+	if err := VerifyIncludes(filepath.Join(tempDir, "sub", "b.cfg"), nil); err != nil {
+		t.Errorf("Expected a file without includes to match an empty manifest, got %v", err)
+	}
+}
+
+// BaseConfig holds settings shared by several config structs, for embedding tests.
+type BaseConfig struct {
+	Name     string `libconfig:"name"`
+	LogLevel string `libconfig:"log_level"`
+	Version  int    `libconfig:"version"`
+}
+
+// TLSSettings is embedded by pointer in embedding tests.
+type TLSSettings struct {
+	CertFile string `libconfig:"cert_file"`
+}
+
+// limits is an unexported embedded type whose exported fields are still promoted.
+type limits struct {
+	MaxConns int `libconfig:"max_conns"`
+}
+
+// TestUnmarshalEmbedded tests that fields of embedded structs are filled from the enclosing group.
+func TestUnmarshalEmbedded(t *testing.T) {
+	config, err := ParseString(`
+		name = "api";
+		log_level = "debug";
+		version = 3;
+		cert_file = "/etc/tls/cert.pem";
+		max_conns = 100;
+		port = 8080;
+		worker = { name = "worker-1"; log_level = "info"; version = 1; };
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	type Worker struct {
+		BaseConfig
+	}
+
+	type Server struct {
+		BaseConfig
+		*TLSSettings
+		limits
+
+		Version int
+		Port    int    `libconfig:"port"`
+		Worker  Worker `libconfig:"worker"`
+	}
+
+	var server Server
+	if err := config.UnmarshalWithOptions(&server, UnmarshalOptions{DisallowUnknownKeys: true}); err != nil {
+		t.Fatalf("Failed to unmarshal config: %v", err)
+	}
+
+	if server.Name != "api" || server.LogLevel != "debug" || server.Port != 8080 {
+		t.Errorf("Expected promoted fields to be filled, got %+v", server)
+	}
+
+	if server.TLSSettings == nil || server.CertFile != "/etc/tls/cert.pem" {
+		t.Errorf("Expected embedded pointer to be allocated and filled, got %+v", server.TLSSettings)
+	}
+
+	if server.MaxConns != 100 {
+		t.Errorf("Expected max_conns = 100 through an unexported embedded type, got %d", server.MaxConns)
+	}
+
+	if server.Worker.Name != "worker-1" || server.Worker.LogLevel != "info" || server.Worker.Version != 1 {
+		t.Errorf("Expected nested embedded fields to be filled, got %+v", server.Worker)
+	}
+
+	// The outer Version field hides the promoted one
+	if server.Version != 3 || server.BaseConfig.Version != 0 {
+		t.Errorf("Expected only the outer version to be set, got %d and %d", server.Version, server.BaseConfig.Version)
+	}
+
+	// A tagged embedded struct is an ordinary field decoded from its own group
+	type Named struct {
+		BaseConfig `libconfig:"worker"`
+	}
+
+	var named Named
+	if err := config.Unmarshal(&named); err != nil || named.Name != "worker-1" {
+		t.Errorf("Expected tagged embedded struct from the worker group, got %+v, %v", named, err)
+	}
+}
+
+// TestParseLossless tests that the lossless token stream reproduces the input exactly.
+func TestParseLossless(t *testing.T) {
+	input := "\uFEFF# header comment\n" +
+		"name = \"app \\\"quoted\\\"\"; // trailing\n" +
+		"\n" +
+		"server = {\n" +
+		"\t/* block\n\t   comment */ port = 0x1F90;\n" +
+		"\tratio = 1.50;   \n" +
+		"};\n" +
+		"items = ( \"é\", [ -1, 2 ] ) # no newline at end"
+
+	result, err := ParseLossless(input, Options{})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if port, err := result.Config.LookupInt("server.port"); err != nil || port != 8080 {
+		t.Errorf("Expected server.port = 8080, got %d, %v", port, err)
+	}
+
+	var (
+		rebuilt  strings.Builder
+		comments []string
+		end      int
+	)
+
+	for _, token := range result.Tokens {
+		if token.Start != end {
+			t.Fatalf("Expected token %s to start at %d, got %d", token, end, token.Start)
+		}
+
+		rebuilt.WriteString(input[token.Start:token.End])
+		end = token.End
+
+		if token.Type == TokenComment {
+			comments = append(comments, token.Value)
+		}
+	}
+
+	if rebuilt.String() != input {
+		t.Errorf("Expected tokens to rebuild the input\n%q\ngot\n%q", input, rebuilt.String())
+	}
+
+	if last := result.Tokens[len(result.Tokens)-1]; last.Type != TokenEOF {
+		t.Errorf("Expected the stream to end with EOF, got %s", last)
+	}
+
+	expected := []string{"# header comment", "// trailing", "/* block\n\t   comment */", "# no newline at end"}
+	if !reflect.DeepEqual(comments, expected) {
+		t.Errorf("Expected comments %q, got %q", expected, comments)
+	}
+
+	for _, token := range result.Tokens {
+		if token.Type == TokenComment && token.Value == "/* block\n\t   comment */" && (token.Line != 5 || token.Column != 2) {
+			t.Errorf("Expected the block comment at 5:2, got %d:%d", token.Line, token.Column)
+		}
+	}
+}
+
+// TestLookupBoolSliceLenient tests reading booleans written as integers and words.
+func TestLookupBoolSliceLenient(t *testing.T) {
+	config, err := ParseString(`
+		native = [ true, false ];
+		ints = [ 1, 0, 1 ];
+		words = [ "yes", "No", "ON", "off", "true", "0" ];
+		mixed = ( true, 0, "yes" );
+		bad_int = [ 1, 2 ];
+		bad_word = [ "yes", "maybe" ];
+		nested = ( true, [ 1 ] );
+		scalar = true;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	expected := map[string][]bool{
+		"native": {true, false},
+		"ints":   {true, false, true},
+		"words":  {true, false, true, false, true, false},
+		"mixed":  {true, false, true},
+	}
+
+	for path, want := range expected {
+		got, err := config.LookupBoolSliceLenient(path)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %s = %v, got %v, %v", path, want, got, err)
+		}
+	}
+
+	failures := map[string]string{
+		"bad_int":  "element 1 of 'bad_int'",
+		"bad_word": "element 1 of 'bad_word'",
+		"nested":   "element 1 of 'nested'",
+	}
+
+	for path, want := range failures {
+		_, err := config.LookupBoolSliceLenient(path)
+		if !errors.Is(err, ErrNotBoolean) || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected ErrNotBoolean for %s containing %q, got %v", path, want, err)
+		}
+	}
+
+	if _, err := config.LookupBoolSliceLenient("scalar"); !errors.Is(err, ErrNotSequence) {
+		t.Errorf("Expected ErrNotSequence, got %v", err)
+	}
+}
+
+// TestDiff tests comparing configurations setting by setting.
+func TestDiff(t *testing.T) {
+	before, err := ParseString(`
+		name = "app";
+		server = { host = "localhost"; port = 8080; };
+		ports = [ 80, 443 ];
+		tags = [ "a" ];
+		debug = true;
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	after, err := ParseString(`
+		# Reordered and reformatted
+		server = { port = 0x1F91; host = "localhost"; tls = true; };
+		ports = [ 80, 8443 ];
+		tags = [ "a", "b" ];
+		name = "app";
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	var got []string
+	for _, change := range before.Diff(after) {
+		got = append(got, change.String())
+	}
+
+	expected := []string{
+		"debug: removed true",
+		"ports[1]: 443 -> 8443",
+		"server.port: 8080 -> 0x1F91",
+		"server.tls: added true",
+		"tags: array of 1 -> array of 2",
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected changes %q, got %q", expected, got)
+	}
+
+	if before.Equal(after) || !before.Equal(before) {
+		t.Error("Expected a config to equal only itself")
+	}
+
+	reordered, err := ParseString(`debug = true; tags = [ "a" ]; ports = [ 0x50, 443 ]; server = { port = 8080; host = "localhost"; }; name = "app";`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if !before.Equal(reordered) {
+		t.Errorf("Expected declaration order and notation to be ignored, got %v", before.Diff(reordered))
+	}
+}
+
+// TestDiffFloatEpsilon tests treating nearly equal floats as equal.
+func TestDiffFloatEpsilon(t *testing.T) {
+	before := NewConfig()
+	before.Root.setMember("ratio", NewFloatValue(0.3))
+
+	after := NewConfig()
+	after.Root.setMember("ratio", NewFloatValue(0.3+1e-12))
+
+	if before.Equal(after) {
+		t.Error("Expected exact comparison to see the difference")
+	}
+
+	if changes := before.Diff(after); len(changes) != 1 || changes[0].Path != "ratio" {
+		t.Errorf("Expected one change at ratio, got %v", changes)
+	}
+
+	opts := EqualOptions{FloatEpsilon: 1e-9}
+
+	if !before.EqualWithOptions(after, opts) {
+		t.Error("Expected floats within epsilon to be equal")
+	}
+
+	if changes := before.DiffWithOptions(after, opts); changes != nil {
+		t.Errorf("Expected no changes within epsilon, got %v", changes)
+	}
+
+	after.Root.setMember("ratio", NewFloatValue(0.3+1e-6))
+
+	if before.EqualWithOptions(after, opts) {
+		t.Error("Expected floats beyond epsilon to differ")
+	}
+}
+
+// TestAppendAssign tests appending to arrays and lists with +=.
+func TestAppendAssign(t *testing.T) {
+	opts := Options{AppendAssign: true}
+
+	config, err := ParseStringWithOptions(`
+		plugins = [ "auth" ];
+		plugins += "metrics";
+		plugins += "tracing";
+		handlers = ( "a" );
+		handlers += { name = "b"; };
+		server = {
+			ports = [];
+			ports += 80;
+			ports += 443;
+		};
+	`, opts)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	plugins, _, err := config.LookupSlice("plugins")
+	if err != nil || len(plugins) != 3 || plugins[2].StrVal != "tracing" {
+		t.Errorf("Expected 3 plugins ending with tracing, got %v, %v", plugins, err)
+	}
+
+	handlers, _ := config.Lookup("handlers")
+	if handlers.Type != TypeList || len(handlers.ListVal) != 2 || handlers.ListVal[1].Type != TypeGroup {
+		t.Errorf("Expected a list ending with a group, got %v", handlers)
+	}
+
+	if last, err := config.LookupListElem("server.ports", 1); err != nil || last.IntVal != 443 {
+		t.Errorf("Expected server.ports[1] = 443, got %v, %v", last, err)
+	}
+
+	failures := []struct {
+		input string
+		err   error
+	}{
+		{`plugins += "x";`, ErrAppendTarget},
+		{`name = "app"; name += "x";`, ErrAppendTarget},
+		{`ports = [ 80 ]; ports += "http";`, ErrArrayTypeMismatch},
+		{`group = { a = [ 1 ]; }; a += 2;`, ErrAppendTarget},
+	}
+
+	for _, tt := range failures {
+		if _, err := ParseStringWithOptions(tt.input, opts); !errors.Is(err, tt.err) {
+			t.Errorf("Expected %v for %s, got %v", tt.err, tt.input, err)
+		}
+	}
+
+	// Without the option += is not an operator
+	if _, err := ParseString(`plugins = [ "a" ]; plugins += "b";`); !errors.Is(err, ErrExpectedAssignment) {
+		t.Errorf("Expected ErrExpectedAssignment without AppendAssign, got %v", err)
+	}
+}
+
+// TestDecimalComma tests that a comma decimal separator is reported clearly.
+func TestDecimalComma(t *testing.T) {
+	for _, input := range []string{`x = 3,14;`, `group = { ratio = 0,5; };`, `big = 1,5e3;`, `x = 3,14`} {
+		_, err := ParseString(input)
+		if !errors.Is(err, ErrDecimalComma) {
+			t.Errorf("Expected ErrDecimalComma for %s, got %v", input, err)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), "did you use a comma decimal separator?") {
+			t.Errorf("Expected a hint about the decimal separator, got %v", err)
+		}
+	}
+
+	if _, err := ParseString(`x = 3,14;`); err != nil && !strings.Contains(err.Error(), "line 1, column 5 is followed by ',14'") {
+		t.Errorf("Expected the error to point at the number, got %v", err)
+	}
+
+	// Commas between array elements are separators, with or without spaces
+	config, err := ParseString(`a = [3,14]; f = 3.14;`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if f, err := config.LookupFloat("f"); err != nil || f != 3.14 {
+		t.Errorf("Expected f = 3.14, got %v, %v", f, err)
+	}
+
+	if a, _, err := config.LookupSlice("a"); err != nil || len(a) != 2 {
+		t.Errorf("Expected two array elements, got %v, %v", a, err)
+	}
+}
+
+// TestTypeAnnotations tests checking values against declared types.
+func TestTypeAnnotations(t *testing.T) {
+	opts := Options{TypeAnnotations: true}
+
+	config, err := ParseStringWithOptions(`
+		port: int = 8080;
+		name: string = "app";
+		ratio : float = 0.5;
+		limit: int64 = 10L;
+		tags: array = [ "a" ];
+		server: group = { host: string = "localhost"; tls: bool = true; };
+		plain: 42;
+	`, opts)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if port, err := config.LookupInt("port"); err != nil || port != 8080 {
+		t.Errorf("Expected port = 8080, got %d, %v", port, err)
+	}
+
+	if host, err := config.LookupString("server.host"); err != nil || host != "localhost" {
+		t.Errorf("Expected server.host = localhost, got %q, %v", host, err)
+	}
+
+	if plain, err := config.LookupInt("plain"); err != nil || plain != 42 {
+		t.Errorf("Expected unannotated colon assignment to still work, got %d, %v", plain, err)
+	}
+
+	_, err = ParseStringWithOptions("name = \"app\";\nport: int = \"8080\";", opts)
+	if !errors.Is(err, ErrTypeAnnotation) {
+		t.Fatalf("Expected ErrTypeAnnotation, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "setting 'port' at line 2, column 1 is declared int but is a string") {
+		t.Errorf("Expected the mismatch with its position, got %v", err)
+	}
+
+	if _, err := ParseStringWithOptions(`port: integer = 1;`, opts); !errors.Is(err, ErrTypeAnnotation) {
+		t.Errorf("Expected ErrTypeAnnotation for an unknown type, got %v", err)
+	}
+
+	if _, err := ParseStringWithOptions(`port: null = 1;`, opts); !errors.Is(err, ErrTypeAnnotation) {
+		t.Errorf("Expected ErrTypeAnnotation for a null annotation, got %v", err)
+	}
+
+	// Without the option the annotation is a syntax error
+	if _, err := ParseString(`port: int = 8080;`); err == nil {
+		t.Error("Expected an error for an annotation without TypeAnnotations")
+	}
+}
+
+// TestSections tests listing the top-level settings in declaration order.
+func TestSections(t *testing.T) {
+	config, err := ParseString(`
+		version = 2;
+		server = { host = "localhost"; port = 8080; };
+		name = "app";
+		ports = [ 80, 443 ];
+		handlers = ( "a", "b" );
+		database = { host = "db"; };
+	`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	sections := config.Sections()
+
+	expected := []struct {
+		name string
+		kind ValueType
+	}{
+		{"version", TypeInt},
+		{"server", TypeGroup},
+		{"name", TypeString},
+		{"ports", TypeArray},
+		{"handlers", TypeList},
+		{"database", TypeGroup},
+	}
+
+	if len(sections) != len(expected) {
+		t.Fatalf("Expected %d sections, got %d", len(expected), len(sections))
+	}
+
+	for i, want := range expected {
+		if sections[i].Name != want.name || sections[i].Type != want.kind || sections[i].Value.Type != want.kind {
+			t.Errorf("Section %d: expected %s (%s), got %s (%s)", i, want.name, want.kind, sections[i].Name, sections[i].Type)
+		}
+	}
+
+	if host := sections[1].Value.GroupVal["host"].StrVal; host != "localhost" {
+		t.Errorf("Expected the server section's value, got host %q", host)
+	}
+
+	if sections := NewConfig().Sections(); len(sections) != 0 {
+		t.Errorf("Expected no sections in an empty config, got %v", sections)
+	}
+}
+
+// TestValidateStrict tests that strict validation also reports settings missing from the schema.
+func TestValidateStrict(t *testing.T) {
+	config, err := ParseString(`name = "app";
+server = {
+	port = 8080;
+	prot = 8081;
+};
+database = { host = "db"; pool = { size = 4; }; };
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	schema := Schema{
+		"name":        {Required: true, Types: []ValueType{TypeString}},
+		"server.port": {Required: true},
+		"server.host": {Required: true},
+		"database":    {Types: []ValueType{TypeGroup}},
+	}
+
+	if err := config.Validate(schema); !errors.Is(err, ErrMissingRequired) || errors.Is(err, ErrUnexpectedKey) {
+		t.Errorf("Expected Validate to report only the missing key, got %v", err)
+	}
+
+	err = config.ValidateStrict(schema)
+	if !errors.Is(err, ErrMissingRequired) || !errors.Is(err, ErrUnexpectedKey) {
+		t.Fatalf("Expected both a missing and an unexpected key, got %v", err)
+	}
+
+	expected := []string{
+		"setting 'server.host': missing required setting",
+		"setting 'server.prot' at line 4: setting is not in the schema",
+	}
+
+	if got := strings.Split(err.Error(), "\n"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected violations %q, got %q", expected, got)
+	}
+
+	schema["server.prot"] = SchemaField{}
+	schema["server.host"] = SchemaField{}
+
+	if err := config.ValidateStrict(schema); err != nil {
+		t.Errorf("Expected a complete schema to pass, got %v", err)
+	}
+}
+
+// TestLookupUnwrap tests that the unwrapping lookups read one-element arrays and lists as scalars.
+func TestLookupUnwrap(t *testing.T) {
+	config, err := ParseString(`name = ( "solo" );
+port = [ 8080 ];
+ratio = 0.5;
+enabled = ( true );
+hosts = ( "a", "b" );
+mixed = ( 1 );
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if name, err := config.LookupStringUnwrap("name"); err != nil || name != "solo" {
+		t.Errorf("Expected name 'solo', got %q (%v)", name, err)
+	}
+
+	if port, err := config.LookupIntUnwrap("port"); err != nil || port != 8080 {
+		t.Errorf("Expected port 8080, got %d (%v)", port, err)
+	}
+
+	if port, err := config.LookupInt64Unwrap("port"); err != nil || port != 8080 {
+		t.Errorf("Expected 64-bit port 8080, got %d (%v)", port, err)
+	}
+
+	if ratio, err := config.LookupFloatUnwrap("ratio"); err != nil || ratio != 0.5 {
+		t.Errorf("Expected plain ratio 0.5, got %v (%v)", ratio, err)
+	}
+
+	if enabled, err := config.LookupBoolUnwrap("enabled"); err != nil || !enabled {
+		t.Errorf("Expected enabled to be true, got %v (%v)", enabled, err)
+	}
+
+	if _, err := config.LookupStringUnwrap("hosts"); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected ErrNotString for a two-element list, got %v", err)
+	}
+
+	if _, err := config.LookupStringUnwrap("mixed"); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected ErrNotString for a list holding an integer, got %v", err)
+	}
+
+	if _, err := config.LookupString("name"); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected LookupString to stay strict, got %v", err)
+	}
+}
+
+// TestLookupRegexp tests that LookupRegexp compiles patterns and reports invalid ones.
+func TestLookupRegexp(t *testing.T) {
+	config, err := ParseString(`comment = "\/\*\s*dde='([^*]|\*[^\/]|)*\*\/\s*$";
+broken = "[a-";
+count = 3;
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	re, err := config.LookupRegexp("comment")
+	if err != nil {
+		t.Fatalf("Failed to compile comment pattern: %v", err)
+	}
+
+	if !re.MatchString("/* dde='x' */") {
+		t.Errorf("Expected %q to match a dde comment", re)
+	}
+
+	_, err = config.LookupRegexp("broken")
+	if !errors.Is(err, ErrInvalidRegexp) {
+		t.Fatalf("Expected ErrInvalidRegexp, got %v", err)
+	}
+
+	for _, want := range []string{"line 2", `"[a-"`, "missing closing ]"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got %v", want, err)
+		}
+	}
+
+	if _, err := config.LookupRegexp("count"); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected ErrNotString for an integer, got %v", err)
+	}
+}
+
+// TestEnvRefs tests that EnvRefs lists referenced environment variables once each, in order.
+func TestEnvRefs(t *testing.T) {
+	config, err := ParseString(`database = {
+	url = "postgres://${DB_USER}:${DB_PASSWORD}@${DB_HOST}/app";
+	replica = "${DB_HOST}";
+};
+paths = [ "${HOME}/data", "/tmp" ];
+workers = ( { token = "${API_TOKEN}"; }, "${HOME}" );
+literal = "$HOME ${} ${1BAD} ${unterminated";
+port = 8080;
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	expected := []string{"API_TOKEN", "DB_HOST", "DB_PASSWORD", "DB_USER", "HOME"}
+	if refs := config.EnvRefs(); !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected references %v, got %v", expected, refs)
+	}
+
+	value, _ := config.LookupString("database.replica")
+	if value != "${DB_HOST}" {
+		t.Errorf("Expected values to stay unexpanded, got %q", value)
+	}
+
+	if refs := NewConfig().EnvRefs(); len(refs) != 0 {
+		t.Errorf("Expected no references in an empty config, got %v", refs)
+	}
+}
+
+// TestMergeFunc tests that MergeFunc merges groups and leaves leaf conflicts to the resolver.
+func TestMergeFunc(t *testing.T) {
+	base, err := ParseString(`name = "app";
+limits = { workers = 8; timeout = 30; };
+tags = [ "a" ];
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	override, err := ParseString(`name = "-staging";
+limits = { workers = 4; timeout = 60; burst = 2; };
+tags = [ "b" ];
+debug = true;
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	var conflicts []string
+
+	err = base.MergeFunc(override, func(path string, a, b Value) Value {
+		conflicts = append(conflicts, path)
+
+		switch {
+		case a.Type == TypeString && b.Type == TypeString:
+			return NewStringValue(a.StrVal + b.StrVal)
+		case a.Type == TypeInt && b.Type == TypeInt:
+			return NewIntValue(max(a.IntVal, b.IntVal))
+		default:
+			return b
+		}
+	})
+	if err != nil {
+		t.Fatalf("Failed to merge: %v", err)
+	}
+
+	expected := []string{"name", "limits.workers", "limits.timeout", "tags"}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("Expected conflicts %v, got %v", expected, conflicts)
+	}
+
+	if name, _ := base.LookupString("name"); name != "app-staging" {
+		t.Errorf("Expected concatenated name 'app-staging', got %q", name)
+	}
+
+	if workers, _ := base.LookupInt("limits.workers"); workers != 8 {
+		t.Errorf("Expected the larger worker count 8, got %d", workers)
+	}
+
+	if timeout, _ := base.LookupInt("limits.timeout"); timeout != 60 {
+		t.Errorf("Expected the larger timeout 60, got %d", timeout)
+	}
+
+	if burst, _ := base.LookupInt("limits.burst"); burst != 2 {
+		t.Errorf("Expected new setting burst to be added, got %d", burst)
+	}
+
+	if debug, _ := base.LookupBool("debug"); !debug {
+		t.Error("Expected new setting debug to be added")
+	}
+
+	base.Freeze()
+
+	if err := base.MergeFunc(override, nil); !errors.Is(err, ErrConfigFrozen) {
+		t.Errorf("Expected ErrConfigFrozen, got %v", err)
+	}
+}
+
+// TestAnchors tests that *name statements merge groups marked with &name.
+func TestAnchors(t *testing.T) {
+	input := `base = &defaults { timeout = 30; retries = 3; tls = { enabled = true; }; };
+svc = { *defaults; port = 80; retries = 5; tls = { verify = false; }; };
+admin = { name = "admin"; *defaults; };
+`
+
+	if _, err := ParseString(input); err == nil {
+		t.Error("Expected anchors to be rejected without Options.Anchors")
+	}
+
+	config, err := ParseStringWithOptions(input, Options{Anchors: true})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if timeout, _ := config.LookupInt("svc.timeout"); timeout != 30 {
+		t.Errorf("Expected svc.timeout 30 from the anchor, got %d", timeout)
+	}
+
+	if retries, _ := config.LookupInt("svc.retries"); retries != 5 {
+		t.Errorf("Expected svc's own retries 5 to win, got %d", retries)
+	}
+
+	if enabled, _ := config.LookupBool("svc.tls.enabled"); !enabled {
+		t.Error("Expected svc.tls.enabled to be merged from the anchor")
+	}
+
+	if verify, err := config.LookupBool("svc.tls.verify"); err != nil || verify {
+		t.Errorf("Expected svc.tls.verify false, got %v (%v)", verify, err)
+	}
+
+	if _, err := config.Lookup("base.tls.verify"); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected the anchored group to be unchanged, got %v", err)
+	}
+
+	expectedKeys := []string{"timeout", "retries", "tls", "name"}
+	if admin, _ := config.Lookup("admin"); !reflect.DeepEqual(admin.MemberKeys(), expectedKeys) {
+		t.Errorf("Expected admin keys %v, got %v", expectedKeys, admin.MemberKeys())
+	}
+}
+
+// TestAnchorErrors tests cyclic, unknown and misplaced anchor references.
+func TestAnchorErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected error
+	}{
+		{"self reference", `a = &loop { x = 1; *loop; };`, ErrAnchorCycle},
+		{"nested self reference", `a = &loop { inner = { *loop; }; };`, ErrAnchorCycle},
+		{"unknown anchor", `a = { *missing; };`, ErrUnknownAnchor},
+		{"forward reference", `a = { *later; }; b = &later { x = 1; };`, ErrUnknownAnchor},
+		{"anchored scalar", `a = &value 5;`, ErrInvalidAnchor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseStringWithOptions(tt.input, Options{Anchors: true})
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+// TestLookupKeyedMap tests indexing a list of groups by one of their members.
+func TestLookupKeyedMap(t *testing.T) {
+	config, err := ParseString(`services = [
+	{ name = "payment_gateway"; url = "https://api.payment.com"; timeout = 30; },
+	{ name = "email_service"; url = "https://api.email.com"; timeout = 15; }
+];
+duplicated = ( { name = "a"; }, { name = "a"; } );
+unnamed = ( { name = "a"; }, { url = "x"; } );
+numbered = ( { name = 1; } );
+scalars = [ 1, 2 ];
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	services, err := config.LookupKeyedMap("services", "name")
+	if err != nil {
+		t.Fatalf("Failed to key services: %v", err)
+	}
+
+	if len(services) != 2 {
+		t.Fatalf("Expected 2 services, got %d", len(services))
+	}
+
+	if url := services["email_service"].GroupVal["url"].StrVal; url != "https://api.email.com" {
+		t.Errorf("Expected email_service url 'https://api.email.com', got %q", url)
+	}
+
+	if timeout := services["payment_gateway"].GroupVal["timeout"].IntVal; timeout != 30 {
+		t.Errorf("Expected payment_gateway timeout 30, got %d", timeout)
+	}
+
+	tests := []struct {
+		path     string
+		expected error
+	}{
+		{"duplicated", ErrDuplicateKey},
+		{"unnamed", ErrSettingNotFound},
+		{"numbered", ErrNotString},
+		{"scalars", ErrNotGroup},
+		{"missing", ErrSettingNotFound},
+	}
+
+	for _, tt := range tests {
+		if _, err := config.LookupKeyedMap(tt.path, "name"); !errors.Is(err, tt.expected) {
+			t.Errorf("Expected %v for '%s', got %v", tt.expected, tt.path, err)
+		}
+	}
+}
+
+// TestParseUntil tests that ParseUntil stops parsing once the requested setting is found.
+func TestParseUntil(t *testing.T) {
+	input := `version = "1.2";
+server = { host = "localhost"; port = 8080; };
+broken = { = ;
+`
+
+	val, err := ParseUntil(strings.NewReader(input), "server")
+	if err != nil {
+		t.Fatalf("Failed to parse until server: %v", err)
+	}
+
+	if val.Type != TypeGroup || val.GroupVal["port"].IntVal != 8080 {
+		t.Errorf("Expected the server group with port 8080, got %v", val)
+	}
+
+	if val.Pos.Line != 2 {
+		t.Errorf("Expected server on line 2, got %d", val.Pos.Line)
+	}
+
+	if _, err := ParseString(input); err == nil {
+		t.Error("Expected the full parse to fail on the broken setting")
+	}
+
+	if _, err := ParseUntil(strings.NewReader(input), "missing"); err == nil || errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected the syntax error before the end to be reported, got %v", err)
+	}
+
+	if _, err := ParseUntil(strings.NewReader(`a = 1; b = 2;`), "c"); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound, got %v", err)
+	}
+}
+
+// TestWritePortableInt64 tests that PortableInt64 suffixes large plain integers.
+func TestWritePortableInt64(t *testing.T) {
+	config := NewConfig()
+	config.Root.setMember("big", NewIntValue(5000000000))
+	config.Root.setMember("small", NewIntValue(42))
+	config.Root.setMember("wide", NewInt64Value(7))
+	config.Root.setMember("sizes", NewArrayValue([]Value{NewIntValue(1), NewIntValue(-5000000000)}))
+	config.Root.setMember("mixed", NewListValue([]Value{NewIntValue(1), NewIntValue(5000000000)}))
+
+	opts := DefaultWriteOptions()
+	opts.SortKeys = false
+
+	var plain bytes.Buffer
+	if err := config.WriteWithOptions(&plain, opts); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if !strings.Contains(plain.String(), "big = 5000000000;") || !strings.Contains(plain.String(), "wide = 7L;") {
+		t.Errorf("Expected only TypeInt64 values to be suffixed by default, got:\n%s", plain.String())
+	}
+
+	opts.PortableInt64 = true
+
+	var portable bytes.Buffer
+	if err := config.WriteWithOptions(&portable, opts); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	expected := `big = 5000000000L;
+small = 42;
+wide = 7L;
+sizes = [ 1L, -5000000000L ];
+mixed = ( 1, 5000000000L );
+`
+	if portable.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, portable.String())
+	}
+
+	reparsed, err := ParseString(portable.String())
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if big, _ := reparsed.Lookup("big"); big.Type != TypeInt64 || big.Int64Val != 5000000000 {
+		t.Errorf("Expected big to read back as a 64-bit integer, got %v", big)
+	}
+}
+
+// TestMarshal tests that Marshal output parses back into an equal configuration.
+func TestMarshal(t *testing.T) {
+	config, err := ParseString(`name = "say \"hi\"\n\tC:\\path\\";
+big = 5000000000L;
+mask = 0xFF;
+ratio = 1.5;
+empty_group = { };
+empty_array = [ ];
+empty_list = ( );
+server = {
+	tls = { enabled = true; ciphers = [ "a", "b" ]; };
+	routes = ( { path = "/"; }, [ 1, 2 ], ( ), "x" );
+};
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	data, err := Marshal(config)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+
+	reparsed, err := ParseString(string(data))
+	if err != nil {
+		t.Fatalf("Failed to parse marshaled config: %v\n%s", err, data)
+	}
+
+	if changes := config.Diff(reparsed); len(changes) != 0 {
+		t.Errorf("Expected an equal config after the round trip, got %v", changes)
+	}
+
+	if name, _ := reparsed.LookupString("name"); name != "say \"hi\"\n\tC:\\path\\" {
+		t.Errorf("Expected escapes to survive the round trip, got %q", name)
+	}
+
+	for _, want := range []string{"big = 5000000000L;", "mask = 0xFF;", "empty_group = { };", "empty_array = [ ];", "empty_list = ( );"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, data)
+		}
+	}
+
+	config.Root.setMember("nan", NewFloatValue(math.NaN()))
+
+	if _, err := Marshal(config); !errors.Is(err, ErrNotRepresentable) {
+		t.Errorf("Expected ErrNotRepresentable for NaN, got %v", err)
+	}
+}
+
+// TestParseFileMmap tests that ParseFileMmap parses files as ParseFile does.
+func TestParseFileMmap(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "db.cfg"), []byte(`database = { host = "db"; port = 5432; };`), 0o644); err != nil {
+		t.Fatalf("Failed to write include: %v", err)
+	}
+
+	filename := filepath.Join(dir, "app.cfg")
+	content := `# Application settings
+name = "app";
+ports = [ 80, 443 ];
+@include "db.cfg"
+`
+
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	expected, err := ParseFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	config, err := ParseFileMmap(filename)
+	if err != nil {
+		t.Fatalf("Failed to parse mapped config: %v", err)
+	}
+
+	if changes := expected.Diff(config); len(changes) != 0 {
+		t.Errorf("Expected the same config as ParseFile, got changes %v", changes)
+	}
+
+	if name, _ := config.LookupString("name"); name != "app" {
+		t.Errorf("Expected name 'app', got %q", name)
+	}
+
+	if pos, _ := config.Lookup("ports"); pos.Pos.File != filename {
+		t.Errorf("Expected positions to name %s, got %s", filename, pos.Pos.File)
+	}
+
+	empty := filepath.Join(dir, "empty.cfg")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if config, err := ParseFileMmap(empty); err != nil || len(config.Root.GroupVal) != 0 {
+		t.Errorf("Expected an empty config, got %v (%v)", config, err)
+	}
+
+	if _, err := ParseFileMmap(filepath.Join(dir, "missing.cfg")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist, got %v", err)
+	}
+}
+
+// TestParseFileMmapUnmapped tests that nothing in a config parsed with ParseFileMmap refers to the mapping,
+// which is unmapped before ParseFileMmap returns; a string left pointing into it would fault when read.
+func TestParseFileMmapUnmapped(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "db.cfg"), []byte(`# included
+host = "db";`), 0o644); err != nil {
+		t.Fatalf("Failed to write include: %v", err)
+	}
+
+	filename := filepath.Join(dir, "app.cfg")
+	content := `# libconfig:strict
+/* block comment */
+name = "app";  // trailing comment
+"quoted name" = "tab\there";
+ratio = 1.50;
+big = 0x7FFFFFFFFFL;
+flags = [ true, false ];
+nested = { list = ( "a", 1, { deep = "b"; } ); };
+database = { @include "db.cfg" };
+`
+
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	config, err := ParseFileMmap(filename)
+	if err != nil {
+		t.Fatalf("Failed to parse mapped config: %v", err)
+	}
+
+	// Reading every byte of every string faults if one still refers to
+	// the unmapped pages
+	var sb strings.Builder
+
+	var visit func(v *Value)
+	visit = func(v *Value) {
+		sb.WriteString(v.StrVal)
+		sb.WriteString(v.FloatText)
+		sb.WriteString(v.Pos.File)
+		sb.WriteString(v.LineComment)
+
+		for _, comment := range append(v.Comments, v.TrailingComments...) {
+			sb.WriteString(comment)
+		}
+
+		for _, key := range v.Keys {
+			sb.WriteString(key)
+		}
+
+		for key, member := range v.GroupVal {
+			sb.WriteString(key)
+			visit(&member)
+		}
+
+		for i := range v.ArrayVal {
+			visit(&v.ArrayVal[i])
+		}
+
+		for i := range v.ListVal {
+			visit(&v.ListVal[i])
+		}
+	}
+	visit(&config.Root)
+
+	for _, record := range config.Includes() {
+		sb.WriteString(record.Directive + record.Resolved + record.File)
+	}
+
+	text := sb.String()
+	for _, expected := range []string{"app", "quoted name", "tab\there", "1.50", "db"} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected %q among the strings read, got %q", expected, text)
+		}
+	}
+}
+
+// TestWriteFile tests that WriteFile saves a config that parses back and replaces existing files.
+func TestWriteFile(t *testing.T) {
+	config, err := ParseString(`name = "app"; server = { port = 8080; };`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "app.cfg")
+	if err := os.WriteFile(filename, []byte(strings.Repeat("# stale\n", 100)), 0o600); err != nil {
+		t.Fatalf("Failed to write stale file: %v", err)
+	}
+
+	if err := config.WriteFile(filename); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	if bytes.Contains(data, []byte("stale")) || !bytes.HasSuffix(data, []byte("\n")) {
+		t.Errorf("Expected the file to be replaced and end with a newline, got:\n%s", data)
+	}
+
+	reparsed, err := ParseFile(filename)
+	if err != nil {
+		t.Fatalf("Failed to parse written config: %v", err)
+	}
+
+	if !config.Equal(reparsed) {
+		t.Errorf("Expected the written config to parse back equal, got %v", config.Diff(reparsed))
+	}
+
+	if err := NewConfig().WriteFile(filename); err != nil {
+		t.Fatalf("Failed to write empty config: %v", err)
+	}
+
+	if data, _ := os.ReadFile(filename); string(data) != "\n" {
+		t.Errorf("Expected an empty config to be written as a newline, got %q", data)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing", "app.cfg")
+	if err := config.WriteFile(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist for a missing directory, got %v", err)
+	}
+}
+
+// TestTree tests the rendering of a config as a tree.
+func TestTree(t *testing.T) {
+	config, err := ParseString(`app = {
+	name = "demo";
+	server = { port = 8080; hosts = [ "a", "b" ]; };
+	empty = { };
+};
+routes = ( { path = "/"; }, 0x1F );
+debug = false;
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	var b strings.Builder
+	if err := config.Tree(&b); err != nil {
+		t.Fatalf("Failed to write tree: %v", err)
+	}
+
+	expected := `├─ app (group)
+│  ├─ name (string) = "demo"
+│  ├─ server (group)
+│  │  ├─ port (int) = 8080
+│  │  └─ hosts (array)
+│  │     ├─ [0] (string) = "a"
+│  │     └─ [1] (string) = "b"
+│  └─ empty (group)
+├─ routes (list)
+│  ├─ [0] (group)
+│  │  └─ path (string) = "/"
+│  └─ [1] (int) = 0x1F
+└─ debug (bool) = false
+`
+	if b.String() != expected {
+		t.Errorf("Expected tree:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+// TestLookupStringIn tests checking string settings against an allowed set.
+func TestLookupStringIn(t *testing.T) {
+	config, err := ParseString(`strategy = "round_robin"; mode = "Least_Conn"; retries = 3;`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	allowed := []string{"round_robin", "least_conn", "random"}
+
+	if strategy, err := config.LookupStringIn("strategy", allowed); err != nil || strategy != "round_robin" {
+		t.Errorf("Expected strategy 'round_robin', got %q (%v)", strategy, err)
+	}
+
+	_, err = config.LookupStringIn("mode", allowed)
+	if !errors.Is(err, ErrValueNotAllowed) {
+		t.Fatalf("Expected ErrValueNotAllowed, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), `["round_robin" "least_conn" "random"]`) {
+		t.Errorf("Expected the error to list the allowed values, got %v", err)
+	}
+
+	if mode, err := config.LookupStringInFold("mode", allowed); err != nil || mode != "least_conn" {
+		t.Errorf("Expected mode 'least_conn' ignoring case, got %q (%v)", mode, err)
+	}
+
+	if _, err := config.LookupStringIn("retries", allowed); !errors.Is(err, ErrNotString) {
+		t.Errorf("Expected ErrNotString for an integer, got %v", err)
+	}
+
+	if _, err := config.LookupStringInFold("missing", allowed); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound, got %v", err)
+	}
+}
+
+// TestMarkDeprecated tests the warnings for settings that have been renamed.
+func TestMarkDeprecated(t *testing.T) {
+	config, err := ParseString(`name = "app";
+db_host = "legacy";
+timeout = 30;
+server = { timeout = 60; };
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	found, warning := config.MarkDeprecated("db_host", "database.host")
+	if !found {
+		t.Fatal("Expected db_host to be found")
+	}
+
+	expected := "setting 'db_host' at line 2 is deprecated, use 'database.host' instead"
+	if warning != expected {
+		t.Errorf("Expected warning %q, got %q", expected, warning)
+	}
+
+	if host, err := config.LookupFirst("database.host", "db_host"); err != nil || host.StrVal != "legacy" {
+		t.Errorf("Expected the old setting to keep working, got %v (%v)", host, err)
+	}
+
+	_, warning = config.MarkDeprecated("timeout", "server.timeout")
+	if !strings.HasSuffix(warning, "('server.timeout' is also set, at line 4)") {
+		t.Errorf("Expected the warning to note the new setting, got %q", warning)
+	}
+
+	if found, warning := config.MarkDeprecated("hostname", "name"); found || warning != "" {
+		t.Errorf("Expected no warning for an absent setting, got %v %q", found, warning)
+	}
+}
+
+// TestUnterminatedString tests that strings left open at the end of a line or the input are errors.
+func TestUnterminatedString(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		line  int
+		col   int
+	}{
+		{"end of input", "x = \"abc", 1, 5},
+		{"end of line", "a = 1;\nname = \"app;\nport = 80;", 2, 8},
+		{"escaped quote", `x = "abc\";`, 1, 5},
+		{"setting name", "\"name = 1;", 1, 1},
+		{"include path", "@include \"other.cfg\n", 1, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseString(tt.input)
+			if !errors.Is(err, ErrUnterminatedString) {
+				t.Fatalf("Expected ErrUnterminatedString, got %v", err)
+			}
+
+			want := fmt.Sprintf("string opened at line %d, column %d", tt.line, tt.col)
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("Expected error to contain %q, got %v", want, err)
+			}
+		})
+	}
+
+	config, err := ParseString(`x = "say \"hi\"\n"; y = "";`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if x, _ := config.LookupString("x"); x != "say \"hi\"\n" {
+		t.Errorf("Expected escapes to be kept, got %q", x)
+	}
+}
+
+// TestExists tests presence checks for settings of every type.
+func TestExists(t *testing.T) {
+	config, err := ParseString(`name = "app";
+server = { port = 8080; tls = { }; };
+hosts = [ "a" ];
+routes = ( );
+"a.b" = 1;
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"name", true},
+		{"server", true},
+		{"server.port", true},
+		{"server.tls", true},
+		{"hosts", true},
+		{"routes", true},
+		{`a\.b`, true},
+		{"", true},
+		{"missing", false},
+		{"server.missing", false},
+		{"missing.port", false},
+		{"name.length", false},
+		{"hosts.0", false},
+	}
+
+	for _, tt := range tests {
+		if got := config.Exists(tt.path); got != tt.expected {
+			t.Errorf("Expected Exists(%q) = %v, got %v", tt.path, tt.expected, got)
+		}
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { config.Exists("missing") }); allocs != 0 {
+		t.Errorf("Expected Exists on a missing key not to allocate, got %v allocations", allocs)
+	}
+}
+
+// TestRecordIncludes tests that the include directives followed are recorded with their resolved files.
+func TestRecordIncludes(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"main.cfg":        "name = \"app\";\n\n@include \"conf.d/db\"\nhosts = [ @include \"hosts.cfg\" ];\n",
+		"conf.d/db.cfg":   "database = { host = \"db\"; };\n@include \"pool.cfg\"\n",
+		"conf.d/pool.cfg": "pool = 4;\n",
+		"hosts.cfg":       "\"a\", \"b\"\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	mainFile := filepath.Join(dir, "main.cfg")
+
+	config, err := ParseFileWithOptions(mainFile, Options{RecordIncludes: true})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	db := filepath.Join(dir, "conf.d", "db.cfg")
+	expected := []IncludeRecord{
+		{Directive: "conf.d/db", Resolved: db, Line: 3, File: mainFile},
+		{Directive: "pool.cfg", Resolved: filepath.Join(dir, "conf.d", "pool.cfg"), Line: 2, File: db},
+		{Directive: "hosts.cfg", Resolved: filepath.Join(dir, "hosts.cfg"), Line: 4, File: mainFile},
+	}
+
+	if records := config.Includes(); !reflect.DeepEqual(records, expected) {
+		t.Errorf("Expected includes %+v, got %+v", expected, records)
+	}
+
+	config, err = ParseFile(mainFile)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if records := config.Includes(); records != nil {
+		t.Errorf("Expected no records without RecordIncludes, got %+v", records)
+	}
+}
+
+// TestLookupDefault tests that the defaulted lookups fall back for missing and mistyped settings.
+func TestLookupDefault(t *testing.T) {
+	config, err := ParseString(`name = "app";
+server = { port = 8080; big = 5000000000L; ratio = 0.75; debug = true; };
+count = "three";
+`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if got := config.LookupStringDefault("name", "none"); got != "app" {
+		t.Errorf("Expected name 'app', got %q", got)
+	}
+
+	if got := config.LookupStringDefault("server.host", "localhost"); got != "localhost" {
+		t.Errorf("Expected default host, got %q", got)
+	}
+
+	if got := config.LookupIntDefault("server.port", 80); got != 8080 {
+		t.Errorf("Expected port 8080, got %d", got)
+	}
+
+	if got := config.LookupIntDefault("count", 3); got != 3 {
+		t.Errorf("Expected the default for a string count, got %d", got)
+	}
+
+	if got := config.LookupInt64Default("server.big", 0); got != 5000000000 {
+		t.Errorf("Expected big 5000000000, got %d", got)
+	}
+
+	if got := config.LookupFloatDefault("server.ratio", 1); got != 0.75 {
+		t.Errorf("Expected ratio 0.75, got %v", got)
+	}
+
+	if got := config.LookupFloatDefault("server.port", 1.5); got != 1.5 {
+		t.Errorf("Expected the default for an integer, got %v", got)
+	}
+
+	if got := config.LookupBoolDefault("server.debug", false); !got {
+		t.Error("Expected debug to be true")
+	}
+
+	for _, path := range []string{"missing.deeply.nested", "name.child", "server.port.x", ""} {
+		if got := config.LookupBoolDefault(path, true); !got {
+			t.Errorf("Expected the default for '%s'", path)
+		}
+
+		if got := config.LookupInt64Default(path, -1); got != -1 {
+			t.Errorf("Expected the default for '%s', got %d", path, got)
+		}
+	}
+}
+
+// TestLineContinuation tests that a trailing backslash continues a line with Options.LineContinuation.
+func TestLineContinuation(t *testing.T) {
+	input := "value = \"part1\" \\\n    \"part2\";\nport = \\\r\n    8080;\nhosts = [ \"a\", \\\n\"b\" ];\n"
+
+	if _, err := ParseString(input); err == nil {
+		t.Error("Expected line continuations to be rejected without the option")
+	}
+
+	config, err := ParseStringWithOptions(input, Options{LineContinuation: true})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if value, _ := config.LookupString("value"); value != "part1part2" {
+		t.Errorf("Expected value 'part1part2', got %q", value)
+	}
+
+	if port, _ := config.LookupInt("port"); port != 8080 {
+		t.Errorf("Expected port 8080, got %d", port)
+	}
+
+	if hosts, _, _ := config.LookupSlice("hosts"); len(hosts) != 2 {
+		t.Errorf("Expected 2 hosts, got %d", len(hosts))
+	}
+
+	for _, stray := range []string{`a = 1 \ b = 2;`, "a = \\ 1;\n", "a = 1; \\"} {
+		if _, err := ParseStringWithOptions(stray, Options{LineContinuation: true}); err == nil {
+			t.Errorf("Expected a stray backslash in %q to be rejected", stray)
+		}
+	}
+
+	// Lossless parsing reports a continuation as whitespace, as the lexer reads it
+	result, err := ParseLossless("a = \\\n 1;\n", Options{LineContinuation: true})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	for _, token := range result.Tokens {
+		if token.Type == TokenComment {
+			t.Errorf("Expected no comment tokens, got %s", token)
+		}
+
+		if token.Type == TokenWhitespace && strings.Contains(token.Value, "\\") && token.Value != " \\\n " {
+			t.Errorf("Expected the continuation as one whitespace token, got %q", token.Value)
+		}
+	}
+}
+
+// TestSet tests creating and replacing settings by path.
+func TestSet(t *testing.T) {
+	config, err := ParseString(`name = "app"; server = { port = 8080; };`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if err := config.Set("server.port", NewIntValue(9090)); err != nil {
+		t.Fatalf("Failed to set server.port: %v", err)
+	}
+
+	if err := config.Set("database.primary.host", NewStringValue("db1")); err != nil {
+		t.Fatalf("Failed to set database.primary.host: %v", err)
+	}
+
+	tags := NewArrayValue([]Value{NewStringValue("a")})
+	if err := config.Set("tags", tags); err != nil {
+		t.Fatalf("Failed to set tags: %v", err)
+	}
+
+	tags.ArrayVal[0] = NewStringValue("changed")
+
+	if port, _ := config.LookupInt("server.port"); port != 9090 {
+		t.Errorf("Expected port 9090, got %d", port)
+	}
+
+	if host, _ := config.LookupString("database.primary.host"); host != "db1" {
+		t.Errorf("Expected host 'db1', got %q", host)
+	}
+
+	if tag, _ := config.LookupListElem("tags", 0); tag.StrVal != "a" {
+		t.Errorf("Expected Set to store a copy, got %q", tag.StrVal)
+	}
+
+	expected := []string{"name", "server", "database", "tags"}
+	if keys := config.Root.MemberKeys(); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Expected keys %v, got %v", expected, keys)
+	}
+
+	if err := config.Set("name.first", NewStringValue("x")); !errors.Is(err, ErrCannotLookupInNonGroup) {
+		t.Errorf("Expected ErrCannotLookupInNonGroup, got %v", err)
+	}
+
+	if err := config.Set("", NewIntValue(1)); !errors.Is(err, ErrSettingNotFound) {
+		t.Errorf("Expected ErrSettingNotFound for an empty path, got %v", err)
+	}
+
+	for _, path := range []string{"tags.[0]", "bad key!", "server.true"} {
+		if err := config.Set(path, NewIntValue(1)); !errors.Is(err, ErrInvalidSettingName) {
+			t.Errorf("Expected ErrInvalidSettingName for %q, got %v", path, err)
+		}
+	}
+
+	if config.Exists("bad key!") {
+		t.Errorf("Expected no setting created for an invalid name")
+	}
+
+	// Replacing a setting keeps its comments
+	commented, err := ParseStringWithOptions("# listen port\nport = 80; // privileged\n", Options{PreserveComments: true})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if err := commented.Set("port", NewIntValue(8080)); err != nil {
+		t.Fatalf("Failed to set port: %v", err)
+	}
+
+	var patched strings.Builder
+	if err := commented.Write(&patched); err != nil || patched.String() != "# listen port\nport = 8080; // privileged\n" {
+		t.Errorf("Expected the comments kept on the replaced setting, got %q (%v)", patched.String(), err)
+	}
+
+	var out bytes.Buffer
+	if err := config.Write(&out); err != nil || !strings.Contains(out.String(), `host = "db1";`) {
+		t.Errorf("Expected the new setting in the output, got %q (%v)", out.String(), err)
+	}
+
+	config.Freeze()
+
+	if err := config.Set("name", NewStringValue("other")); !errors.Is(err, ErrConfigFrozen) {
+		t.Errorf("Expected ErrConfigFrozen, got %v", err)
+	}
+}
+
+// TestDepth tests the nesting depth of configurations and its agreement with Options.MaxDepth.
+func TestDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{``, 0},
+		{`a = 1; b = "x";`, 0},
+		{`a = { b = 1; };`, 1},
+		{`ports = [ 80, 443 ];`, 1},
+		{`a = { }; b = ( );`, 1},
+		{`app = { server = { tls = { ciphers = [ "a" ]; }; }; }; flat = 1;`, 4},
+		{`routes = ( { path = "/"; methods = [ "GET" ]; }, ( ( 1 ) ) ); other = { x = 1; };`, 3},
+	}
+
+	for _, tt := range tests {
+		config, err := ParseString(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+
+		if depth := config.Depth(); depth != tt.expected {
+			t.Errorf("Expected depth %d for %q, got %d", tt.expected, tt.input, depth)
+		}
+
+		if tt.expected == 0 {
+			continue
+		}
+
+		if _, err := ParseStringWithOptions(tt.input, Options{MaxDepth: tt.expected}); err != nil {
+			t.Errorf("Expected MaxDepth %d to accept %q, got %v", tt.expected, tt.input, err)
+		}
+
+		if _, err := ParseStringWithOptions(tt.input, Options{MaxDepth: tt.expected - 1}); tt.expected > 1 && !errors.Is(err, ErrMaxDepthExceeded) {
+			t.Errorf("Expected MaxDepth %d to reject %q, got %v", tt.expected-1, tt.input, err)
+		}
+	}
+}
+
+// TestWriteComments tests that comments before and after settings survive a parse and Write round-trip.
+func TestWriteComments(t *testing.T) {
+	input := `# listening address
+host = "localhost";
+port = 8080; // default port
+server = {
+	/* worker pool,
+	 * sized per core */
+	workers = 4;
+}; # server settings
+`
+
+	config, err := ParseStringWithOptions(input, Options{PreserveComments: true})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	host, _ := config.Lookup("host")
+	if !reflect.DeepEqual(host.Comments, []string{"# listening address"}) || host.LineComment != "" {
+		t.Errorf("Expected host to carry its leading comment, got %q and %q", host.Comments, host.LineComment)
+	}
+
+	port, _ := config.Lookup("port")
+	if port.Comments != nil || port.LineComment != "// default port" {
+		t.Errorf("Expected port to carry its line comment, got %q and %q", port.Comments, port.LineComment)
+	}
+
+	server, _ := config.Lookup("server")
+	if server.LineComment != "# server settings" {
+		t.Errorf("Expected server line comment, got %q", server.LineComment)
+	}
+
+	opts := WriteOptions{Indent: "\t", Assign: " = "}
+
+	var sb strings.Builder
+	if err := config.WriteWithOptions(&sb, opts); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if sb.String() != input {
+		t.Errorf("Expected comments written in place, got:\n%s", sb.String())
+	}
+
+	// A canonical style rewrites every comment, keeping its text
+	opts.CommentStyle = CommentLine
+	sb.Reset()
+
+	if err := config.WriteWithOptions(&sb, opts); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	expected := `// listening address
+host = "localhost";
+port = 8080; // default port
+server = {
+	// worker pool,
+	// sized per core
+	workers = 4;
+}; // server settings
+`
+	if sb.String() != expected {
+		t.Errorf("Expected comments in // style, got:\n%s", sb.String())
+	}
+
+	reparsed, err := ParseStringWithOptions(sb.String(), Options{PreserveComments: true})
+	if err != nil {
+		t.Fatalf("Failed to parse written config: %v\n%s", err, sb.String())
+	}
+
+	workers, _ := reparsed.Lookup("server.workers")
+	if !reflect.DeepEqual(workers.Comments, []string{"// worker pool,", "// sized per core"}) {
+		t.Errorf("Expected workers comments to survive round-trip, got %q", workers.Comments)
+	}
+
+	opts.CommentStyle = CommentBlock
+	if err := config.WriteWithOptions(&sb, opts); !errors.Is(err, ErrInvalidWriteOptions) {
+		t.Errorf("Expected ErrInvalidWriteOptions for block style, got %v", err)
+	}
+}
+
+// ipRange is a custom type that decodes itself from "first-last" strings.
+type ipRange struct {
+	First string
+	Last  string
+}
+
+var errBadRange = errors.New("bad range")
+
+// UnmarshalLibconfig implements Unmarshaler.
+func (r *ipRange) UnmarshalLibconfig(v Value) error {
+	first, last, ok := strings.Cut(v.StrVal, "-")
+	if v.Type != TypeString || !ok {
+		return errBadRange
+	}
+
+	r.First, r.Last = first, last
+
+	return nil
+}
+
+// TestUnmarshaler tests that Unmarshal hands fields implementing Unmarshaler their raw value.
+func TestUnmarshaler(t *testing.T) {
+	config, err := ParseString(`
+		allow = "10.0.0.0-10.0.0.255";
+		deny = "192.168.1.0-192.168.1.9";
+		ranges = [ "10.0.0.1-10.0.0.2", "10.0.1.1-10.0.1.2" ];`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	var target struct {
+		Allow  ipRange
+		Deny   *ipRange
+		Ranges []ipRange
+	}
+
+	if err := config.Unmarshal(&target); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if target.Allow != (ipRange{First: "10.0.0.0", Last: "10.0.0.255"}) {
+		t.Errorf("Expected allow range decoded, got %+v", target.Allow)
+	}
+
+	if target.Deny == nil || target.Deny.Last != "192.168.1.9" {
+		t.Errorf("Expected deny range allocated and decoded, got %+v", target.Deny)
+	}
+
+	if len(target.Ranges) != 2 || target.Ranges[1].First != "10.0.1.1" {
+		t.Errorf("Expected slice elements decoded, got %+v", target.Ranges)
+	}
+
+	// Errors from the method carry the setting's path
+	bad, err := ParseString(`allow = 42;`)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	err = bad.Unmarshal(&target)
+	if !errors.Is(err, errBadRange) || !strings.Contains(err.Error(), "'allow'") {
+		t.Errorf("Expected errBadRange at 'allow', got %v", err)
+	}
+}
+
+// TestLexerOnDemand tests that the lexer only reads as far into the input as the tokens requested.
+func TestLexerOnDemand(t *testing.T) {
+	input := "first = 1;\nsecond = [ 2, 3 ];\n"
+	lexer := NewLexer(strings.NewReader(input))
+
+	if token := lexer.NextToken(); token.Type != TokenIdentifier || token.Value != "first" {
+		t.Fatalf("Expected identifier 'first', got %s", token)
+	}
+
+	if lexer.line != 1 {
+		t.Errorf("Expected lexer to stay on line 1, got line %d", lexer.line)
+	}
+
+	// Peeking lexes one token ahead, which NextToken then returns
+	peeked := lexer.PeekToken()
+	if !reflect.DeepEqual(lexer.PeekToken(), peeked) || !reflect.DeepEqual(lexer.NextToken(), peeked) || peeked.Type != TokenAssign {
+		t.Errorf("Expected the peeked assignment to be returned next, got %s", peeked)
+	}
+
+	var types []TokenType
+	for token := lexer.NextToken(); token.Type != TokenEOF; token = lexer.NextToken() {
+		types = append(types, token.Type)
+	}
+
+	if len(types) != 10 {
+		t.Errorf("Expected 10 remaining tokens, got %d: %v", len(types), types)
+	}
+
+	if token := lexer.NextToken(); token.Type != TokenEOF {
+		t.Errorf("Expected EOF after the end of input, got %s", token)
+	}
+
+	// A comment in a disallowed style is only found once lexing reaches it,
+	// so a syntax error before it is reported first
+	_, err := ParseStringWithOptions("a = ;\n// late\n", Options{AllowedComments: CommentHash})
+	if !errors.Is(err, ErrUnexpectedToken) {
+		t.Errorf("Expected the earlier syntax error, got %v", err)
+	}
+
+	_, err = ParseStringWithOptions("a = 1;\n// late\nb = 2;\n", Options{AllowedComments: CommentHash})
+	if !errors.Is(err, ErrCommentStyle) {
+		t.Errorf("Expected ErrCommentStyle, got %v", err)
+	}
+}
+
+// timeout is a custom type that encodes itself as a duration string.
+type timeout time.Duration
+
+var errNegativeTimeout = errors.New("negative timeout")
+
+// MarshalLibconfig implements Marshaler.
+func (d timeout) MarshalLibconfig() (Value, error) {
+	if d < 0 {
+		return Value{}, errNegativeTimeout
+	}
+
+	return NewStringValue(time.Duration(d).String()), nil
+}
+
+// TestMarshaler tests that FromStruct lets values implementing Marshaler encode themselves.
+func TestMarshaler(t *testing.T) {
+	type server struct {
+		Name    string  `libconfig:"name"`
+		Timeout timeout `libconfig:"timeout"`
+	}
+
+	config, err := FromStruct(&struct {
+		Server  server             `libconfig:"server"`
+		Retries []timeout          `libconfig:"retries"`
+		Limits  map[string]timeout `libconfig:"limits"`
+		Idle    *timeout           `libconfig:"idle"`
+	}{
+		Server:  server{Name: "api", Timeout: timeout(30 * time.Second)},
+		Retries: []timeout{timeout(time.Second), timeout(1500 * time.Millisecond)},
+		Limits:  map[string]timeout{"read": timeout(time.Minute)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := config.Write(&sb); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	text := sb.String()
+	for _, expected := range []string{`timeout = "30s";`, `retries = [ "1s", "1.5s" ];`, `read = "1m0s";`} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected output to contain %s, got:\n%s", expected, text)
+		}
+	}
+
+	if config.Exists("idle") {
+		t.Errorf("Expected a nil Marshaler pointer to be skipped")
+	}
+
+	// Errors from the method carry the field's path
+	_, err = FromStruct(struct {
+		Wait timeout `libconfig:"wait"`
+	}{Wait: -1})
+	if !errors.Is(err, errNegativeTimeout) || !strings.Contains(err.Error(), "'wait'") {
+		t.Errorf("Expected errNegativeTimeout at 'wait', got %v", err)
+	}
+}
+
+// TestMarshalStructRoundTrip tests that a struct written with MarshalStruct unmarshals back unchanged.
+func TestMarshalStructRoundTrip(t *testing.T) {
+	type endpoint struct {
+		Host string `libconfig:"host"`
+		Port int    `libconfig:"port"`
+	}
+
+	type settings struct {
+		Name      string            `libconfig:"name"`
+		MaxBytes  int64             `libconfig:"max_bytes"`
+		Ratio     float64           `libconfig:"ratio"`
+		Debug     bool              `libconfig:"debug"`
+		Tags      []string          `libconfig:"tags"`
+		Endpoints []endpoint        `libconfig:"endpoints"`
+		Labels    map[string]string `libconfig:"labels"`
+		Primary   endpoint          `libconfig:"primary"`
+		secret    string
+	}
+
+	source := settings{
+		Name:      "app",
+		MaxBytes:  1 << 40,
+		Ratio:     0.25,
+		Debug:     true,
+		Tags:      []string{"a", "b"},
+		Endpoints: []endpoint{{Host: "one", Port: 1}, {Host: "two", Port: 2}},
+		Labels:    map[string]string{"env": "prod"},
+		Primary:   endpoint{Host: "main", Port: 8080},
+		secret:    "hidden",
+	}
+
+	data, err := MarshalStruct(&source)
+	if err != nil {
+		t.Fatalf("Failed to marshal struct: %v", err)
+	}
+
+	config, err := ParseBytes(data)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v\n%s", err, data)
+	}
+
+	if maxBytes, _ := config.Lookup("max_bytes"); maxBytes.Type != TypeInt64 {
+		t.Errorf("Expected int64 field written as int64, got %s", maxBytes.Type)
+	}
+
+	if endpoints, _ := config.Lookup("endpoints"); endpoints.Type != TypeList {
+		t.Errorf("Expected slice of structs written as a list, got %s", endpoints.Type)
+	}
+
+	if config.Exists("secret") {
+		t.Errorf("Expected unexported field to be skipped")
+	}
+
+	var decoded settings
+	if err := config.Unmarshal(&decoded); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	source.secret = ""
+	if !reflect.DeepEqual(decoded, source) {
+		t.Errorf("Expected %+v after round-trip, got %+v", source, decoded)
+	}
+
+	// Embedded structs are promoted into the enclosing group, as Unmarshal reads them
+	type base struct {
+		Name string `libconfig:"name"`
+		Port int    `libconfig:"port"`
+	}
+
+	type service struct {
+		base
+		*endpoint
+		Port int `libconfig:"port"`
+	}
+
+	data, err = MarshalStruct(&service{base: base{Name: "api", Port: 1}, endpoint: &endpoint{Host: "h"}, Port: 8080})
+	if err != nil {
+		t.Fatalf("Failed to marshal struct: %v", err)
+	}
+
+	if expected := "name = \"api\";\nport = 8080;\n"; string(data) != expected {
+		t.Errorf("Expected promoted fields:\n%s\ngot:\n%s", expected, data)
+	}
+
+	embedded, err := ParseBytes(data)
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v\n%s", err, data)
+	}
+
+	var service2 service
+	if err := embedded.Unmarshal(&service2); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if service2.Name != "api" || service2.Port != 8080 {
+		t.Errorf("Expected promoted fields after round-trip, got %+v", service2)
+	}
+
+	if _, err := MarshalStruct(42); !errors.Is(err, ErrInvalidMarshalSource) {
+		t.Errorf("Expected ErrInvalidMarshalSource, got %v", err)
+	}
+}
+
+// TestFromStructWideIntegers tests that integer slices stay arrays when some elements need 64 bits.
+func TestFromStructWideIntegers(t *testing.T) {
+	config, err := FromStruct(struct {
+		Sizes []int   `libconfig:"sizes"`
+		Small []int32 `libconfig:"small"`
+	}{Sizes: []int{1, 5000000000}, Small: []int32{1, 2}})
+	if err != nil {
+		t.Fatalf("Failed to build config: %v", err)
+	}
+
+	sizes, _ := config.Lookup("sizes")
+	if sizes.Type != TypeArray {
+		t.Fatalf("Expected sizes to be an array, got %s", sizes.Type)
+	}
+
+	for i, element := range sizes.ArrayVal {
+		if element.Type != TypeInt64 {
+			t.Errorf("Expected sizes[%d] widened to int64, got %s", i, element.Type)
+		}
+	}
+
+	if small, _ := config.Lookup("small"); small.Type != TypeArray || small.ArrayVal[0].Type != TypeInt {
+		t.Errorf("Expected small to stay an array of 32-bit integers, got %s", small.Type)
+	}
+
+	var sb strings.Builder
+	if err := config.Write(&sb); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if !strings.Contains(sb.String(), "sizes = [ 1L, 5000000000L ];") {
+		t.Errorf("Expected sizes written as an int64 array, got:\n%s", sb.String())
+	}
+
+	reparsed, err := ParseString(sb.String())
+	if err != nil {
+		t.Fatalf("Failed to parse written config: %v\n%s", err, sb.String())
+	}
+
+	resized, _ := reparsed.Lookup("sizes")
+	if len(resized.ArrayVal) != 2 || resized.ArrayVal[1].Type != TypeInt64 || resized.ArrayVal[1].Int64Val != 5000000000 {
+		t.Errorf("Expected sizes to read back as int64, got %v", resized.ArrayVal)
+	}
+}
@@ -0,0 +1,143 @@
+package libconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrDuplicateKey is reported by Lint for a setting defined twice in the
+// same group.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// lintMaxDepth is the nesting depth beyond which Lint reports an error.
+const lintMaxDepth = 64
+
+// Severity classifies a Diagnostic.
+type Severity int
+
+const (
+	// SeverityError marks a problem that makes parsing fail.
+	SeverityError Severity = iota
+	// SeverityWarning marks a suspicious construct that still parses.
+	SeverityWarning
+)
+
+// String returns the lowercase name of the severity.
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "unknown"
+	}
+}
+
+// Diagnostic is a single problem found by Lint.
+type Diagnostic struct {
+	Err      error // Underlying error, for use with errors.Is
+	Message  string
+	Pos      Position
+	Severity Severity
+}
+
+// String formats the diagnostic as position: severity: message.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Severity, d.Message)
+}
+
+// Lint checks filename and the files it includes without stopping at the
+// first problem, for use by linting tools. Syntax errors are reported and
+// parsing resumes at the next statement. Unresolvable includes, include
+// nesting beyond the include limit and collection nesting deeper than 64
+// levels are errors; a setting defined twice in the same group is a
+// warning. Diagnostics are returned in the order found; nil means the file
+// is clean.
+func Lint(filename string) []Diagnostic {
+	return lintFile(filename, 0, false)
+}
+
+// ParseTolerant parses input as ParseStringWithOptions does, but skips
+// invalid tokens, such as a stray @ or a character that starts no token,
+// instead of failing on them, for highlighters and other tools that want as
+// much structure as they can get. Each skipped token is returned as a
+// diagnostic wrapping ErrInvalidToken, in the order found, along with the
+// configuration parsed from the rest of the input. Syntax errors in the
+// remaining tokens, such as a missing value, still fail the parse; the
+// error is then returned with the diagnostics and the settings parsed up to
+// that point.
+func ParseTolerant(input string, opts Options) (*Config, []Diagnostic, error) {
+	lexer := newStringLexer(input, opts)
+	parser := NewParserWithOptions(lexer, opts)
+	parser.tolerant = true
+	parser.skipInvalid()
+
+	config, err := parser.Parse()
+	if err != nil {
+		return parser.partial, parser.diagnostics, err
+	}
+
+	return config, parser.diagnostics, nil
+}
+
+// lintFile lints filename at the given include depth. elements marks a file
+// included inside an array or list, which holds elements rather than
+// settings.
+func lintFile(filename string, depth int, elements bool) []Diagnostic {
+	file, err := os.Open(filename)
+	if err != nil {
+		return []Diagnostic{{
+			Err:      err,
+			Message:  fmt.Sprintf("failed to open file: %v", err),
+			Pos:      Position{File: filename},
+			Severity: SeverityError,
+		}}
+	}
+
+	lexer := NewLexer(file)
+	file.Close() // The lexer has consumed the whole file
+
+	parser := NewParserWithOptions(lexer, Options{MaxDepth: lintMaxDepth})
+	parser.baseDir = filepath.Dir(filename)
+	parser.filename = filename
+	parser.lint = true
+
+	if elements {
+		_, err = parser.parseElementFile()
+	} else {
+		_, err = parser.Parse()
+	}
+
+	if err != nil {
+		// Only errors that prevent lexing reach here
+		return []Diagnostic{{Err: err, Message: err.Error(), Pos: Position{File: filename}, Severity: SeverityError}}
+	}
+
+	diagnostics := parser.diagnostics
+
+	for _, include := range parser.includes {
+		if depth >= maxIncludeDepth {
+			diagnostics = append(diagnostics, Diagnostic{
+				Err:      ErrIncludeDepthExceeded,
+				Message:  fmt.Sprintf("include depth limit exceeded (%d)", maxIncludeDepth),
+				Pos:      include.pos,
+				Severity: SeverityError,
+			})
+
+			continue
+		}
+
+		resolved, err := resolveIncludePath(parser.baseDir, include.path)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{Err: err, Message: err.Error(), Pos: include.pos, Severity: SeverityError})
+			continue
+		}
+
+		diagnostics = append(diagnostics, lintFile(resolved, depth+1, include.elements)...)
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,196 @@
+package libconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Loader builds a configuration from layered sources. Sources are applied in
+// the order they were added, each one deep-merged over the previous ones, so
+// a typical precedence chain is defaults, then files, then environment
+// variables, then explicit overrides:
+//
+//	config, err := libconfig.NewLoader().
+//		AddDefaults(defaults).
+//		AddFile("/etc/app.cfg").
+//		AddEnv("APP").
+//		Build()
+type Loader struct {
+	sources []func() (*Config, error)
+}
+
+// NewLoader creates an empty loader.
+func NewLoader() *Loader {
+	return &Loader{}
+}
+
+// AddDefaults adds a configuration providing default values.
+func (l *Loader) AddDefaults(config *Config) *Loader {
+	return l.add(func() (*Config, error) { return config, nil })
+}
+
+// AddFile adds a libconfig file, parsed when Build is called.
+func (l *Loader) AddFile(filename string) *Loader {
+	return l.add(func() (*Config, error) { return ParseFile(filename) })
+}
+
+// AddEnv adds the environment variables starting with prefix followed by an
+// underscore. The rest of the variable name is lowercased and split on double
+// underscores to form the setting path, so APP_DATABASE__HOST sets
+// database.host. Values that parse as libconfig scalars, arrays or lists
+// keep their type; anything else is used as a string.
+func (l *Loader) AddEnv(prefix string) *Loader {
+	return l.add(func() (*Config, error) { return configFromEnv(prefix, os.Environ()) })
+}
+
+// AddOverride adds a configuration whose values take precedence over the
+// sources added before it.
+func (l *Loader) AddOverride(config *Config) *Loader {
+	return l.add(func() (*Config, error) { return config, nil })
+}
+
+// add appends a source to the loader.
+func (l *Loader) add(source func() (*Config, error)) *Loader {
+	l.sources = append(l.sources, source)
+	return l
+}
+
+// Build applies all sources in order and returns the combined
+// configuration. Errors from individual sources are collected rather than
+// aborting the build: the returned configuration holds everything that could
+// be loaded, and the returned error joins all collected errors.
+func (l *Loader) Build() (*Config, error) {
+	result := NewConfig()
+
+	var errs []error
+
+	for _, source := range l.sources {
+		config, err := source()
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if config != nil {
+			mergeValues(&result.Root, config.Root)
+		}
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// configFromEnv builds a configuration from the environment entries in environ
+// that carry the given prefix.
+func configFromEnv(prefix string, environ []string) (*Config, error) {
+	config := NewConfig()
+
+	sort.Strings(environ)
+
+	var errs []error
+
+	for _, entry := range environ {
+		name, raw, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(name, prefix+"_") {
+			continue
+		}
+
+		path := strings.ToLower(strings.TrimPrefix(name, prefix+"_"))
+		if path == "" {
+			continue
+		}
+
+		if err := setPath(&config.Root, strings.Split(path, "__"), parseEnvValue(raw)); err != nil {
+			errs = append(errs, fmt.Errorf("environment variable %s: %w", name, err))
+		}
+	}
+
+	return config, errors.Join(errs...)
+}
+
+// parseEnvValue interprets an environment variable value as a libconfig
+// value, falling back to a plain string.
+func parseEnvValue(raw string) Value {
+	parser := NewParser(NewLexer(strings.NewReader(raw)))
+
+	value, err := parser.parseValue()
+	if err != nil || parser.current.Type != TokenEOF || value.Type == TypeGroup {
+		return NewStringValue(raw)
+	}
+
+	value.Pos = Position{}
+
+	return value
+}
+
+// EnvRefs returns the names of the environment variables referenced as
+// ${NAME} in string values anywhere in the configuration, deduplicated and
+// sorted. This package never expands ${NAME}; the references are kept as
+// literal text, and EnvRefs is for external tooling that expands them, such
+// as a startup check reporting unset variables before a deployment script
+// substitutes them. Names follow shell rules: a letter or underscore
+// followed by letters, digits and underscores.
+func (c *Config) EnvRefs() []string {
+	seen := make(map[string]bool)
+	collectEnvRefs(&c.Root, seen)
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// collectEnvRefs records the variables referenced in v and the values
+// inside it.
+func collectEnvRefs(v *Value, seen map[string]bool) {
+	switch v.Type {
+	case TypeString:
+		text := v.StrVal
+
+		for {
+			start := strings.Index(text, "${")
+			if start < 0 {
+				return
+			}
+
+			text = text[start+2:]
+
+			end := strings.IndexByte(text, '}')
+			if end < 0 {
+				return
+			}
+
+			if isEnvName(text[:end]) {
+				seen[text[:end]] = true
+			}
+		}
+	case TypeGroup:
+		for _, member := range v.GroupVal {
+			collectEnvRefs(&member, seen)
+		}
+	case TypeArray, TypeList:
+		for _, element := range v.Iter() {
+			collectEnvRefs(&element, seen)
+		}
+	}
+}
+
+// isEnvName reports whether name is a valid environment variable name.
+func isEnvName(name string) bool {
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return false
+	}
+
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+
+	return true
+}
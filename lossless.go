@@ -0,0 +1,123 @@
+package libconfig
+
+import (
+	"strings"
+)
+
+// ParseResult is the result of ParseLossless: the parsed configuration
+// together with every token of the input.
+type ParseResult struct {
+	Config *Config
+
+	// Tokens holds the tokens of the input in order, including
+	// TokenComment and TokenWhitespace tokens for the text between the
+	// others, and ends with TokenEOF. Their byte ranges are contiguous, so
+	// concatenating input[t.Start:t.End] over all tokens reproduces the
+	// input exactly. Comment and whitespace tokens carry their text as
+	// their Value.
+	Tokens []Token
+}
+
+// ParseLossless parses input as ParseStringWithOptions does and also returns
+// its full token stream, comments and whitespace included, for formatters
+// and other tools that rewrite a file while keeping everything they do not
+// touch. A leading byte order mark is returned as whitespace.
+func ParseLossless(input string, opts Options) (*ParseResult, error) {
+	// The parser consumes its lexer's tokens, so a second lexer collects
+	// them for the result
+	tokens := newStringLexer(input, opts).drain()
+
+	config, err := NewParserWithOptions(newStringLexer(input, opts), opts).Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ParseResult{Config: config, Tokens: withTrivia(input, tokens, opts)}, nil
+}
+
+// withTrivia returns tokens with comment and whitespace tokens inserted for
+// the text of input that lies between them.
+func withTrivia(input string, tokens []Token, opts Options) []Token {
+	result := make([]Token, 0, 2*len(tokens))
+	pos, line, column := 0, 1, 1
+
+	for _, token := range tokens {
+		for pos < token.Start {
+			text := triviaAt(input[pos:token.Start], opts)
+
+			tokenType := TokenWhitespace
+			if !isBlank(text, opts) {
+				tokenType = TokenComment
+			}
+
+			result = append(result, Token{Value: text, Type: tokenType, Line: line, Column: column, Start: pos, End: pos + len(text)})
+			line, column = advancePosition(text, line, column)
+			pos += len(text)
+		}
+
+		result = append(result, token)
+
+		if token.End > pos {
+			line, column = advancePosition(input[pos:token.End], line, column)
+			pos = token.End
+		}
+	}
+
+	return result
+}
+
+// triviaAt returns the comment or run of whitespace at the start of gap,
+// which holds only comments and whitespace. Comments running to the end of
+// the line stop before the newline.
+func triviaAt(gap string, opts Options) string {
+	switch {
+	case strings.HasPrefix(gap, "#"), strings.HasPrefix(gap, "//"), opts.SQLComments && strings.HasPrefix(gap, "--"):
+		if end := strings.IndexByte(gap, '\n'); end >= 0 {
+			return gap[:end]
+		}
+
+		return gap
+	case strings.HasPrefix(gap, "/*"):
+		if end := strings.Index(gap[2:], "*/"); end >= 0 {
+			return gap[:end+4]
+		}
+
+		return gap
+	}
+
+	end := strings.IndexFunc(gap, func(r rune) bool {
+		return r == '#' || r == '/' || (opts.SQLComments && r == '-')
+	})
+	if end <= 0 {
+		return gap
+	}
+
+	return gap[:end]
+}
+
+// isBlank reports whether text is whitespace to the lexer: spaces, a byte
+// order mark, and backslash line continuations with
+// Options.LineContinuation.
+func isBlank(text string, opts Options) bool {
+	text = strings.TrimPrefix(text, utf8BOM)
+	if opts.LineContinuation {
+		text = strings.NewReplacer("\\\r\n", "", "\\\n", "").Replace(text)
+	}
+
+	return strings.TrimSpace(text) == ""
+}
+
+// advancePosition returns the line and column reached after text starting
+// at line and column, counting columns in characters as the lexer does.
+func advancePosition(text string, line, column int) (int, int) {
+	for _, r := range text {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+
+	return line, column
+}
@@ -0,0 +1,375 @@
+package libconfig
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Predefined encoding errors for better error handling and testing.
+var (
+	ErrInvalidMarshalSource = errors.New("marshal source must be a struct or a non-nil pointer to a struct")
+)
+
+// Marshaler is implemented by types that encode themselves as a
+// configuration value, like json.Marshaler. FromStruct uses the value it
+// returns in place of the built-in encoding.
+type Marshaler interface {
+	MarshalLibconfig() (Value, error)
+}
+
+// FromStruct builds a configuration from the struct v or the struct v points
+// to, the inverse of Unmarshal.
+//
+// Exported fields become settings named by their `libconfig:"name"` tag, or
+// otherwise by the field name; a dotted tag such as `libconfig:"server.port"`
+// places the setting in nested groups. Fields tagged `libconfig:"-"` and
+// unexported fields are skipped, as are nil pointers and interfaces. With the
+// omitempty option, as in `libconfig:"port,omitempty"`, a field is also
+// skipped when it holds false, zero, an empty string, or an empty slice,
+// array or map, mirroring encoding/json.
+//
+// Structs and maps with string keys become groups, settings keeping the
+// field order and map keys sorted. The fields of embedded structs without a
+// name tag are promoted into the enclosing group, as Unmarshal reads them.
+// Slices and arrays become arrays when their elements are scalars of one
+// type and lists otherwise. int64 and uint64 fields, and int and uint fields
+// holding values beyond 32 bits, become 64-bit integers; a sequence holding
+// any 64-bit integer has all of its integers widened, so that it stays an
+// array. Values implementing Marshaler encode themselves; a method with a
+// pointer receiver is only found when v is a pointer.
+func FromStruct(v any) (*Config, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("got %T: %w", v, ErrInvalidMarshalSource)
+	}
+
+	config := NewConfig()
+	if err := encodeStruct("", rv, &config.Root); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// MarshalStruct returns the struct v, or the struct v points to, as
+// libconfig text: the configuration FromStruct builds, written by Write.
+// Unmarshal of the parsed text fills an equal struct, for the types both
+// support.
+func MarshalStruct(v any) ([]byte, error) {
+	config, err := FromStruct(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return Marshal(config)
+}
+
+// encodeStruct adds the fields of the struct rv to group.
+func encodeStruct(path string, rv reflect.Value, group *Value) error {
+	return encodeFields(path, rv, group, nil)
+}
+
+// encodeFields adds the fields of the struct rv to group. The fields of
+// embedded structs without a name tag are promoted into the same group, as
+// Unmarshal reads them, unless a shallower field in shadowed has the same
+// name.
+func encodeFields(path string, rv reflect.Value, group *Value, shadowed map[string]bool) error {
+	rt := rv.Type()
+
+	// Fields at this level hide promoted fields of the same name
+	own := make(map[string]bool, len(shadowed)+rt.NumField())
+	for name := range shadowed {
+		own[name] = true
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		if field := rt.Field(i); !isPromoted(field) {
+			own[strings.ToLower(fieldName(field))] = true
+		}
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+
+		if isPromoted(field) {
+			embedded := rv.Field(i)
+			if embedded.Kind() == reflect.Pointer {
+				// The struct behind an unexported pointer cannot be read
+				if embedded.IsNil() || !field.IsExported() {
+					continue
+				}
+
+				embedded = embedded.Elem()
+			}
+
+			if err := encodeFields(path, embedded, group, own); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts := parseTag(field)
+		if shadowed[strings.ToLower(name)] {
+			continue
+		}
+
+		parts := Compile(name).parts
+
+		fv := rv.Field(i)
+		if len(parts) == 0 || (opts.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+
+		fieldPath := path
+		for _, part := range parts {
+			fieldPath = joinPath(fieldPath, part)
+		}
+
+		val, ok, err := encodeValue(fieldPath, fv)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := setPath(group, parts, val); err != nil {
+			return fmt.Errorf("field %s for '%s': %w", field.Name, fieldPath, err)
+		}
+	}
+
+	return nil
+}
+
+// encodeValue converts rv into a value. It reports false for nil pointers
+// and interfaces, which have no value to write.
+func encodeValue(path string, rv reflect.Value) (Value, bool, error) {
+	if m, ok := marshaler(rv); ok {
+		val, err := m.MarshalLibconfig()
+		if err != nil {
+			return Value{}, false, fmt.Errorf("value at '%s': %w", path, err)
+		}
+
+		return val, true, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return Value{}, false, nil
+		}
+
+		return encodeValue(path, rv.Elem())
+	case reflect.Bool:
+		return NewBoolValue(rv.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeInt(rv.Int(), rv.Kind() == reflect.Int64), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := rv.Uint()
+		if n > math.MaxInt64 {
+			return Value{}, false, fmt.Errorf("value %d at '%s': %w", n, path, ErrIntegerOutOfRange)
+		}
+
+		return encodeInt(int64(n), rv.Kind() == reflect.Uint64), true, nil
+	case reflect.Float32, reflect.Float64:
+		return NewFloatValue(rv.Float()), true, nil
+	case reflect.String:
+		return NewStringValue(rv.String()), true, nil
+	case reflect.Struct:
+		group := NewGroupValue(make(map[string]Value))
+		if err := encodeStruct(path, rv, &group); err != nil {
+			return Value{}, false, err
+		}
+
+		return group, true, nil
+	case reflect.Map:
+		val, err := encodeMap(path, rv)
+		return val, err == nil, err
+	case reflect.Slice, reflect.Array:
+		val, err := encodeSequence(path, rv)
+		return val, err == nil, err
+	default:
+		return Value{}, false, fmt.Errorf("value at '%s' has type %s: %w", path, rv.Type(), ErrUnsupportedType)
+	}
+}
+
+// marshaler returns the Marshaler that encodes rv, if its type implements
+// the interface or rv is addressable and a pointer to it does. Nil pointers
+// and interfaces have none.
+func marshaler(rv reflect.Value) (Marshaler, bool) {
+	if !rv.CanInterface() || ((rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && rv.IsNil()) {
+		return nil, false
+	}
+
+	if m, ok := rv.Interface().(Marshaler); ok {
+		return m, true
+	}
+
+	if !rv.CanAddr() {
+		return nil, false
+	}
+
+	m, ok := rv.Addr().Interface().(Marshaler)
+
+	return m, ok
+}
+
+// encodeInt returns n as a 32-bit integer value when it fits and wide is
+// false, and as a 64-bit integer value otherwise.
+func encodeInt(n int64, wide bool) Value {
+	if wide || n < math.MinInt32 || n > math.MaxInt32 {
+		return NewInt64Value(n)
+	}
+
+	return NewIntValue(int(n))
+}
+
+// encodeMap converts a map with string keys into a group with sorted keys.
+func encodeMap(path string, rv reflect.Value) (Value, error) {
+	if rv.Type().Key().Kind() != reflect.String {
+		return Value{}, fmt.Errorf("map at '%s' has type %s: %w", path, rv.Type(), ErrUnsupportedType)
+	}
+
+	entries := make(map[string]reflect.Value, rv.Len())
+	keys := make([]string, 0, rv.Len())
+
+	for iter := rv.MapRange(); iter.Next(); {
+		key := iter.Key().String()
+		entries[key] = iter.Value()
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	group := NewGroupValue(make(map[string]Value, len(keys)))
+
+	for _, key := range keys {
+		val, ok, err := encodeValue(joinPath(path, key), entries[key])
+		if err != nil {
+			return Value{}, err
+		}
+
+		if ok {
+			group.setMember(key, val)
+		}
+	}
+
+	return group, nil
+}
+
+// encodeSequence converts a slice or array into an array when its elements
+// are scalars of one type, and into a list otherwise. Nil elements become
+// nulls, which fit any array element type. Integers count as one type: when
+// any of them needs 64 bits, all of them are widened to 64-bit integers.
+func encodeSequence(path string, rv reflect.Value) (Value, error) {
+	elements := make([]Value, 0, rv.Len())
+	elementType := TypeNull
+	homogeneous := true
+	wide := false
+
+	for i := range rv.Len() {
+		val, ok, err := encodeValue(fmt.Sprintf("%s[%d]", path, i), rv.Index(i))
+		if err != nil {
+			return Value{}, err
+		}
+
+		if !ok {
+			val = NewNullValue()
+		}
+
+		scalarType := val.Type
+		if scalarType == TypeInt64 {
+			scalarType, wide = TypeInt, true
+		}
+
+		switch {
+		case val.isCollection():
+			homogeneous = false
+		case scalarType == TypeNull:
+		case elementType == TypeNull:
+			elementType = scalarType
+		case scalarType != elementType:
+			homogeneous = false
+		}
+
+		elements = append(elements, val)
+	}
+
+	if !homogeneous {
+		return NewListValue(elements), nil
+	}
+
+	if wide {
+		for i, element := range elements {
+			if element.Type == TypeInt {
+				elements[i] = NewInt64Value(int64(element.IntVal))
+				elements[i].Radix = element.Radix
+			}
+		}
+	}
+
+	return NewArrayValue(elements), nil
+}
+
+// tagOptions holds the options that follow the name in a struct tag.
+type tagOptions struct {
+	omitEmpty bool
+}
+
+// parseTag returns the config name of a struct field and its tag options.
+// The name is "" if the field is skipped.
+func parseTag(field reflect.StructField) (string, tagOptions) {
+	tag := field.Tag.Get(tagName)
+	if tag == "-" {
+		return "", tagOptions{}
+	}
+
+	name, rest, _ := strings.Cut(tag, ",")
+
+	var opts tagOptions
+
+	for rest != "" {
+		var opt string
+
+		opt, rest, _ = strings.Cut(rest, ",")
+		if opt == "omitempty" {
+			opts.omitEmpty = true
+		}
+	}
+
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, opts
+}
+
+// isEmptyValue reports whether rv is empty in the sense of omitempty.
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return rv.IsZero()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,168 @@
+package libconfig
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Merge deep-merges other into the configuration. Groups present in both are
+// merged recursively; any other value in other replaces the existing value
+// at the same path. The merged values are copied, so later changes to other
+// do not affect the configuration. Merge returns ErrConfigFrozen if the
+// configuration is frozen.
+func (c *Config) Merge(other *Config) error {
+	if c.frozen {
+		return fmt.Errorf("cannot merge: %w", ErrConfigFrozen)
+	}
+
+	mergeValues(&c.Root, other.Root)
+
+	return nil
+}
+
+// MergeMap deep-merges generic Go data, such as overrides decoded from JSON
+// or collected from flags, into the configuration, like Merge. Values are
+// converted as by FromStruct: nested maps with string keys become groups,
+// slices become arrays or lists, and nil map values are skipped. A nil
+// slice element becomes a null element, which only parses back from written
+// text with Options.Nulls. A value of an unsupported kind returns
+// ErrUnsupportedType with its path, and nothing is merged. MergeMap returns
+// ErrConfigFrozen if the configuration is frozen.
+func (c *Config) MergeMap(m map[string]any) error {
+	if c.frozen {
+		return fmt.Errorf("cannot merge: %w", ErrConfigFrozen)
+	}
+
+	group, err := encodeMap("", reflect.ValueOf(m))
+	if err != nil {
+		return err
+	}
+
+	mergeValues(&c.Root, group)
+
+	return nil
+}
+
+// ToMap converts the configuration into generic Go data, the inverse of
+// MergeMap. Groups become map[string]any, arrays and lists []any, and
+// scalars int, int64, float64, bool and string.
+func (c *Config) ToMap() map[string]any {
+	result, _ := c.Root.native().(map[string]any)
+	return result
+}
+
+// MergeFunc deep-merges other into the configuration like Merge, but calls
+// resolve for each setting present in both that is not a group in both,
+// with its path, the existing value and the value from other, and keeps the
+// value resolve returns. Groups present in both are still merged
+// recursively, so resolve only sees leaf conflicts; it can implement
+// policies such as keeping the larger number. The values passed to resolve
+// are copies. MergeFunc returns ErrConfigFrozen if the configuration is
+// frozen.
+func (c *Config) MergeFunc(other *Config, resolve func(path string, a, b Value) Value) error {
+	if c.frozen {
+		return fmt.Errorf("cannot merge: %w", ErrConfigFrozen)
+	}
+
+	mergeValuesFunc(&c.Root, other.Root, "", resolve)
+
+	return nil
+}
+
+// mergeValues deep-merges source into target.
+func mergeValues(target *Value, source Value) {
+	mergeValuesFunc(target, source, "", nil)
+}
+
+// mergeValuesFunc deep-merges source into target, the value at path. When
+// resolve is not nil it decides between the two values of each leaf
+// conflict; otherwise source wins.
+func mergeValuesFunc(target *Value, source Value, path string, resolve func(path string, a, b Value) Value) {
+	if target.Type != TypeGroup || source.Type != TypeGroup {
+		if resolve != nil {
+			*target = cloneValue(resolve(path, cloneValue(*target), cloneValue(source)))
+		} else {
+			*target = cloneValue(source)
+		}
+
+		return
+	}
+
+	for _, key := range source.MemberKeys() {
+		value := source.GroupVal[key]
+
+		existing, ok := target.GroupVal[key]
+		if !ok {
+			target.setMember(key, cloneValue(value))
+			continue
+		}
+
+		mergeValuesFunc(&existing, value, joinPath(path, key), resolve)
+		target.GroupVal[key] = existing
+	}
+}
+
+// cloneValue returns a deep copy of v that shares no slices or maps with it.
+func cloneValue(v Value) Value {
+	switch v.Type {
+	case TypeArray:
+		v.ArrayVal = cloneValues(v.ArrayVal)
+	case TypeList:
+		v.ListVal = cloneValues(v.ListVal)
+	case TypeGroup:
+		if v.GroupVal != nil {
+			group := make(map[string]Value, len(v.GroupVal))
+			for key, member := range v.GroupVal {
+				group[key] = cloneValue(member)
+			}
+
+			v.GroupVal = group
+		}
+
+		v.Keys = slices.Clone(v.Keys)
+	default:
+	}
+
+	return v
+}
+
+// cloneValues deep-copies a slice of values.
+func cloneValues(vals []Value) []Value {
+	if vals == nil {
+		return nil
+	}
+
+	result := make([]Value, len(vals))
+	for i, val := range vals {
+		result[i] = cloneValue(val)
+	}
+
+	return result
+}
+
+// setPath stores value at the path given by parts below target, creating
+// intermediate groups as needed.
+func setPath(target *Value, parts []string, value Value) error {
+	if target.Type != TypeGroup {
+		return fmt.Errorf("cannot set '%s': %w", parts[0], ErrCannotLookupInNonGroup)
+	}
+
+	if len(parts) == 1 {
+		target.setMember(parts[0], value)
+		return nil
+	}
+
+	child, ok := target.GroupVal[parts[0]]
+	if !ok {
+		child = NewGroupValue(make(map[string]Value))
+	}
+
+	if err := setPath(&child, parts[1:], value); err != nil {
+		return err
+	}
+
+	target.setMember(parts[0], child)
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package libconfig
+
+import (
+	"path/filepath"
+	"unsafe"
+)
+
+// ParseFileMmap parses a libconfig file like ParseFile, but memory-maps the
+// file and lexes the mapped pages in place rather than reading a copy of it
+// into the heap, which helps with large, mostly static files. The mapping is
+// released before ParseFileMmap returns. The file must not be truncated
+// while it is being parsed. On platforms without mmap, and for files that
+// cannot be mapped, such as empty files and pipes, the file is read into
+// memory instead.
+func ParseFileMmap(filename string) (*Config, error) {
+	data, release, err := mapFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	// The lexer copies the text of every token it returns, so the
+	// configuration never refers to the mapping once parsing is done.
+	// Comments and directives are sliced from the input, but they are only
+	// kept with Options.PreserveComments, which is not set here
+	lexer := newStringLexer(unsafe.String(unsafe.SliceData(data), len(data)), Options{})
+	parser := NewParserWithOptions(lexer, Options{})
+	parser.baseDir = filepath.Dir(filename)
+	parser.filename = filename
+
+	return parser.Parse()
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package libconfig
+
+import (
+	"fmt"
+	"os"
+)
+
+// mapFile reads filename into memory, as memory-mapping is not available on
+// this platform, and returns its contents with a function that does nothing.
+func mapFile(filename string) ([]byte, func(), error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return data, func() {}, nil
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package libconfig
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// mapFile maps filename into memory read-only and returns the mapped bytes
+// with a function releasing them. Files that cannot be mapped are read into
+// memory instead.
+func mapFile(filename string) ([]byte, func(), error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	// The mapping stays valid after the file is closed
+	defer func() {
+		file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	if size := info.Size(); info.Mode().IsRegular() && size > 0 && size == int64(int(size)) {
+		data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err == nil {
+			return data, func() { _ = syscall.Munmap(data) }, nil
+		}
+	}
+
+	// Empty files, pipes and filesystems without mmap support are read
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return data, func() {}, nil
+}
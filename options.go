@@ -0,0 +1,165 @@
+package libconfig
+
+import (
+	"fmt"
+	"time"
+)
+
+// Options controls optional parser behavior. The zero value parses the
+// standard libconfig syntax, which is what ParseFile, ParseString and Parse
+// use.
+type Options struct {
+	// BaseDir is the directory that relative @include paths are resolved
+	// against when parsing from a string or reader. When it is empty,
+	// includes are resolved relative to the process working directory.
+	// Files parsed with ParseFile always resolve includes relative to their
+	// own directory, and BaseDir is ignored for them.
+	BaseDir string
+
+	// IncludeResolver opens the sources named by @include directives. When
+	// it is nil, includes are read from the local filesystem.
+	IncludeResolver IncludeResolver
+
+	// IncludeTimeout bounds how long resolving and reading a single include
+	// may take. The resolver receives a context that expires after the
+	// timeout, and reading its source stops then too, so a hung include
+	// fails with context.DeadlineExceeded instead of blocking the parse.
+	// Zero means no timeout.
+	IncludeTimeout time.Duration
+
+	// RecordIncludes records each include directive that is followed, with
+	// the source it resolved to, for Config.Includes.
+	RecordIncludes bool
+
+	// BareInclude also treats `include "file"` at statement position as an
+	// include directive, as written by some libconfig dialects. It is opt-in
+	// because include is otherwise a valid setting name.
+	BareInclude bool
+
+	// SQLComments enables SQL-style `-- comment` comments running to the end
+	// of the line. It is opt-in because `-` otherwise introduces negative
+	// numbers.
+	SQLComments bool
+
+	// PreserveComments keeps comments in the parsed tree instead of
+	// discarding them, so that Config.Write can re-emit them. Comments on
+	// the lines before a setting are stored in its value's Comments, a
+	// comment after it on the same line in LineComment, and comments after
+	// the last setting of a group or file in the group's TrailingComments.
+	PreserveComments bool
+
+	// MaxSettings limits how many values a parse may produce, counting
+	// every setting and every array or list element, including those from
+	// included files. Parsing fails with ErrTooManySettings once the limit
+	// would be exceeded. Zero means no limit.
+	MaxSettings int
+
+	// MaxDepth limits how deeply groups, arrays and lists may nest; a value
+	// of 1 allows collections at the top level but nothing inside them.
+	// Parsing fails with ErrMaxDepthExceeded beyond the limit. Zero means no
+	// limit.
+	MaxDepth int
+
+	// StrictSemicolons requires every setting to end with ';'. A file can
+	// enable it for itself with a "# libconfig:strict" header comment.
+	StrictSemicolons bool
+
+	// DisableIncludes makes @include directives an error with
+	// ErrIncludesDisabled. A file can enable it for itself with a
+	// "# libconfig:no-includes" header comment.
+	DisableIncludes bool
+
+	// TrackSpans records the byte range of each value's text in Value.Span,
+	// for tools that rewrite parts of a file in place.
+	TrackSpans bool
+
+	// Nulls accepts the keyword null (in any case) as a value of TypeNull.
+	// A null array element is compatible with any element type, so
+	// [ 1, null, 3 ] is an int array. It is opt-in because null is not part
+	// of standard libconfig.
+	Nulls bool
+
+	// Extends lets a group inherit the members of another group named by an
+	// @extends or _extends key, as in web2 = { @extends = "web1"; };. The
+	// inheritance is resolved with Config.ResolveExtends once the whole
+	// input, including its includes, has been parsed.
+	Extends bool
+
+	// Keywords classifies bare identifiers before the built-in rules, which
+	// make true and false booleans and, with Nulls, null a null. Returning
+	// false leaves the identifier to the built-in rules. The hook returns
+	// a Keyword of type TokenBoolean, with the boolean's value, TokenNull or
+	// TokenIdentifier. A keyword can no longer be used as an unquoted
+	// setting name. KeywordMap provides a hook backed by a map.
+	Keywords func(ident string) (Keyword, bool)
+
+	// AllowedComments lists the comment styles a file may use, such as
+	// CommentHash alone to enforce a house style. A comment in any other
+	// style fails the parse with ErrCommentStyle and its position. Zero
+	// allows every style; SQL-style comments also need SQLComments.
+	AllowedComments CommentStyle
+
+	// AppendAssign accepts `name += value;` to append value as one element
+	// to the array or list already set as name earlier in the same group,
+	// for building up lists incrementally. Appending to a missing setting
+	// or one that is not an array or list fails with ErrAppendTarget, and
+	// an element that does not match an array's type with
+	// ErrArrayTypeMismatch.
+	AppendAssign bool
+
+	// TypeAnnotations accepts a type after a setting name, as in
+	// port: int = 8080;, and checks the value against it. The type is one
+	// of the ValueType names: int, int64, float, bool, string, array, list
+	// or group. A value of another type, or an unknown type name, fails
+	// with ErrTypeAnnotation; null fits any type.
+	TypeAnnotations bool
+
+	// Anchors lets a group be marked as an anchor with &name, as in
+	// base = &defaults { timeout = 30; };, and merged into a later group
+	// with the statement *name;, as in svc = { *defaults; port = 80; };.
+	// Anchored members are deep-merged beneath the group's own members, so
+	// its own members win, as with Extends. An anchor must be defined
+	// before it is referenced; an unknown anchor fails with
+	// ErrUnknownAnchor, a reference inside the anchored group itself with
+	// ErrAnchorCycle, and an anchor on anything but a group with
+	// ErrInvalidAnchor.
+	Anchors bool
+
+	// LineContinuation skips a backslash at the end of a line outside
+	// strings, so that a long setting can continue on the next line, as in
+	// value = "part1" \ followed by "part2"; on the next line. A backslash
+	// anywhere else is still an invalid token.
+	LineContinuation bool
+}
+
+// CommentStyle is a set of comment styles, combined with |.
+type CommentStyle int
+
+// Comment styles for Options.AllowedComments.
+const (
+	CommentHash  CommentStyle = 1 << iota // # script-style comments
+	CommentLine                           // C++-style // comments
+	CommentBlock                          // C-style /* */ comments
+	CommentSQL                            // SQL-style -- comments
+)
+
+// String returns the quoted comment marker of a single style, such as '//'.
+func (s CommentStyle) String() string {
+	switch s {
+	case CommentHash:
+		return "'#'"
+	case CommentLine:
+		return "'//'"
+	case CommentBlock:
+		return "'/*'"
+	case CommentSQL:
+		return "'--'"
+	default:
+		return fmt.Sprintf("CommentStyle(%d)", int(s))
+	}
+}
+
+// allowsComment reports whether comments of the given style are allowed.
+func (o Options) allowsComment(style CommentStyle) bool {
+	return o.AllowedComments == 0 || o.AllowedComments&style != 0
+}
@@ -1,11 +1,14 @@
 package libconfig
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // Predefined parser errors for better error handling and testing.
@@ -18,14 +21,60 @@ var (
 	ErrExpectedIdentifier         = errors.New("expected identifier")
 	ErrExpectedAssignment         = errors.New("expected assignment operator")
 	ErrArrayTypeMismatch          = errors.New("array elements must have the same type")
+	ErrDetachedSign               = errors.New("minus sign must be directly followed by a number")
+	ErrTooManySettings            = errors.New("too many settings")
+	ErrMaxDepthExceeded           = errors.New("nesting depth limit exceeded")
+	ErrExpectedSemicolon          = errors.New("expected semicolon")
+	ErrIncludesDisabled           = errors.New("includes are disabled")
+	ErrUnknownDirective           = errors.New("unknown directive")
+	ErrUnexpectedEOF              = errors.New("unexpected end of input")
+	ErrAppendTarget               = errors.New("append target must be an existing array or list")
+	ErrDecimalComma               = errors.New("comma used as decimal separator")
+	ErrTypeAnnotation             = errors.New("value does not match its type annotation")
+	ErrInvalidAnchor              = errors.New("anchor must mark a group")
+	ErrUnknownAnchor              = errors.New("unknown anchor")
+	ErrAnchorCycle                = errors.New("anchor refers to itself")
 )
 
 // Parser parses libconfig tokens into a configuration.
 type Parser struct {
 	lexer        *Lexer
 	baseDir      string // Directory of the main config file for resolving includes
+	filename     string // Name of the file being parsed, recorded in value positions
 	current      Token
-	includeDepth int // Track include depth to prevent infinite recursion
+	prevEnd      int    // End offset of the last consumed token
+	prevComment  string // Line comment of the last consumed token
+	opts         Options
+	inherited    Options // Options before this file's directives, passed on to included files
+	includeDepth int     // Track include depth to prevent infinite recursion
+	settings     int     // Values parsed so far, checked against Options.MaxSettings
+	depth        int     // Current collection nesting, checked against Options.MaxDepth
+
+	// Lint mode: syntax errors are recorded and parsing resumes at the next
+	// statement, and include directives are recorded instead of followed.
+	lint        bool
+	diagnostics []Diagnostic
+	includes    []includeRef
+
+	// Include directives followed, with Options.RecordIncludes.
+	records []IncludeRecord
+
+	// Tolerant mode: invalid tokens are recorded as diagnostics and skipped,
+	// and the configuration being built is kept for when parsing fails.
+	tolerant bool
+	partial  *Config
+
+	// Groups marked &name with Options.Anchors, and the names of anchored
+	// groups still being parsed.
+	anchors     map[string]Value
+	openAnchors map[string]bool
+}
+
+// includeRef is an include directive recorded in lint mode.
+type includeRef struct {
+	path     string
+	pos      Position
+	elements bool // Inside an array or list
 }
 
 // NewParser creates a new parser.
@@ -51,9 +100,38 @@ func NewParserWithBaseDir(lexer *Lexer, baseDir string) *Parser {
 	return p
 }
 
+// NewParserWithOptions creates a new parser using the given options.
+func NewParserWithOptions(lexer *Lexer, opts Options) *Parser {
+	p := &Parser{
+		lexer:     lexer,
+		baseDir:   opts.BaseDir,
+		opts:      opts,
+		inherited: opts,
+	}
+	p.advance()
+
+	return p
+}
+
 // advance moves to the next token.
 func (p *Parser) advance() {
+	p.prevEnd = p.current.End
+	p.prevComment = p.current.LineComment
 	p.current = p.lexer.NextToken()
+
+	if p.tolerant {
+		p.skipInvalid()
+	}
+}
+
+// skipInvalid records invalid tokens at the current position as diagnostics
+// and moves past them, for tolerant parsing.
+func (p *Parser) skipInvalid() {
+	for p.current.Type == TokenError {
+		err := fmt.Errorf("%q at line %d, column %d: %w", p.current.Value, p.current.Line, p.current.Column, ErrInvalidToken)
+		p.diagnostics = append(p.diagnostics, Diagnostic{Err: err, Message: err.Error(), Pos: p.position(), Severity: SeverityError})
+		p.current = p.lexer.NextToken()
+	}
 }
 
 // expect checks if the current token is of the expected type and advances.
@@ -70,123 +148,590 @@ func (p *Parser) expect(tokenType TokenType) error {
 
 // Parse parses the configuration.
 func (p *Parser) Parse() (*Config, error) {
+	config, err := p.parse()
+
+	// The lexer finds unreadable input as parsing reaches it, and the
+	// syntax errors that follow from it are less telling
+	if p.lexer.err != nil {
+		return nil, p.lexer.err
+	}
+
+	return config, err
+}
+
+// parse parses the configuration for Parse.
+func (p *Parser) parse() (*Config, error) {
+	if p.lexer.err != nil {
+		return nil, p.lexer.err
+	}
+
+	p.applyDirectives()
+
 	config := NewConfig()
+	p.partial = config
 
 	// Parse top-level settings
 	for p.current.Type != TokenEOF {
-		if p.current.Type == TokenInclude {
+		// Stray semicolons are empty statements
+		if p.current.Type == TokenSemicolon {
+			p.advance()
+			continue
+		}
+
+		if p.atInclude() {
 			// Handle @include directive
 			if err := p.parseInclude(&config.Root); err != nil {
-				return nil, err
+				if err := p.recoverFrom(err, false); err != nil {
+					return nil, err
+				}
 			}
 
 			continue
 		}
 
 		// Parse setting
-		name, value, err := p.parseSetting()
+		name, err := p.parseSetting(&config.Root)
 		if err != nil {
-			return nil, err
+			if err := p.recoverFrom(err, false); err != nil {
+				return nil, err
+			}
+
+			continue
 		}
 
-		config.Root.GroupVal[name] = value
+		if err := p.endSetting(name); err != nil {
+			if err := p.recoverFrom(err, false); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-		// Optional semicolon
-		if p.current.Type == TokenSemicolon {
-			p.advance()
+	config.Root.TrailingComments = p.current.Comments
+	config.includes = p.records
+
+	// Inheritance may refer across included files, so only the outermost
+	// parser resolves it
+	if p.opts.Extends && p.includeDepth == 0 && !p.lint {
+		if err := config.ResolveExtends(); err != nil {
+			return nil, err
 		}
 	}
 
 	return config, nil
 }
 
+// applyDirectives applies the directive comments in the file header to this
+// file's options. Unknown directives are ignored, or reported as warnings in
+// lint mode.
+func (p *Parser) applyDirectives() {
+	for _, d := range p.lexer.directives {
+		switch d.name {
+		case "strict":
+			p.opts.StrictSemicolons = true
+		case "no-includes":
+			p.opts.DisableIncludes = true
+		default:
+			if p.lint {
+				p.diagnostics = append(p.diagnostics, Diagnostic{
+					Err:      ErrUnknownDirective,
+					Message:  fmt.Sprintf("unknown directive '%s%s' is ignored", directivePrefix, d.name),
+					Pos:      Position{File: p.filename, Line: d.line, Column: d.column},
+					Severity: SeverityWarning,
+				})
+			}
+		}
+	}
+}
+
+// endSetting consumes the semicolon after a setting, which is optional
+// unless Options.StrictSemicolons is set.
+func (p *Parser) endSetting(name string) error {
+	if p.current.Type == TokenSemicolon {
+		p.advance()
+		return nil
+	}
+
+	if !p.opts.StrictSemicolons {
+		return nil
+	}
+
+	err := fmt.Errorf("expected ';' after setting '%s' at line %d, column %d: %w",
+		name, p.current.Line, p.current.Column, ErrExpectedSemicolon)
+
+	// The next statement is intact, so lint reports the error without
+	// skipping it
+	if p.lint {
+		p.diagnostics = append(p.diagnostics, Diagnostic{Err: err, Message: err.Error(), Pos: p.position(), Severity: SeverityError})
+		return nil
+	}
+
+	return err
+}
+
+// atInclude reports whether the current token starts an include directive.
+// With Options.BareInclude, an `include` identifier directly followed by a
+// string is an include as well; otherwise it is parsed as a setting name.
+func (p *Parser) atInclude() bool {
+	if p.current.Type == TokenInclude {
+		return true
+	}
+
+	return p.opts.BareInclude && p.current.Type == TokenIdentifier &&
+		p.current.Value == "include" && p.lexer.PeekToken().Type == TokenString
+}
+
 // parseInclude handles @include directives by actually parsing and merging the included files.
 func (p *Parser) parseInclude(target *Value) error {
-	if p.includeDepth >= 10 {
-		return fmt.Errorf("include depth limit exceeded (10) at line %d: %w", p.current.Line, ErrIncludeDepthExceeded)
+	included, ok, err := p.includeDirective(false)
+	if err != nil || !ok {
+		return err
 	}
 
+	includedConfig, err := included.Parse()
+	if err != nil {
+		return fmt.Errorf("error parsing included file '%s': %w", included.filename, err)
+	}
+
+	p.settings = included.settings
+	p.diagnostics = append(p.diagnostics, included.diagnostics...)
+	p.records = append(p.records, included.records...)
+
+	// Merge the included configuration into the target
+	mergeConfig(target, &includedConfig.Root)
+
+	return nil
+}
+
+// includeDirective consumes an include directive and returns a parser for
+// the included file, carrying over the resource limit counters. It reports
+// false in lint mode, where the directive is recorded instead of followed.
+// elements marks a directive inside an array or list, which takes no
+// semicolon.
+func (p *Parser) includeDirective(elements bool) (*Parser, bool, error) {
+	if p.includeDepth >= maxIncludeDepth {
+		return nil, false, fmt.Errorf("include depth limit exceeded (%d) at line %d: %w", maxIncludeDepth, p.current.Line, ErrIncludeDepthExceeded)
+	}
+
+	pos := p.position()
 	p.advance() // consume @include
 
+	if err := p.unterminatedString(); err != nil {
+		return nil, false, err
+	}
+
 	if p.current.Type != TokenString {
-		return fmt.Errorf("expected string after @include at line %d: %w", p.current.Line, ErrExpectedStringAfterInclude)
+		return nil, false, fmt.Errorf("expected string after @include at line %d: %w", p.current.Line, ErrExpectedStringAfterInclude)
 	}
 
 	includePath := p.current.Value
 	p.advance()
 
 	// Optional semicolon after include
-	if p.current.Type == TokenSemicolon {
+	if !elements && p.current.Type == TokenSemicolon {
 		p.advance()
 	}
 
-	// Resolve the include path relative to the base directory
-	var fullPath string
-	if p.baseDir != "" {
-		fullPath = filepath.Join(p.baseDir, includePath)
-	} else {
-		fullPath = includePath
+	if p.opts.DisableIncludes {
+		return nil, false, fmt.Errorf("@include at line %d, column %d: %w", pos.Line, pos.Column, ErrIncludesDisabled)
 	}
 
-	// Try common extensions if the file doesn't exist as-is
-	possiblePaths := []string{
-		fullPath,
-		fullPath + ".cnf",
-		fullPath + ".cfg",
+	// Lint checks included files separately
+	if p.lint {
+		p.includes = append(p.includes, includeRef{path: includePath, pos: pos, elements: elements})
+		return nil, false, nil
 	}
 
-	var existingPath string
+	lexer, name, err := p.openInclude(includePath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if p.opts.RecordIncludes {
+		p.records = append(p.records, IncludeRecord{Directive: includePath, Resolved: name, Line: pos.Line, File: p.filename})
+	}
+
+	included := NewParserWithOptions(lexer, p.inherited)
+	included.baseDir = filepath.Dir(name)
+	included.filename = name
+	included.includeDepth = p.includeDepth + 1
+	included.settings = p.settings
+	included.depth = p.depth
 
-	for _, path := range possiblePaths {
-		if fileExists(path) {
-			existingPath = path
+	if p.tolerant {
+		included.tolerant = true
+		included.skipInvalid()
+	}
+
+	return included, true, nil
+}
+
+// parseElementFile parses an included file that supplies elements to an
+// array or list. The file holds values separated by commas, as between the
+// brackets of an array, or a single array or list whose elements are
+// spliced in its place.
+func (p *Parser) parseElementFile() ([]Value, error) {
+	if p.lexer.err != nil {
+		return nil, p.lexer.err
+	}
+
+	p.applyDirectives()
+
+	bracketed := p.current.Type == TokenLeftBracket || p.current.Type == TokenLeftParen
+
+	var (
+		elements []Value
+		err      error
+	)
+
+	for p.current.Type != TokenEOF {
+		if elements, err = p.parseElement(elements); err != nil {
+			return nil, p.recoverFrom(err, false)
+		}
+
+		if p.current.Type != TokenComma {
 			break
 		}
+
+		p.advance()
+	}
+
+	if p.current.Type != TokenEOF {
+		err := fmt.Errorf("unexpected token %s at line %d, column %d: %w",
+			p.current.Type, p.current.Line, p.current.Column, ErrUnexpectedToken)
+
+		return nil, p.recoverFrom(err, false)
 	}
 
-	if existingPath == "" {
-		return fmt.Errorf("include file '%s' not found (tried: %v): %w", includePath, possiblePaths, ErrIncludeFileNotFound)
+	if p.lexer.err != nil {
+		return nil, p.lexer.err
 	}
 
-	// Parse the included file
-	includedConfig, err := parseFileWithDepth(existingPath, p.includeDepth+1)
-	if err != nil {
-		return fmt.Errorf("error parsing included file '%s': %w", existingPath, err)
+	if bracketed && len(elements) == 1 {
+		if elements[0].Type == TypeArray {
+			return elements[0].ArrayVal, nil
+		}
+
+		return elements[0].ListVal, nil
 	}
 
-	// Merge the included configuration into the target
-	mergeConfig(target, &includedConfig.Root)
+	return elements, nil
+}
+
+// recoverFrom handles a statement that failed to parse. Outside lint mode it
+// returns err unchanged. In lint mode it records err as a diagnostic, skips
+// to the start of the next statement and returns nil; inGroup tells whether
+// the statement is inside a group, whose closing brace must not be skipped.
+func (p *Parser) recoverFrom(err error, inGroup bool) error {
+	if !p.lint {
+		return err
+	}
+
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Err:      err,
+		Message:  err.Error(),
+		Pos:      p.position(),
+		Severity: SeverityError,
+	})
+
+	nesting := 0
+
+	for p.current.Type != TokenEOF {
+		switch p.current.Type {
+		case TokenLeftBrace, TokenLeftBracket, TokenLeftParen:
+			nesting++
+		case TokenRightBracket, TokenRightParen:
+			if nesting > 0 {
+				nesting--
+			}
+		case TokenRightBrace:
+			if nesting == 0 && inGroup {
+				return nil
+			}
+
+			if nesting > 0 {
+				nesting--
+			}
+		case TokenSemicolon:
+			if nesting == 0 {
+				p.advance()
+				return nil
+			}
+		default:
+		}
+
+		p.advance()
+	}
 
 	return nil
 }
 
-// parseSetting parses a name = value or name : value setting.
-func (p *Parser) parseSetting() (string, Value, error) {
-	if p.current.Type != TokenIdentifier {
-		return "", Value{}, fmt.Errorf("expected identifier at line %d, column %d: %w",
+// checkDuplicate records a warning in lint mode when group already has a
+// member named name.
+func (p *Parser) checkDuplicate(group *Value, name string, pos Position) {
+	if !p.lint {
+		return
+	}
+
+	if _, exists := group.GroupVal[name]; exists {
+		p.diagnostics = append(p.diagnostics, Diagnostic{
+			Err:      ErrDuplicateKey,
+			Message:  fmt.Sprintf("setting '%s' is already defined; this definition replaces it", name),
+			Pos:      pos,
+			Severity: SeverityWarning,
+		})
+	}
+}
+
+// openInclude resolves an include path through the configured resolver and
+// reads the included source, giving up when resolving and reading together
+// take longer than Options.IncludeTimeout. It returns a lexer over the
+// source and the name the resolver gave it. A source that fails partway
+// through reading is an error, not an empty file.
+func (p *Parser) openInclude(includePath string) (*Lexer, string, error) {
+	ctx := context.Background()
+
+	if p.opts.IncludeTimeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, p.opts.IncludeTimeout)
+		defer cancel()
+	}
+
+	resolver := p.opts.IncludeResolver
+	if resolver == nil {
+		resolver = FileResolver{}
+	}
+
+	reader, name, err := resolver.Resolve(ctx, p.baseDir, includePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve include '%s' at line %d: %w", includePath, p.current.Line, err)
+	}
+
+	defer reader.Close()
+
+	data, err := readContext(ctx, reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read include '%s' at line %d: %w", includePath, p.current.Line, err)
+	}
+
+	return newStringLexer(string(data), p.inherited), name, nil
+}
+
+// readContext reads reader to the end, giving up when ctx is done. A read
+// still blocked then is left to the caller's Close of the reader.
+func readContext(ctx context.Context, reader io.Reader) ([]byte, error) {
+	if ctx.Done() == nil {
+		return io.ReadAll(reader)
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	done := make(chan result, 1)
+
+	go func() {
+		data, err := io.ReadAll(reader)
+		done <- result{data: data, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// parseSetting parses a name = value or name : value setting. The name is
+// an identifier or a quoted string, which may contain any character,
+// including dots.
+func (p *Parser) parseSetting(group *Value) (string, error) {
+	if err := p.unterminatedString(); err != nil {
+		return "", err
+	}
+
+	if p.current.Type != TokenIdentifier && p.current.Type != TokenString {
+		return "", fmt.Errorf("expected identifier at line %d, column %d: %w",
 			p.current.Line, p.current.Column, ErrExpectedIdentifier)
 	}
 
 	name := p.current.Value
+	pos := p.position()
+	comments := p.current.Comments
 	p.advance()
 
-	if p.current.Type != TokenAssign {
-		return "", Value{}, fmt.Errorf("expected assignment operator at line %d, column %d: %w",
+	declared, annotated, err := p.parseAnnotation()
+	if err != nil {
+		return "", err
+	}
+
+	if p.current.Type != TokenAssign && p.current.Type != TokenAppendAssign {
+		return "", fmt.Errorf("expected assignment operator at line %d, column %d: %w",
 			p.current.Line, p.current.Column, ErrExpectedAssignment)
 	}
 
+	appending := p.current.Type == TokenAppendAssign
 	p.advance()
 
 	value, err := p.parseValue()
 	if err != nil {
-		return "", Value{}, err
+		return "", err
+	}
+
+	if err := p.checkDecimalComma(&value); err != nil {
+		return "", err
+	}
+
+	if annotated && value.Type != declared && value.Type != TypeNull {
+		return "", fmt.Errorf("setting '%s' at line %d, column %d is declared %s but is %s: %w",
+			name, pos.Line, pos.Column, declared, article(value.Type), ErrTypeAnnotation)
+	}
+
+	if appending {
+		return name, p.appendElement(group, name, value, pos)
 	}
 
-	return name, value, nil
+	value.Pos = pos
+	value.Comments = comments
+	value.LineComment = p.prevComment
+
+	if p.current.Type == TokenSemicolon && p.current.LineComment != "" {
+		value.LineComment = p.current.LineComment
+	}
+
+	p.checkDuplicate(group, name, value.Pos)
+	group.setMember(name, value)
+
+	return name, nil
 }
 
-// parseValue parses a value (scalar, array, group, or list).
+// parseAnnotation parses the `: type` that may follow a setting name with
+// Options.TypeAnnotations, as in port: int = 8080;, and reports the declared
+// type. A colon followed by anything other than a name is an ordinary
+// assignment and is left in place.
+func (p *Parser) parseAnnotation() (ValueType, bool, error) {
+	if !p.opts.TypeAnnotations || p.current.Type != TokenAssign || p.current.Value != ":" ||
+		p.lexer.PeekToken().Type != TokenIdentifier {
+		return 0, false, nil
+	}
+
+	p.advance() // consume ':'
+
+	// The annotation names are listed rather than derived from ValueType,
+	// so that null is not a type and new value types are opt-in.
+	for _, t := range [...]ValueType{
+		TypeInt, TypeInt64, TypeFloat, TypeBool, TypeString, TypeArray, TypeList, TypeGroup,
+	} {
+		if t.String() == p.current.Value {
+			p.advance()
+			return t, true, nil
+		}
+	}
+
+	return 0, false, fmt.Errorf("unknown type '%s' at line %d, column %d: %w",
+		p.current.Value, p.current.Line, p.current.Column, ErrTypeAnnotation)
+}
+
+// checkDecimalComma reports a number value directly followed by a comma and
+// digits, such as 3,14 pasted from locale-formatted data, which would
+// otherwise parse as 3 followed by a confusing error about the comma.
+// Inside arrays and lists such commas separate elements, so only setting
+// values are checked.
+func (p *Parser) checkDecimalComma(value *Value) error {
+	if value.Type != TypeInt && value.Type != TypeInt64 && value.Type != TypeFloat {
+		return nil
+	}
+
+	if p.current.Type != TokenComma || p.current.Start != p.prevEnd {
+		return nil
+	}
+
+	next := p.lexer.PeekToken()
+	if (next.Type != TokenInteger && next.Type != TokenFloat) || next.Start != p.current.End {
+		return nil
+	}
+
+	return fmt.Errorf("number at line %d, column %d is followed by ',%s' (did you use a comma decimal separator?): %w",
+		value.Pos.Line, value.Pos.Column, next.Value, ErrDecimalComma)
+}
+
+// appendElement appends element to the array or list that is the member
+// name of group, for `name += element;`.
+func (p *Parser) appendElement(group *Value, name string, element Value, pos Position) error {
+	target, ok := group.GroupVal[name]
+
+	switch {
+	case !ok:
+		return fmt.Errorf("'%s' at line %d, column %d is not set: %w", name, pos.Line, pos.Column, ErrAppendTarget)
+	case target.Type == TypeList:
+		target.ListVal = append(target.ListVal, element)
+	case target.Type == TypeArray:
+		elementType := TypeNull
+		for _, existing := range target.ArrayVal {
+			elementType, _ = arrayElementType(elementType, &existing)
+		}
+
+		if _, err := arrayElementType(elementType, &element); err != nil {
+			return err
+		}
+
+		target.ArrayVal = append(target.ArrayVal, element)
+	default:
+		return fmt.Errorf("'%s' at line %d, column %d is %s: %w", name, pos.Line, pos.Column, article(target.Type), ErrAppendTarget)
+	}
+
+	group.GroupVal[name] = target
+
+	return nil
+}
+
+// unterminatedString returns ErrUnterminatedString with the position of
+// the opening quote if the current token is a string the lexer found
+// unclosed at the end of its line, and nil otherwise.
+func (p *Parser) unterminatedString() error {
+	if p.current.Type != TokenError || !strings.HasPrefix(p.current.Value, `"`) {
+		return nil
+	}
+
+	return fmt.Errorf("string opened at line %d, column %d is not closed before the end of the line: %w",
+		p.current.Line, p.current.Column, ErrUnterminatedString)
+}
+
+// position returns the source position of the current token.
+func (p *Parser) position() Position {
+	return Position{File: p.filename, Line: p.current.Line, Column: p.current.Column}
+}
+
+// parseValue parses a value (scalar, array, group, or list), recording the
+// position of its first token.
 func (p *Parser) parseValue() (Value, error) {
+	if p.opts.MaxSettings > 0 && p.settings >= p.opts.MaxSettings {
+		return Value{}, fmt.Errorf("more than %d settings at line %d, column %d: %w",
+			p.opts.MaxSettings, p.current.Line, p.current.Column, ErrTooManySettings)
+	}
+
+	p.settings++
+	pos := p.position()
+	start := p.current.Start
+
+	value, err := p.parseValueAt()
+	if err != nil {
+		return Value{}, err
+	}
+
+	value.Pos = pos
+
+	if p.opts.TrackSpans {
+		value.Span = Span{Start: start, End: p.prevEnd}
+	}
+
+	return value, nil
+}
+
+// parseValueAt parses the value starting at the current token.
+func (p *Parser) parseValueAt() (Value, error) {
 	switch p.current.Type {
 	case TokenString:
 		value := p.current.Value
@@ -216,9 +761,11 @@ func (p *Parser) parseValue() (Value, error) {
 			return Value{}, fmt.Errorf("invalid float at line %d: %w", p.current.Line, err)
 		}
 
+		value := NewFloatValue(val)
+		value.FloatText = p.current.Value
 		p.advance()
 
-		return NewFloatValue(val), nil
+		return value, nil
 
 	case TokenBoolean:
 		val := p.current.Value == "true"
@@ -226,158 +773,369 @@ func (p *Parser) parseValue() (Value, error) {
 
 		return NewBoolValue(val), nil
 
+	case TokenNull:
+		p.advance()
+
+		return NewNullValue(), nil
+
 	case TokenLeftBrace:
 		return p.parseGroup()
 
+	case TokenAnchor:
+		return p.parseAnchor()
+
 	case TokenLeftBracket:
 		return p.parseArray()
 
 	case TokenLeftParen:
 		return p.parseList()
 
+	case TokenError:
+		if p.current.Value == "-" {
+			return Value{}, fmt.Errorf("'-' at line %d, column %d: %w", p.current.Line, p.current.Column, ErrDetachedSign)
+		}
+
+		if err := p.unterminatedString(); err != nil {
+			return Value{}, err
+		}
+
+		return Value{}, fmt.Errorf("unexpected token %s at line %d, column %d: %w",
+			p.current.Type, p.current.Line, p.current.Column, ErrUnexpectedToken)
+
 	default:
 		return Value{}, fmt.Errorf("unexpected token %s at line %d, column %d: %w",
 			p.current.Type, p.current.Line, p.current.Column, ErrUnexpectedToken)
 	}
 }
 
+// enter records entering a group, array or list, enforcing Options.MaxDepth.
+// Each successful call must be paired with leave.
+func (p *Parser) enter() error {
+	if p.opts.MaxDepth > 0 && p.depth >= p.opts.MaxDepth {
+		return fmt.Errorf("nesting deeper than %d at line %d, column %d: %w",
+			p.opts.MaxDepth, p.current.Line, p.current.Column, ErrMaxDepthExceeded)
+	}
+
+	p.depth++
+
+	return nil
+}
+
+// leave records leaving a group, array or list.
+func (p *Parser) leave() {
+	p.depth--
+}
+
+// unclosed returns err for a failure inside the collection of the given
+// kind opened at open. When err only reports a missing token because the
+// input ended, it returns an error naming the missing delimiter and where the
+// collection was opened, wrapping both ErrExpectedToken and
+// ErrUnexpectedEOF. Other errors, such as a failed include at the end of the
+// input, are returned unchanged. Only the innermost unclosed collection is
+// reported.
+func (p *Parser) unclosed(err error, kind string, open Position) error {
+	if p.current.Type != TokenEOF || errors.Is(err, ErrUnexpectedEOF) ||
+		(!errors.Is(err, ErrExpectedToken) && !errors.Is(err, ErrUnexpectedToken)) {
+		return err
+	}
+
+	closer := ")"
+
+	switch kind {
+	case "group":
+		closer = "}"
+	case "array":
+		closer = "]"
+	}
+
+	return fmt.Errorf("expected '%s' to close the %s opened at line %d, column %d: %w: %w",
+		closer, kind, open.Line, open.Column, ErrExpectedToken, ErrUnexpectedEOF)
+}
+
 // parseGroup parses a group { ... }.
 func (p *Parser) parseGroup() (Value, error) {
+	if err := p.enter(); err != nil {
+		return Value{}, err
+	}
+
+	defer p.leave()
+
+	open := p.position()
+
 	if err := p.expect(TokenLeftBrace); err != nil {
 		return Value{}, err
 	}
 
-	group := make(map[string]Value)
+	group := NewGroupValue(make(map[string]Value))
+
+	var bases []Value
 
 	for p.current.Type != TokenRightBrace && p.current.Type != TokenEOF {
-		if p.current.Type == TokenInclude {
-			// Handle @include within groups
-			groupValue := Value{Type: TypeGroup, GroupVal: group}
-			if err := p.parseInclude(&groupValue); err != nil {
-				return Value{}, err
+		// Stray semicolons are empty statements
+		if p.current.Type == TokenSemicolon {
+			p.advance()
+			continue
+		}
+
+		if p.atAlias() {
+			base, err := p.parseAlias()
+			if err != nil {
+				if err := p.recoverFrom(p.unclosed(err, "group", open), true); err != nil {
+					return Value{}, err
+				}
+
+				continue
 			}
 
-			group = groupValue.GroupVal
+			bases = append(bases, base)
+
+			continue
+		}
+
+		if p.atInclude() {
+			// Handle @include within groups
+			if err := p.parseInclude(&group); err != nil {
+				if err := p.recoverFrom(p.unclosed(err, "group", open), true); err != nil {
+					return Value{}, err
+				}
+			}
 
 			continue
 		}
 
-		name, value, err := p.parseSetting()
+		name, err := p.parseSetting(&group)
 		if err != nil {
-			return Value{}, err
+			if err := p.recoverFrom(p.unclosed(err, "group", open), true); err != nil {
+				return Value{}, err
+			}
+
+			continue
 		}
 
-		group[name] = value
+		if err := p.endSetting(name); err != nil {
+			if err := p.recoverFrom(p.unclosed(err, "group", open), true); err != nil {
+				return Value{}, err
+			}
+		}
+	}
 
-		// Optional semicolon
-		if p.current.Type == TokenSemicolon {
-			p.advance()
+	if bases != nil {
+		merged := NewGroupValue(make(map[string]Value))
+		for _, base := range bases {
+			mergeValues(&merged, base)
 		}
+
+		mergeValues(&merged, group)
+		group = merged
 	}
 
+	group.TrailingComments = p.current.Comments
+
 	if err := p.expect(TokenRightBrace); err != nil {
+		return Value{}, p.unclosed(err, "group", open)
+	}
+
+	return group, nil
+}
+
+// parseAnchor parses a group marked as an anchor, &name { ... }, and
+// records it under name for later *name; statements.
+func (p *Parser) parseAnchor() (Value, error) {
+	name := p.current.Value
+	pos := p.position()
+	p.advance()
+
+	if p.current.Type != TokenLeftBrace {
+		return Value{}, fmt.Errorf("anchor '&%s' at line %d, column %d is followed by %s: %w",
+			name, pos.Line, pos.Column, p.current.Type, ErrInvalidAnchor)
+	}
+
+	if p.anchors == nil {
+		p.anchors = make(map[string]Value)
+		p.openAnchors = make(map[string]bool)
+	}
+
+	p.openAnchors[name] = true
+	group, err := p.parseGroup()
+	delete(p.openAnchors, name)
+
+	if err != nil {
 		return Value{}, err
 	}
 
-	return NewGroupValue(group), nil
+	p.anchors[name] = cloneValue(group)
+
+	return group, nil
+}
+
+// atAlias reports whether the current token is a *name reference to an
+// anchor, which Options.Anchors accepts as a statement inside a group.
+func (p *Parser) atAlias() bool {
+	return p.opts.Anchors && p.current.Type == TokenIdentifier &&
+		len(p.current.Value) > 1 && p.current.Value[0] == '*'
+}
+
+// parseAlias parses a *name; statement and returns a copy of the anchored
+// group.
+func (p *Parser) parseAlias() (Value, error) {
+	ref := p.current.Value
+	name := ref[1:]
+	pos := p.position()
+
+	if p.openAnchors[name] {
+		return Value{}, fmt.Errorf("'%s' at line %d, column %d is inside the group anchored as '&%s': %w",
+			ref, pos.Line, pos.Column, name, ErrAnchorCycle)
+	}
+
+	base, ok := p.anchors[name]
+	if !ok {
+		return Value{}, fmt.Errorf("'%s' at line %d, column %d: %w", ref, pos.Line, pos.Column, ErrUnknownAnchor)
+	}
+
+	p.advance()
+
+	if err := p.endSetting(ref); err != nil {
+		return Value{}, err
+	}
+
+	return cloneValue(base), nil
 }
 
 // parseArray parses an array [ ... ].
 func (p *Parser) parseArray() (Value, error) {
-	if err := p.expect(TokenLeftBracket); err != nil {
+	if err := p.enter(); err != nil {
 		return Value{}, err
 	}
 
-	var elements []Value
+	defer p.leave()
 
-	// Empty array
-	if p.current.Type == TokenRightBracket {
-		p.advance()
-		return NewArrayValue(elements), nil
-	}
+	open := p.position()
 
-	// Parse first element
-	firstElement, err := p.parseValue()
-	if err != nil {
+	if err := p.expect(TokenLeftBracket); err != nil {
 		return Value{}, err
 	}
 
-	elements = append(elements, firstElement)
+	var (
+		elements []Value
+		err      error
+	)
 
-	// Parse remaining elements
-	for p.current.Type == TokenComma {
-		p.advance() // consume comma
+	// The first non-null element fixes the element type; nulls fit any type
+	elementType := TypeNull
 
-		// Allow trailing comma
-		if p.current.Type == TokenRightBracket {
-			break
+	for p.current.Type != TokenRightBracket {
+		parsed := len(elements)
+		if elements, err = p.parseElement(elements); err != nil {
+			return Value{}, p.unclosed(err, "array", open)
 		}
 
-		element, err := p.parseValue()
-		if err != nil {
-			return Value{}, err
+		// Ensure all elements have the same type (arrays are homogeneous),
+		// including those spliced in from an included file
+		for _, element := range elements[parsed:] {
+			if elementType, err = arrayElementType(elementType, &element); err != nil {
+				return Value{}, err
+			}
 		}
 
-		// Ensure all elements have the same type (arrays are homogeneous)
-		if element.Type != firstElement.Type {
-			return Value{}, fmt.Errorf("array elements must have the same type, got %s and %s at line %d: %w",
-				firstElement.Type, element.Type, p.current.Line, ErrArrayTypeMismatch)
+		// A missing comma ends the array; a trailing comma is allowed
+		if p.current.Type != TokenComma {
+			break
 		}
 
-		elements = append(elements, element)
+		p.advance()
 	}
 
 	if err := p.expect(TokenRightBracket); err != nil {
-		return Value{}, err
+		return Value{}, p.unclosed(err, "array", open)
 	}
 
 	return NewArrayValue(elements), nil
 }
 
+// arrayElementType returns the element type of an array of elementType,
+// TypeNull while only nulls have been seen, once element is added to it. An
+// element of another type returns ErrArrayTypeMismatch.
+func arrayElementType(elementType ValueType, element *Value) (ValueType, error) {
+	switch {
+	case element.Type == TypeNull:
+		return elementType, nil
+	case elementType == TypeNull:
+		return element.Type, nil
+	case element.Type != elementType:
+		return elementType, fmt.Errorf("array elements must have the same type, got %s and %s at %s: %w",
+			elementType, element.Type, element.Pos, ErrArrayTypeMismatch)
+	default:
+		return elementType, nil
+	}
+}
+
 // parseList parses a list ( ... ).
 func (p *Parser) parseList() (Value, error) {
-	if err := p.expect(TokenLeftParen); err != nil {
+	if err := p.enter(); err != nil {
 		return Value{}, err
 	}
 
-	var elements []Value
+	defer p.leave()
 
-	// Empty list
-	if p.current.Type == TokenRightParen {
-		p.advance()
-		return NewListValue(elements), nil
-	}
+	open := p.position()
 
-	// Parse first element
-	element, err := p.parseValue()
-	if err != nil {
+	if err := p.expect(TokenLeftParen); err != nil {
 		return Value{}, err
 	}
 
-	elements = append(elements, element)
+	var (
+		elements []Value
+		err      error
+	)
 
-	// Parse remaining elements
-	for p.current.Type == TokenComma {
-		p.advance() // consume comma
+	for p.current.Type != TokenRightParen {
+		if elements, err = p.parseElement(elements); err != nil {
+			return Value{}, p.unclosed(err, "list", open)
+		}
 
-		// Allow trailing comma
-		if p.current.Type == TokenRightParen {
+		// A missing comma ends the list; a trailing comma is allowed
+		if p.current.Type != TokenComma {
 			break
 		}
 
+		p.advance()
+	}
+
+	if err := p.expect(TokenRightParen); err != nil {
+		return Value{}, p.unclosed(err, "list", open)
+	}
+
+	return NewListValue(elements), nil
+}
+
+// parseElement parses the next element of an array or list and appends it
+// to elements. An include directive appends the elements of the included
+// file instead.
+func (p *Parser) parseElement(elements []Value) ([]Value, error) {
+	if !p.atInclude() {
 		element, err := p.parseValue()
 		if err != nil {
-			return Value{}, err
+			return nil, err
 		}
 
-		elements = append(elements, element)
+		return append(elements, element), nil
 	}
 
-	if err := p.expect(TokenRightParen); err != nil {
-		return Value{}, err
+	included, ok, err := p.includeDirective(true)
+	if err != nil || !ok {
+		return elements, err
 	}
 
-	return NewListValue(elements), nil
+	spliced, err := included.parseElementFile()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing included file '%s': %w", included.filename, err)
+	}
+
+	p.settings = included.settings
+	p.diagnostics = append(p.diagnostics, included.diagnostics...)
+	p.records = append(p.records, included.records...)
+
+	return append(elements, spliced...), nil
 }
 
 // Helper functions
@@ -392,7 +1150,7 @@ func fileExists(path string) bool {
 }
 
 // parseFileWithDepth parses a file with include depth tracking.
-func parseFileWithDepth(filename string, depth int) (*Config, error) {
+func parseFileWithDepth(filename string, depth int, opts Options) (*Config, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
@@ -402,9 +1160,10 @@ func parseFileWithDepth(filename string, depth int) (*Config, error) {
 		file.Close() // Ignore close errors after successful read
 	}()
 
-	lexer := NewLexer(file)
-	baseDir := filepath.Dir(filename)
-	parser := NewParserWithBaseDir(lexer, baseDir)
+	lexer := NewLexerWithOptions(file, opts)
+	parser := NewParserWithOptions(lexer, opts)
+	parser.baseDir = filepath.Dir(filename)
+	parser.filename = filename
 	parser.includeDepth = depth
 
 	return parser.Parse()
@@ -416,11 +1175,7 @@ func mergeConfig(target, source *Value) {
 		return
 	}
 
-	if target.GroupVal == nil {
-		target.GroupVal = make(map[string]Value)
-	}
-
-	for key, value := range source.GroupVal {
-		target.GroupVal[key] = value
+	for _, key := range source.MemberKeys() {
+		target.setMember(key, source.GroupVal[key])
 	}
 }
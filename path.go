@@ -0,0 +1,91 @@
+package libconfig
+
+import "strings"
+
+// EscapeKey escapes a setting name for use as one component of a lookup
+// path. Dots and backslashes in the name are prefixed with a backslash, so a
+// setting declared as "a.b" = 1; is looked up with EscapeKey("a.b"), which is
+// `a\.b`. Names without dots or backslashes are returned unchanged.
+func EscapeKey(key string) string {
+	if !strings.ContainsAny(key, `.\`) {
+		return key
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(key); i++ {
+		if key[i] == '.' || key[i] == '\\' {
+			sb.WriteByte('\\')
+		}
+
+		sb.WriteByte(key[i])
+	}
+
+	return sb.String()
+}
+
+// splitPath splits a lookup path on unescaped dots and unescapes each
+// component. A backslash makes the following byte literal; a trailing
+// backslash is kept as is.
+func splitPath(path string) []string {
+	if !strings.Contains(path, `\`) {
+		return strings.Split(path, ".")
+	}
+
+	var (
+		parts []string
+		part  strings.Builder
+	)
+
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path):
+			i++
+			part.WriteByte(path[i])
+		case path[i] == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(path[i])
+		}
+	}
+
+	return append(parts, part.String())
+}
+
+// joinPath appends key to a dot-separated path, escaping it as needed.
+func joinPath(path, key string) string {
+	if path == "" {
+		return EscapeKey(key)
+	}
+
+	return path + "." + EscapeKey(key)
+}
+
+// Path is a lookup path split into its components once, for repeated
+// lookups with Config.LookupCompiled. The zero Path names the root group.
+type Path struct {
+	text  string
+	parts []string
+}
+
+// Compile splits a dot-separated lookup path, with the same escaping rules
+// as Config.Lookup, into a Path that can be reused across lookups and
+// configs.
+func Compile(path string) Path {
+	parts := splitPath(path)
+	kept := parts[:0]
+
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+
+	return Path{text: path, parts: kept}
+}
+
+// String returns the path as it was passed to Compile.
+func (p Path) String() string {
+	return p.text
+}
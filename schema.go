@@ -0,0 +1,193 @@
+package libconfig
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Predefined schema errors for better error handling and testing.
+var (
+	ErrMissingRequired = errors.New("missing required setting")
+	ErrSchemaType      = errors.New("setting has the wrong type")
+	ErrOutOfRange      = errors.New("setting is out of range")
+	ErrUnexpectedKey   = errors.New("setting is not in the schema")
+)
+
+// Schema describes the settings a configuration is expected to hold, keyed
+// by lookup path. Settings not named in the schema are not checked.
+type Schema map[string]SchemaField
+
+// SchemaField constrains a single setting.
+type SchemaField struct {
+	// Required reports a missing setting with ErrMissingRequired. Missing
+	// optional settings are not checked further.
+	Required bool
+
+	// Types lists the accepted value types; empty accepts any type.
+	Types []ValueType
+
+	// Min and Max bound integer and float settings when set. Other types
+	// are not range checked.
+	Min *float64
+	Max *float64
+}
+
+// Validate checks the configuration against schema and returns every
+// violation joined into one error, in path order, or nil if the
+// configuration conforms. Violations wrap ErrMissingRequired, ErrSchemaType
+// or ErrOutOfRange and name the setting's path and line.
+func (c *Config) Validate(schema Schema) error {
+	paths := make([]string, 0, len(schema))
+	for path := range schema {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	var violations []error
+
+	for _, path := range paths {
+		if err := c.validateField(path, schema[path]); err != nil {
+			violations = append(violations, err)
+		}
+	}
+
+	return errors.Join(violations...)
+}
+
+// ValidateStrict checks the configuration against schema like Validate and
+// also reports settings the schema does not mention, which are likely typos
+// or deprecated names, wrapping ErrUnexpectedKey with their line. A setting
+// named in the schema covers everything below it, and groups on the way to
+// a schema path are expected. All violations are joined in path order.
+func (c *Config) ValidateStrict(schema Schema) error {
+	expected := make(map[string]bool)
+
+	for path := range schema {
+		parts := Compile(path).parts
+		prefix := ""
+
+		for _, part := range parts[:max(len(parts)-1, 0)] {
+			prefix = joinPath(prefix, part)
+			expected[prefix] = true
+		}
+	}
+
+	unexpected := make(map[string]Position)
+	collectUnexpected(&c.Root, "", schema, expected, unexpected)
+
+	paths := make([]string, 0, len(schema)+len(unexpected))
+	for path := range schema {
+		paths = append(paths, path)
+	}
+
+	for path := range unexpected {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	var violations []error
+
+	for _, path := range paths {
+		field, ok := schema[path]
+		if !ok {
+			violations = append(violations, fmt.Errorf("setting '%s' at line %d: %w", path, unexpected[path].Line, ErrUnexpectedKey))
+			continue
+		}
+
+		if err := c.validateField(path, field); err != nil {
+			violations = append(violations, err)
+		}
+	}
+
+	return errors.Join(violations...)
+}
+
+// collectUnexpected records the position of each member of group, below
+// prefix, that is neither in schema nor a group on the way to a schema
+// path in expected.
+func collectUnexpected(group *Value, prefix string, schema Schema, expected map[string]bool, unexpected map[string]Position) {
+	for key, member := range group.GroupVal {
+		path := joinPath(prefix, key)
+
+		switch {
+		case hasField(schema, path):
+		case expected[path] && member.Type == TypeGroup:
+			collectUnexpected(&member, path, schema, expected, unexpected)
+		default:
+			unexpected[path] = member.Pos
+		}
+	}
+}
+
+// hasField reports whether schema has a field for path.
+func hasField(schema Schema, path string) bool {
+	_, ok := schema[path]
+	return ok
+}
+
+// validateField checks the setting at path against field.
+func (c *Config) validateField(path string, field SchemaField) error {
+	val, err := c.Lookup(path)
+	if err != nil {
+		if field.Required {
+			return fmt.Errorf("setting '%s': %w", path, ErrMissingRequired)
+		}
+
+		return nil
+	}
+
+	if len(field.Types) > 0 && !slices.Contains(field.Types, val.Type) {
+		return fmt.Errorf("setting '%s' at line %d is a %s, want %v: %w", path, val.Pos.Line, val.Type, field.Types, ErrSchemaType)
+	}
+
+	var n float64
+
+	switch val.Type {
+	case TypeInt:
+		n = float64(val.IntVal)
+	case TypeInt64:
+		n = float64(val.Int64Val)
+	case TypeFloat:
+		n = val.FloatVal
+	default:
+		return nil
+	}
+
+	if (field.Min != nil && n < *field.Min) || (field.Max != nil && n > *field.Max) {
+		return fmt.Errorf("setting '%s' at line %d is %v, outside %s: %w", path, val.Pos.Line, n, field.bounds(), ErrOutOfRange)
+	}
+
+	return nil
+}
+
+// bounds describes the range allowed by the field, such as [1, 65535].
+func (f SchemaField) bounds() string {
+	low, high := "-inf", "+inf"
+
+	if f.Min != nil {
+		low = fmt.Sprint(*f.Min)
+	}
+
+	if f.Max != nil {
+		high = fmt.Sprint(*f.Max)
+	}
+
+	return "[" + low + ", " + high + "]"
+}
+
+// Decode validates the configuration against schema and then unmarshals it
+// into the struct pointed to by v, so that an application can load and check
+// its configuration in one call. All schema violations are returned joined
+// together, and v is left untouched if there are any; otherwise the result
+// is that of Unmarshal.
+func (c *Config) Decode(v any, schema Schema) error {
+	if err := c.Validate(schema); err != nil {
+		return err
+	}
+
+	return c.Unmarshal(v)
+}
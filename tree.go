@@ -0,0 +1,85 @@
+package libconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Tree writes the structure of the configuration to w as a tree drawn with
+// box-drawing characters, one setting per line with its name and type and,
+// for scalars, its value:
+//
+//	├─ app (group)
+//	│  ├─ name (string) = "demo"
+//	│  └─ ports (array)
+//	│     ├─ [0] (int) = 80
+//	│     └─ [1] (int) = 443
+//	└─ debug (bool) = false
+//
+// Settings are listed in declaration order and array and list elements by
+// index. The output is meant for people, not for parsing back.
+func (c *Config) Tree(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+
+	writeTreeMembers(buf, &c.Root, "")
+
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write tree: %w", err)
+	}
+
+	return nil
+}
+
+// writeTreeMembers writes the members or elements of v as branches below
+// prefix, the connectors of their ancestors.
+func writeTreeMembers(buf *bufio.Writer, v *Value, prefix string) {
+	var (
+		labels  []string
+		members []Value
+	)
+
+	switch v.Type {
+	case TypeGroup:
+		for _, key := range v.MemberKeys() {
+			labels = append(labels, key)
+			members = append(members, v.GroupVal[key])
+		}
+	case TypeArray, TypeList:
+		for i, element := range v.Iter() {
+			labels = append(labels, "["+strconv.Itoa(i)+"]")
+			members = append(members, element)
+		}
+	default:
+		return
+	}
+
+	for i := range members {
+		connector, indent := "├─ ", "│  "
+		if i == len(members)-1 {
+			connector, indent = "└─ ", "   "
+		}
+
+		buf.WriteString(prefix + connector + labels[i] + " (" + members[i].Type.String() + ")")
+
+		if !members[i].isCollection() {
+			buf.WriteString(" = " + treeLiteral(&members[i]))
+		}
+
+		buf.WriteByte('\n')
+
+		writeTreeMembers(buf, &members[i], prefix+indent)
+	}
+}
+
+// treeLiteral returns the literal text of a scalar, writing floats that
+// libconfig cannot represent as Go formats them.
+func treeLiteral(v *Value) string {
+	literal, err := v.Literal()
+	if err != nil {
+		return strconv.FormatFloat(v.FloatVal, 'g', -1, 64)
+	}
+
+	return literal
+}
@@ -0,0 +1,234 @@
+package libconfig
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Predefined unit parsing errors for better error handling and testing.
+var (
+	ErrInvalidDuration = errors.New("invalid duration")
+	ErrInvalidSize     = errors.New("invalid size")
+	ErrInvalidQuantity = errors.New("invalid quantity")
+	ErrUnknownUnit     = errors.New("unknown unit")
+)
+
+// sizeUnits maps lower-cased size suffixes to their multipliers. Suffixes
+// with a B are decimal (kB) or binary (KiB) as written; bare letters are
+// binary, as in many server configs.
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1e3,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1e6,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1e9,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1e12,
+	"tib": 1 << 40,
+}
+
+// LookupDuration looks up a string such as "1m30s" by path and parses it
+// with time.ParseDuration. Other types return ErrNotString and text that is
+// not a duration returns ErrInvalidDuration.
+func (c *Config) LookupDuration(path string) (time.Duration, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := val.duration()
+	if err != nil {
+		return 0, fmt.Errorf("value at '%s': %w", path, err)
+	}
+
+	return d, nil
+}
+
+// LookupBytes looks up a byte size by path. Integers are a count of bytes;
+// strings hold a number and an optional unit, such as "512", "64KB" (64000),
+// "64KiB" or "64K" (65536), "1.5GB" or "2TiB". Units are case-insensitive.
+// Other types return ErrNotString and malformed or negative sizes return
+// ErrInvalidSize.
+func (c *Config) LookupBytes(path string) (int64, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := val.size()
+	if err != nil {
+		return 0, fmt.Errorf("value at '%s': %w", path, err)
+	}
+
+	return n, nil
+}
+
+// LookupQuantity looks up a quantity such as "500m" or "256Mi" by path and
+// returns it in the base unit of units, which maps each unit suffix to its
+// factor, as in {"m": 0.001, "": 1, "Mi": 1 << 20} for Kubernetes-style
+// quantities. Suffixes are case-sensitive. A quantity without a suffix uses
+// the factor of "" if units has one and is taken as is otherwise, as are
+// integer and float settings. An unknown suffix returns ErrUnknownUnit
+// naming the known units, other malformed strings return
+// ErrInvalidQuantity, and other types return ErrNotString.
+func (c *Config) LookupQuantity(path string, units map[string]float64) (float64, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return 0, err
+	}
+
+	switch val.Type {
+	case TypeInt, TypeInt64:
+		n, _ := val.int64()
+		return float64(n), nil
+	case TypeFloat:
+		return val.FloatVal, nil
+	case TypeString:
+	default:
+		return 0, wrongType(path, val.Type, "a quantity string", ErrNotString)
+	}
+
+	text := strings.TrimSpace(val.StrVal)
+	split := strings.IndexFunc(text, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+
+	if split < 0 {
+		split = len(text)
+	}
+
+	number, unit := text[:split], strings.TrimSpace(text[split:])
+
+	factor, ok := units[unit]
+	if !ok && unit != "" {
+		known := make([]string, 0, len(units))
+		for name := range units {
+			known = append(known, strconv.Quote(name))
+		}
+
+		sort.Strings(known)
+
+		return 0, fmt.Errorf("value at '%s' has unit %q, want one of %s: %w",
+			path, unit, strings.Join(known, ", "), ErrUnknownUnit)
+	}
+
+	if !ok {
+		factor = 1
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value at '%s' is %q: %w", path, val.StrVal, ErrInvalidQuantity)
+	}
+
+	return n * factor, nil
+}
+
+// LookupDurationSlice looks up an array or list of duration strings, such as
+// [ "1s", "1m", "1h" ], by path and parses each as LookupDuration does. The
+// first element that fails is reported with its index.
+func (c *Config) LookupDurationSlice(path string) ([]time.Duration, error) {
+	return lookupSlice(c, path, (*Value).duration)
+}
+
+// LookupBytesSlice looks up an array or list of byte sizes by path and
+// parses each as LookupBytes does. The first element that fails is reported
+// with its index.
+func (c *Config) LookupBytesSlice(path string) ([]int64, error) {
+	return lookupSlice(c, path, (*Value).size)
+}
+
+// lookupSlice looks up an array or list by path and converts each element
+// with convert.
+func lookupSlice[T any](c *Config, path string, convert func(*Value) (T, error)) ([]T, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if val.Type != TypeArray && val.Type != TypeList {
+		return nil, fmt.Errorf("value at '%s': %w", path, ErrNotSequence)
+	}
+
+	result := make([]T, 0, len(val.ArrayVal)+len(val.ListVal))
+
+	for i, element := range val.Iter() {
+		converted, err := convert(&element)
+		if err != nil {
+			return nil, fmt.Errorf("element %d of '%s': %w", i, path, err)
+		}
+
+		result = append(result, converted)
+	}
+
+	return result, nil
+}
+
+// duration parses a string value as a time.Duration.
+func (v *Value) duration() (time.Duration, error) {
+	if v.Type != TypeString {
+		return 0, fmt.Errorf("%s is not a duration string: %w", v.Type, ErrNotString)
+	}
+
+	d, err := time.ParseDuration(v.StrVal)
+	if err != nil {
+		return 0, fmt.Errorf("%q: %w", v.StrVal, ErrInvalidDuration)
+	}
+
+	return d, nil
+}
+
+// size returns an integer value as a byte count, or parses a string value
+// with a size unit.
+func (v *Value) size() (int64, error) {
+	if n, ok := v.int64(); ok {
+		if n < 0 {
+			return 0, fmt.Errorf("%d is negative: %w", n, ErrInvalidSize)
+		}
+
+		return n, nil
+	}
+
+	if v.Type != TypeString {
+		return 0, fmt.Errorf("%s is not a size: %w", v.Type, ErrNotString)
+	}
+
+	text := strings.TrimSpace(v.StrVal)
+	split := strings.IndexFunc(text, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	if split < 0 {
+		split = len(text)
+	}
+
+	number, unit := text[:split], strings.ToLower(strings.TrimSpace(text[split:]))
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("%q has unknown unit %q: %w", v.StrVal, text[split:], ErrInvalidSize)
+	}
+
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q: %w", v.StrVal, ErrInvalidSize)
+	}
+
+	f *= multiplier
+	if f != math.Trunc(f) || f >= math.MaxInt64 {
+		return 0, fmt.Errorf("%q is not a whole number of bytes in range: %w", v.StrVal, ErrInvalidSize)
+	}
+
+	return int64(f), nil
+}
@@ -0,0 +1,501 @@
+package libconfig
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Predefined decoding errors for better error handling and testing.
+var (
+	ErrInvalidUnmarshalTarget = errors.New("unmarshal target must be a non-nil pointer to a struct")
+	ErrUnsupportedType        = errors.New("unsupported field type")
+	ErrNotGroup               = errors.New("value is not a group")
+	ErrUnknownKey             = errors.New("unknown key")
+	ErrPrecisionLoss          = errors.New("value cannot be represented without losing precision")
+)
+
+// tagName is the struct tag consulted by Unmarshal.
+const tagName = "libconfig"
+
+// Unmarshaler is implemented by types that decode themselves from a
+// configuration value, like json.Unmarshaler. Unmarshal passes such a field
+// its setting's value, including a null, in place of the built-in decoding.
+type Unmarshaler interface {
+	UnmarshalLibconfig(v Value) error
+}
+
+// UnmarshalOptions controls how Unmarshal treats the configuration.
+type UnmarshalOptions struct {
+	// UnknownKey, when set, is called with the dot-separated path of every
+	// config key that has no matching struct field.
+	UnknownKey func(path string)
+
+	// DisallowUnknownKeys makes Unmarshal fail with ErrUnknownKey when the
+	// configuration contains keys that have no matching struct field, like
+	// json.Decoder.DisallowUnknownFields. All unknown keys are reported.
+	DisallowUnknownKeys bool
+}
+
+// Unmarshal decodes the configuration into the struct pointed to by v.
+//
+// Struct fields are matched to group members by the name given in a
+// `libconfig:"name"` tag, or otherwise by the field name, compared
+// case-insensitively. A tag may also hold a dotted path, such as
+// `libconfig:"server.ssl.port"`, to fill the field from a setting nested
+// below the struct's group without declaring a struct for each level; escape
+// dots in quoted setting names as in Lookup. Fields tagged `libconfig:"-"`
+// and unexported fields are skipped. Nested structs and maps with string
+// keys are decoded from groups, and slices, including slices of slices, from
+// arrays and lists. The fields of embedded structs without a name tag are
+// promoted and filled from the same group, as in encoding/json; a field of
+// the outer struct hides a promoted field of the same name.
+// Fields whose type, or a pointer to it, implements Unmarshaler decode
+// themselves.
+// A value whose type does not fit its field is reported with the path of the
+// setting and the type found, as in "value at 'port' is a string, not an
+// integer".
+func (c *Config) Unmarshal(v any) error {
+	return c.UnmarshalWithOptions(v, UnmarshalOptions{})
+}
+
+// UnmarshalWithOptions decodes the configuration into the struct pointed to
+// by v, handling unknown keys as directed by opts.
+func (c *Config) UnmarshalWithOptions(v any, opts UnmarshalOptions) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("got %T: %w", v, ErrInvalidUnmarshalTarget)
+	}
+
+	d := &decoder{opts: opts}
+	if err := d.decodeStruct("", &c.Root, rv.Elem()); err != nil {
+		return err
+	}
+
+	return errors.Join(d.unknown...)
+}
+
+// decoder holds the state of a single Unmarshal call.
+type decoder struct {
+	opts    UnmarshalOptions
+	unknown []error
+}
+
+// decodeStruct fills the fields of the struct rv from the members of group.
+func (d *decoder) decodeStruct(path string, group *Value, rv reflect.Value) error {
+	if group.Type != TypeGroup {
+		return wrongType(path, group.Type, "a group", ErrNotGroup)
+	}
+
+	matched := make(map[string]bool, len(group.GroupVal))
+
+	if err := d.decodeFields(path, group, rv, matched, nil); err != nil {
+		return err
+	}
+
+	d.reportUnknown(path, group, matched)
+
+	return nil
+}
+
+// decodeFields fills the fields of the struct rv from the members of group,
+// recording the members used in matched. The fields of embedded structs
+// without a name tag are promoted, as in encoding/json: they are filled from
+// the same group unless a shallower field in shadowed has the same name.
+func (d *decoder) decodeFields(path string, group *Value, rv reflect.Value, matched, shadowed map[string]bool) error {
+	rt := rv.Type()
+
+	// Fields at this level hide promoted fields of the same name
+	own := make(map[string]bool, len(shadowed)+rt.NumField())
+	for name := range shadowed {
+		own[name] = true
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		if field := rt.Field(i); !isPromoted(field) {
+			own[strings.ToLower(fieldName(field))] = true
+		}
+	}
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+
+		if isPromoted(field) {
+			embedded := rv.Field(i)
+			if embedded.Kind() == reflect.Pointer {
+				if embedded.IsNil() {
+					if !embedded.CanSet() {
+						continue
+					}
+
+					embedded.Set(reflect.New(field.Type.Elem()))
+				}
+
+				embedded = embedded.Elem()
+			}
+
+			if err := d.decodeFields(path, group, embedded, matched, own); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := fieldName(field)
+		if shadowed[strings.ToLower(name)] {
+			continue
+		}
+
+		parts := Compile(name).parts
+		if len(parts) == 0 {
+			continue
+		}
+
+		if len(parts) > 1 {
+			if err := d.decodePath(path, group, parts, rv.Field(i), matched); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		key, ok := findKey(group, parts[0])
+		if !ok {
+			continue
+		}
+
+		matched[key] = true
+		member := group.GroupVal[key]
+
+		if err := d.decodeValue(joinPath(path, key), &member, rv.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isPromoted reports whether the fields of an embedded struct field are
+// promoted to the enclosing struct: it is a struct or pointer to a struct
+// without a name in its tag. Embedded structs of unexported types are
+// promoted too, since their exported fields can still be set.
+func isPromoted(field reflect.StructField) bool {
+	if !field.Anonymous {
+		return false
+	}
+
+	if tag := field.Tag.Get(tagName); tag == "-" || (tag != "" && !strings.HasPrefix(tag, ",")) {
+		return false
+	}
+
+	t := field.Type
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct
+}
+
+// decodePath fills rv from the setting that a dotted field tag names
+// relative to group, such as `libconfig:"server.ssl.port"`. Each component is
+// matched like a field name. A missing setting leaves the field unchanged.
+func (d *decoder) decodePath(path string, group *Value, parts []string, rv reflect.Value, matched map[string]bool) error {
+	current := *group
+
+	for i, part := range parts {
+		if current.Type != TypeGroup {
+			return wrongType(path, current.Type, "a group", ErrNotGroup)
+		}
+
+		key, ok := findKey(&current, part)
+		if !ok {
+			return nil
+		}
+
+		// The subtree is claimed by the field, so it is not an unknown key
+		if i == 0 {
+			matched[key] = true
+		}
+
+		current = current.GroupVal[key]
+		path = joinPath(path, key)
+	}
+
+	return d.decodeValue(path, &current, rv)
+}
+
+// reportUnknown reports the keys of group that did not match a struct field.
+func (d *decoder) reportUnknown(path string, group *Value, matched map[string]bool) {
+	if d.opts.UnknownKey == nil && !d.opts.DisallowUnknownKeys {
+		return
+	}
+
+	keys := make([]string, 0, len(group.GroupVal))
+	for key := range group.GroupVal {
+		if !matched[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := joinPath(path, key)
+
+		if d.opts.UnknownKey != nil {
+			d.opts.UnknownKey(keyPath)
+		}
+
+		if d.opts.DisallowUnknownKeys {
+			member := group.GroupVal[key]
+			d.unknown = append(d.unknown, fmt.Errorf("key '%s' at line %d: %w", keyPath, member.Pos.Line, ErrUnknownKey))
+		}
+	}
+}
+
+// decodeValue stores val into rv, converting between libconfig and Go types.
+func (d *decoder) decodeValue(path string, val *Value, rv reflect.Value) error {
+	if u, ok := unmarshaler(rv); ok {
+		if err := u.UnmarshalLibconfig(*val); err != nil {
+			return fmt.Errorf("value at '%s': %w", path, err)
+		}
+
+		return nil
+	}
+
+	// A null leaves the field at its zero value
+	if val.Type == TypeNull {
+		rv.SetZero()
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		return d.decodeStruct(path, val, rv)
+	case reflect.String:
+		if val.Type != TypeString {
+			return wrongType(path, val.Type, "a string", ErrNotString)
+		}
+
+		rv.SetString(val.StrVal)
+	case reflect.Bool:
+		if val.Type != TypeBool {
+			return wrongType(path, val.Type, "a boolean", ErrNotBoolean)
+		}
+
+		rv.SetBool(val.BoolVal)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := val.int64()
+		if !ok {
+			return wrongType(path, val.Type, "an integer", ErrNotInteger)
+		}
+
+		if rv.OverflowInt(n) {
+			return fmt.Errorf("value %d at '%s' does not fit %s: %w", n, path, rv.Type(), ErrIntegerOutOfRange)
+		}
+
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := val.int64()
+		if !ok {
+			return wrongType(path, val.Type, "an integer", ErrNotInteger)
+		}
+
+		if n < 0 || rv.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value %d at '%s' does not fit %s: %w", n, path, rv.Type(), ErrIntegerOutOfRange)
+		}
+
+		rv.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		return decodeFloat(path, val, rv)
+	case reflect.Slice:
+		return d.decodeSlice(path, val, rv)
+	case reflect.Map:
+		return d.decodeMap(path, val, rv)
+	default:
+		return fmt.Errorf("field for '%s' has type %s: %w", path, rv.Type(), ErrUnsupportedType)
+	}
+
+	return nil
+}
+
+// unmarshaler returns the Unmarshaler that decodes into rv, if its type
+// implements the interface with a value or pointer receiver. A nil pointer
+// field is allocated first.
+func unmarshaler(rv reflect.Value) (Unmarshaler, bool) {
+	if rv.Kind() == reflect.Pointer && rv.Type().Implements(reflect.TypeFor[Unmarshaler]()) {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+
+		u, ok := rv.Interface().(Unmarshaler)
+
+		return u, ok
+	}
+
+	if !rv.CanAddr() {
+		return nil, false
+	}
+
+	u, ok := rv.Addr().Interface().(Unmarshaler)
+
+	return u, ok
+}
+
+// LookupIntMatrix looks up an array or list of integer arrays or lists, such
+// as grid = [ [ 1, 2, 3 ], [ 4, 5, 6 ] ];, by path. Rows may differ in
+// length. A row that is not a sequence or an element that is not an integer
+// is reported with its index, as in 'grid[1][2]'.
+func (c *Config) LookupIntMatrix(path string) ([][]int, error) {
+	val, err := c.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var grid [][]int
+
+	d := &decoder{}
+	if err := d.decodeValue(path, &val, reflect.ValueOf(&grid).Elem()); err != nil {
+		return nil, err
+	}
+
+	return grid, nil
+}
+
+// decodeSlice fills the slice rv from the elements of an array or list,
+// decoding each into the slice's element type. Nested arrays decode into
+// nested slices, with errors naming the element as in 'grid[1][2]'.
+func (d *decoder) decodeSlice(path string, val *Value, rv reflect.Value) error {
+	if val.Type != TypeArray && val.Type != TypeList {
+		return wrongType(path, val.Type, "an array or list", ErrNotSequence)
+	}
+
+	n := len(val.ArrayVal) + len(val.ListVal)
+	slice := reflect.MakeSlice(rv.Type(), n, n)
+
+	for i, element := range val.Iter() {
+		if err := d.decodeValue(fmt.Sprintf("%s[%d]", path, i), &element, slice.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	rv.Set(slice)
+
+	return nil
+}
+
+// decodeMap fills the map rv, which must have string keys, from the members
+// of a group, decoding each into the map's element type. Entries already in
+// the map are kept unless a member replaces them.
+func (d *decoder) decodeMap(path string, val *Value, rv reflect.Value) error {
+	if rv.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("field for '%s' has type %s: %w", path, rv.Type(), ErrUnsupportedType)
+	}
+
+	if val.Type != TypeGroup {
+		return wrongType(path, val.Type, "a group", ErrNotGroup)
+	}
+
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMapWithSize(rv.Type(), len(val.GroupVal)))
+	}
+
+	for _, key := range val.MemberKeys() {
+		member := val.GroupVal[key]
+		element := reflect.New(rv.Type().Elem()).Elem()
+
+		if err := d.decodeValue(joinPath(path, key), &member, element); err != nil {
+			return err
+		}
+
+		rv.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), element)
+	}
+
+	return nil
+}
+
+// decodeFloat stores a float or integer value into a float field. Integers
+// that the field cannot hold exactly, such as int64 values needing more than
+// 53 significant bits, and floats that overflow a float32 return
+// ErrPrecisionLoss rather than being rounded.
+func decodeFloat(path string, val *Value, rv reflect.Value) error {
+	switch val.Type {
+	case TypeFloat:
+		if rv.OverflowFloat(val.FloatVal) {
+			return fmt.Errorf("float %v at '%s' does not fit %s: %w", val.FloatVal, path, rv.Type(), ErrPrecisionLoss)
+		}
+
+		rv.SetFloat(val.FloatVal)
+	case TypeInt, TypeInt64:
+		n, _ := val.int64()
+
+		f, exact := exactFloat(n, rv.Type().Bits())
+		if !exact {
+			return fmt.Errorf("integer %d at '%s' is not exact as %s: %w", n, path, rv.Type(), ErrPrecisionLoss)
+		}
+
+		rv.SetFloat(f)
+	default:
+		return wrongType(path, val.Type, "a float", ErrNotFloat)
+	}
+
+	return nil
+}
+
+// exactFloat converts n to a float of the given bit size, reporting whether
+// the conversion kept its exact value.
+func exactFloat(n int64, bits int) (float64, bool) {
+	f := float64(n)
+	if bits == 32 {
+		f = float64(float32(n))
+	}
+
+	// Rounding up to 2^63 leaves the int64 range, so it cannot be exact
+	if f >= math.MaxInt64 {
+		return f, false
+	}
+
+	return f, int64(f) == n
+}
+
+// int64 returns the value of an integer setting as an int64.
+func (v *Value) int64() (int64, bool) {
+	switch v.Type {
+	case TypeInt:
+		return int64(v.IntVal), true
+	case TypeInt64:
+		return v.Int64Val, true
+	default:
+		return 0, false
+	}
+}
+
+// fieldName returns the config key for a struct field, or "" if the field is
+// skipped.
+func fieldName(field reflect.StructField) string {
+	name, _ := parseTag(field)
+	return name
+}
+
+// findKey finds the member of group matching name, preferring an exact match
+// over a case-insensitive one.
+func findKey(group *Value, name string) (string, bool) {
+	if _, ok := group.GroupVal[name]; ok {
+		return name, true
+	}
+
+	for key := range group.GroupVal {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,641 @@
+package libconfig
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Predefined serialization errors for better error handling and testing.
+var (
+	ErrNotScalar           = errors.New("value is not a scalar")
+	ErrNotRepresentable    = errors.New("value cannot be represented in the output format")
+	ErrInvalidWriteOptions = errors.New("invalid write options")
+)
+
+// Literal returns the libconfig literal text for a scalar value, such as
+// "hello" (quoted and escaped), 42, 42L, 0xFF, 3.14, true or null. Integers are
+// written in the base recorded in Radix. Floats are written as in the source
+// when FloatText still matches FloatVal, and otherwise always carry a
+// decimal point or exponent so they parse back as floats. Groups, arrays and
+// lists return ErrNotScalar; NaN and infinite floats return
+// ErrNotRepresentable.
+func (v Value) Literal() (string, error) {
+	switch v.Type {
+	case TypeInt:
+		return formatInteger(int64(v.IntVal), v.Radix), nil
+	case TypeInt64:
+		return formatInteger(v.Int64Val, v.Radix) + "L", nil
+	case TypeFloat:
+		if v.FloatText != "" {
+			if f, err := strconv.ParseFloat(v.FloatText, 64); err == nil && f == v.FloatVal {
+				return v.FloatText, nil
+			}
+		}
+
+		return formatFloat(v.FloatVal)
+	case TypeBool:
+		return strconv.FormatBool(v.BoolVal), nil
+	case TypeString:
+		return quoteString(v.StrVal), nil
+	case TypeNull:
+		return "null", nil
+	default:
+		return "", fmt.Errorf("cannot render %s as a literal: %w", v.Type, ErrNotScalar)
+	}
+}
+
+// formatInteger formats n in the given radix with its libconfig prefix.
+// Negative numbers carry the sign before the prefix, as in -0xFF.
+func formatInteger(n int64, radix int) string {
+	var prefix string
+
+	switch radix {
+	case 16:
+		prefix = "0x"
+	case 8:
+		prefix = "0o"
+	case 2:
+		prefix = "0b"
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+
+	if n < 0 {
+		// Negating in uint64 keeps the magnitude of math.MinInt64
+		return "-" + prefix + strings.ToUpper(strconv.FormatUint(-uint64(n), radix))
+	}
+
+	return prefix + strings.ToUpper(strconv.FormatInt(n, radix))
+}
+
+// formatFloat formats a float so that it lexes back as a float.
+func formatFloat(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("float %v: %w", f, ErrNotRepresentable)
+	}
+
+	text := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".e") {
+		text += ".0"
+	}
+
+	return text, nil
+}
+
+// quoteString quotes a string using the escape sequences understood by the
+// lexer.
+func quoteString(s string) string {
+	var b strings.Builder
+
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\v':
+			b.WriteString(`\v`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(&b, `\x%02X`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// WriteOptions controls the layout of serialized configurations.
+type WriteOptions struct {
+	// Indent is written once per nesting level. It must contain only
+	// spaces and tabs; an empty Indent writes nested settings flush left.
+	Indent string
+
+	// Assign separates a setting's name from its value, such as " = ",
+	// "=" or ": ". Surrounding spaces and tabs are kept as given. It must
+	// contain "=" or ":"; empty means " = ".
+	Assign string
+
+	// SortKeys writes group members sorted by name rather than in
+	// declaration order.
+	SortKeys bool
+
+	// OmitSemicolons leaves out the ';' after each setting, which
+	// libconfig treats as optional.
+	OmitSemicolons bool
+
+	// PortableInt64 writes the L suffix on integers outside the 32-bit
+	// range even when they are stored as TypeInt, so that the output
+	// parses back as 64-bit integers on platforms where int is 32 bits.
+	// An array holding such an integer has the suffix on all of its
+	// integers, keeping its elements of one type. By default only TypeInt64
+	// values carry the suffix.
+	PortableInt64 bool
+
+	// CommentStyle rewrites preserved comments in one style: CommentHash
+	// writes them as # comments and CommentLine as // comments, with a
+	// block comment spanning several lines becoming one comment per line.
+	// Zero writes each comment as it was in the source; other styles
+	// return ErrInvalidWriteOptions.
+	CommentStyle CommentStyle
+}
+
+// DefaultWriteOptions returns the layout used by Write: four-space
+// indentation, " = " between names and values, sorted keys and trailing
+// semicolons.
+func DefaultWriteOptions() WriteOptions {
+	return WriteOptions{Indent: "    ", Assign: " = ", SortKeys: true}
+}
+
+// Write serializes the configuration to w as libconfig text using
+// DefaultWriteOptions. Settings are written one per line, groups are
+// indented per nesting level, and integers keep the base they were written
+// in. Comments kept with Options.PreserveComments are written where they
+// were: on the lines before their setting, after it on the same line, or
+// after the last member of their group. Parsing the output yields an equivalent
+// configuration.
+//
+// The text is streamed to w through a small buffer as it is produced, so
+// writing a large configuration does not hold its full text in memory.
+func (c *Config) Write(w io.Writer) error {
+	return c.WriteWithOptions(w, DefaultWriteOptions())
+}
+
+// Marshal returns the configuration as libconfig text, as written by Write.
+// ParseString(string(data)) yields an equivalent configuration.
+func Marshal(c *Config) ([]byte, error) {
+	var b bytes.Buffer
+
+	if err := c.Write(&b); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// WriteFile writes the configuration to filename as Write does, creating
+// the file with 0o644 permissions or truncating it if it exists. The text
+// ends with a newline. A missing directory is not created; the error wraps
+// the one from the os package, such as fs.ErrNotExist.
+func (c *Config) WriteFile(filename string) error {
+	data, err := Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
+// WriteTo serializes the configuration to w as Write does and returns the
+// number of bytes written. It implements io.WriterTo.
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := c.Write(cw)
+
+	return cw.n, err
+}
+
+// WriteWithOptions serializes the configuration to w as libconfig text laid
+// out according to opts. Invalid options return ErrInvalidWriteOptions.
+func (c *Config) WriteWithOptions(w io.Writer, opts WriteOptions) error {
+	if c.Root.Type != TypeGroup {
+		return fmt.Errorf("root is a %s: %w", c.Root.Type, ErrNotGroup)
+	}
+
+	sw, err := newSerializer(w, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := sw.writeMembers("", &c.Root, 0); err != nil {
+		return err
+	}
+
+	sw.writeComments(c.Root.TrailingComments, 0)
+
+	// The buffer keeps the first write error, so checking the flush covers
+	// every write
+	if err := sw.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p to the underlying writer and counts the bytes written.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
+
+// SectionText returns the libconfig text of the single setting at path,
+// written as by Write, for example `server = { port = 8080; };` for the path
+// "server". The text parses on its own as a configuration holding just that
+// setting.
+func (c *Config) SectionText(path string) (string, error) {
+	val, err := c.Lookup(path)
+	if err != nil {
+		return "", err
+	}
+
+	parts := splitPath(path)
+	if len(parts) == 0 || parts[len(parts)-1] == "" {
+		return "", fmt.Errorf("section '%s': %w", path, ErrSettingNotFound)
+	}
+
+	var sb strings.Builder
+
+	sw := &serializer{buf: bufio.NewWriter(&sb), opts: DefaultWriteOptions()}
+	if err := sw.writeSetting(path, parts[len(parts)-1], val, 0); err != nil {
+		return "", err
+	}
+
+	// Writes to a strings.Builder cannot fail
+	_ = sw.buf.Flush()
+
+	return sb.String(), nil
+}
+
+// Bytes returns the value as libconfig text in the style of Write, such as
+// { host = "localhost"; port = 5432; } laid out over several lines for a
+// group, for passing a subtree on untouched. The text parses back with
+// ParseValue. Bytes returns nil if the value holds a NaN or infinite float,
+// which libconfig text cannot represent.
+func (v Value) Bytes() []byte {
+	var b bytes.Buffer
+
+	sw := &serializer{buf: bufio.NewWriter(&b), opts: DefaultWriteOptions()}
+	if err := sw.writeValue("", &v, 0); err != nil {
+		return nil
+	}
+
+	// Writes to a bytes.Buffer cannot fail
+	_ = sw.buf.Flush()
+
+	return b.Bytes()
+}
+
+// serializer renders values as libconfig text, streaming it to a writer.
+type serializer struct {
+	buf     *bufio.Writer
+	scratch []byte // Reused for formatting decimal integers
+	opts    WriteOptions
+	wide    bool // Writing an array whose integers all take the L suffix
+}
+
+// newSerializer validates opts and returns a serializer writing to w using
+// them.
+func newSerializer(w io.Writer, opts WriteOptions) (*serializer, error) {
+	if strings.Trim(opts.Indent, " \t") != "" {
+		return nil, fmt.Errorf("indent %q is not whitespace: %w", opts.Indent, ErrInvalidWriteOptions)
+	}
+
+	if opts.Assign == "" {
+		opts.Assign = " = "
+	}
+
+	if op := strings.Trim(opts.Assign, " \t"); op != "=" && op != ":" {
+		return nil, fmt.Errorf("assignment %q is not '=' or ':': %w", opts.Assign, ErrInvalidWriteOptions)
+	}
+
+	if opts.CommentStyle != 0 && opts.CommentStyle != CommentHash && opts.CommentStyle != CommentLine {
+		return nil, fmt.Errorf("comment style %s is not # or //: %w", opts.CommentStyle, ErrInvalidWriteOptions)
+	}
+
+	return &serializer{buf: bufio.NewWriter(w), opts: opts}, nil
+}
+
+// writeMembers writes the members of a group as settings at the given depth.
+func (s *serializer) writeMembers(path string, group *Value, depth int) error {
+	var keys []string
+
+	if s.opts.SortKeys {
+		keys = make([]string, 0, len(group.GroupVal))
+		for key := range group.GroupVal {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+	} else {
+		keys = group.MemberKeys()
+	}
+
+	for _, key := range keys {
+		member := group.GroupVal[key]
+
+		if err := s.writeSetting(joinPath(path, key), key, &member, depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSetting writes a key = value; line for the setting at path.
+func (s *serializer) writeSetting(path, key string, v *Value, depth int) error {
+	s.writeComments(v.Comments, depth)
+	s.indent(depth)
+	s.buf.WriteString(formatKey(key))
+	s.buf.WriteString(s.opts.Assign)
+
+	if err := s.writeValue(path, v, depth); err != nil {
+		return err
+	}
+
+	if !s.opts.OmitSemicolons {
+		s.buf.WriteByte(';')
+	}
+
+	if v.LineComment != "" {
+		s.buf.WriteByte(' ')
+		s.buf.WriteString(strings.Join(s.restyle(v.LineComment), " "))
+	}
+
+	s.buf.WriteByte('\n')
+
+	return nil
+}
+
+// writeValue writes a single value whose first line is already indented.
+func (s *serializer) writeValue(path string, v *Value, depth int) error {
+	switch v.Type {
+	case TypeGroup:
+		if len(v.GroupVal) == 0 && len(v.TrailingComments) == 0 {
+			s.buf.WriteString("{ }")
+			return nil
+		}
+
+		s.buf.WriteString("{\n")
+
+		if err := s.writeMembers(path, v, depth+1); err != nil {
+			return err
+		}
+
+		s.writeComments(v.TrailingComments, depth+1)
+
+		s.indent(depth)
+		s.buf.WriteByte('}')
+	case TypeArray:
+		s.wide = s.opts.PortableInt64 && slices.ContainsFunc(v.ArrayVal, func(element Value) bool {
+			return element.Type == TypeInt && !fitsInt32(int64(element.IntVal))
+		})
+		defer func() { s.wide = false }()
+
+		return s.writeSequence(path, "[", "]", v.ArrayVal, depth)
+	case TypeList:
+		return s.writeSequence(path, "(", ")", v.ListVal, depth)
+	default:
+		literal, err := s.literal(v)
+		if err != nil {
+			return fmt.Errorf("value at '%s': %w", path, err)
+		}
+
+		s.buf.WriteString(literal)
+	}
+
+	return nil
+}
+
+// writeSequence writes array or list elements between the given delimiters.
+// Sequences of scalars stay on one line; sequences containing collections put
+// each element on its own line.
+func (s *serializer) writeSequence(path, open, closing string, elements []Value, depth int) error {
+	if len(elements) == 0 {
+		s.buf.WriteString(open + " " + closing)
+		return nil
+	}
+
+	multiline := false
+
+	for i := range elements {
+		if elements[i].isCollection() {
+			multiline = true
+			break
+		}
+	}
+
+	if !multiline {
+		s.buf.WriteString(open + " ")
+	} else {
+		s.buf.WriteString(open + "\n")
+	}
+
+	for i := range elements {
+		if multiline {
+			s.indent(depth + 1)
+		}
+
+		if err := s.writeElement(path, i, &elements[i], depth+1); err != nil {
+			return err
+		}
+
+		switch {
+		case i < len(elements)-1 && multiline:
+			s.buf.WriteString(",\n")
+		case i < len(elements)-1:
+			s.buf.WriteString(", ")
+		case multiline:
+			s.buf.WriteString("\n")
+			s.indent(depth)
+		default:
+			s.buf.WriteString(" ")
+		}
+	}
+
+	s.buf.WriteString(closing)
+
+	return nil
+}
+
+// writeElement writes element i of the sequence at path. The element's path
+// is only built when it is needed, so that long arrays of scalars are
+// written without allocating per element.
+func (s *serializer) writeElement(path string, i int, element *Value, depth int) error {
+	if element.isCollection() {
+		return s.writeValue(fmt.Sprintf("%s[%d]", path, i), element, depth)
+	}
+
+	if element.Type == TypeInt && element.Radix == 0 && !s.opts.PortableInt64 {
+		s.scratch = strconv.AppendInt(s.scratch[:0], int64(element.IntVal), 10)
+		s.buf.Write(s.scratch)
+
+		return nil
+	}
+
+	literal, err := s.literal(element)
+	if err != nil {
+		return fmt.Errorf("value at '%s[%d]': %w", path, i, err)
+	}
+
+	s.buf.WriteString(literal)
+
+	return nil
+}
+
+// literal returns the literal text of a scalar, adding the L suffix to
+// integers as WriteOptions.PortableInt64 requires.
+func (s *serializer) literal(v *Value) (string, error) {
+	if v.Type == TypeInt && s.opts.PortableInt64 && (s.wide || !fitsInt32(int64(v.IntVal))) {
+		return formatInteger(int64(v.IntVal), v.Radix) + "L", nil
+	}
+
+	return v.Literal()
+}
+
+// fitsInt32 reports whether n is within the 32-bit integer range.
+func fitsInt32(n int64) bool {
+	return n >= math.MinInt32 && n <= math.MaxInt32
+}
+
+// formatKey returns key as it is written before the assignment: bare if
+// it reads back as an identifier, quoted otherwise.
+func formatKey(key string) string {
+	if isIdentifier(key) {
+		return key
+	}
+
+	return quoteString(key)
+}
+
+// isIdentifier reports whether the lexer reads s as a single identifier
+// token.
+func isIdentifier(s string) bool {
+	if s == "" || strings.EqualFold(s, "true") || strings.EqualFold(s, "false") || strings.EqualFold(s, "null") {
+		return false
+	}
+
+	for i, r := range s {
+		switch {
+		case unicode.IsLetter(r), r == '_', r == '*':
+		case i > 0 && (unicode.IsDigit(r) || r == '-'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeComments writes preserved comments, one per line, at the given depth.
+func (s *serializer) writeComments(comments []string, depth int) {
+	for _, comment := range comments {
+		for _, line := range s.restyle(comment) {
+			s.indent(depth)
+			s.buf.WriteString(line)
+			s.buf.WriteByte('\n')
+		}
+	}
+}
+
+// restyle returns the lines of a preserved comment as
+// WriteOptions.CommentStyle writes them.
+func (s *serializer) restyle(comment string) []string {
+	marker := "#"
+
+	switch s.opts.CommentStyle {
+	case CommentHash:
+	case CommentLine:
+		marker = "//"
+	default:
+		return []string{comment}
+	}
+
+	var texts []string
+
+	if body, ok := strings.CutPrefix(comment, "/*"); ok {
+		for _, line := range strings.Split(strings.TrimSuffix(body, "*/"), "\n") {
+			// Drop the * that often starts the lines of a block comment
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "*") {
+				line = strings.TrimSpace(line[1:])
+			}
+
+			texts = append(texts, line)
+		}
+
+		// Lines holding only the delimiters carry no text
+		for len(texts) > 1 && texts[0] == "" {
+			texts = texts[1:]
+		}
+
+		for len(texts) > 1 && texts[len(texts)-1] == "" {
+			texts = texts[:len(texts)-1]
+		}
+	} else {
+		for _, prefix := range []string{"#", "//", "--"} {
+			if body, ok := strings.CutPrefix(comment, prefix); ok {
+				texts = []string{strings.TrimSpace(body)}
+				break
+			}
+		}
+	}
+
+	lines := make([]string, len(texts))
+	for i, text := range texts {
+		lines[i] = marker
+		if text != "" {
+			lines[i] += " " + text
+		}
+	}
+
+	return lines
+}
+
+// indent writes the indentation for the given depth.
+func (s *serializer) indent(depth int) {
+	for range depth {
+		s.buf.WriteString(s.opts.Indent)
+	}
+}
+
+// isCollection reports whether the value is a group, array or list.
+func (v *Value) isCollection() bool {
+	return v.Type == TypeGroup || v.Type == TypeArray || v.Type == TypeList
+}